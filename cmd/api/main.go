@@ -2,27 +2,97 @@ package main
 
 import (
 	"context"
+	"flag"
 	"github.com/asynkron/protoactor-go/actor"
 	zLog "github.com/rs/zerolog/log"
+	"go-autogpt/internal/agents"
+	"go-autogpt/internal/agents/builtin"
+	fetchHandler "go-autogpt/internal/agents/fetch/handler"
+	searchHandler "go-autogpt/internal/agents/search/handler"
+	"go-autogpt/internal/agents/terminal/handler"
 	"go-autogpt/internal/api"
+	"go-autogpt/internal/config"
+	"go-autogpt/pkg/cassette"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/llm"
 	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/store/bolt"
+	"go-autogpt/pkg/usage"
 	"log"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
-// todo implement config
-// only expected value is for OPENAI_API_KEY
+// config is read from the file passed with -config, openai models without an apiKey use OPENAI_API_KEY
 func main() {
+	configPath := flag.String("config", "", "path to a json config file, defaults are used without one")
+	storePath := flag.String("store", "goals.db", "path to the file goals are persisted in")
+	resume := flag.Bool("resume", true, "resume goals that were interrupted by a restart")
+	flag.Parse()
+
 	log.Println("starting server")
 	err := logger.NewGlobal("info", true)
 	if err != nil {
 		log.Panicf("failed to initialize logger: %v", err)
 	}
 
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		zLog.Panic().Err(err).Msg("failed to load config")
+	}
+
+	llms := llm.NewRegistry(cfg.LLM)
+	if err := llms.Validate("planner", "supervisor", "terminal", "search"); err != nil {
+		zLog.Panic().Err(err).Msg("failed to configure llms")
+	}
+
+	sandbox, err := handler.NewSandbox(cfg.Terminal.Sandbox)
+	if err != nil {
+		zLog.Panic().Err(err).Msg("failed to set up the terminal's sandbox")
+	}
+
+	var sessions *handler.Sessions
+	if cfg.Terminal.Session {
+		sessions = handler.NewSessions(sandbox)
+	}
+
+	search, err := searchHandler.NewProvider(cfg.Search)
+	if err != nil {
+		zLog.Panic().Err(err).Msg("failed to set up the search provider")
+	}
+
+	// custom tools can be registered alongside the built in ones, see agents.Tool
+	tools, err := agents.NewToolRegistry(builtin.Tools()...)
+	if err != nil {
+		zLog.Panic().Err(err).Msg("failed to register tools")
+	}
+
+	goals, err := bolt.New(*storePath)
+	if err != nil {
+		zLog.Panic().Err(err).Msg("failed to open goal store")
+	}
+	defer goals.Close()
+
 	system := actor.NewActorSystem().Root
-	app := api.New(system)
+	app := api.New(system, agents.Deps{
+		Goals:     goals,
+		Events:    events.NewBroker(256),
+		LLMs:      llms,
+		Cassettes: cassette.NewDeck(cfg.Cassettes),
+		Usage:     usage.NewMeter(goals),
+		Sandbox:   sandbox,
+		Sessions:  sessions,
+		Search:    search,
+		Tools:     tools,
+		Replan:    cfg.Replan,
+		Approvals: cfg.Approvals,
+		Terminal:  cfg.Terminal,
+		Fetch:     fetchHandler.New(cfg.Fetch),
+	}, cfg.Budget, cfg.Policy)
+	if err := app.Rehydrate(context.Background(), *resume); err != nil {
+		zLog.Error().Err(err).Msg("failed to rehydrate goals")
+	}
 
 	go func() {
 		err := app.Start()
@@ -4,12 +4,17 @@ go 1.20
 
 require (
 	github.com/asynkron/protoactor-go v0.0.0-20220415175309-e9a39cdb8ddd
+	github.com/creack/pty v1.1.18
 	github.com/go-chi/chi/v5 v5.0.8
 	github.com/go-chi/render v1.0.2
 	github.com/google/uuid v1.3.0
 	github.com/justinas/alice v1.2.0
+	github.com/prometheus/client_golang v1.12.1
 	github.com/rs/zerolog v1.29.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/tmc/langchaingo v0.0.0-20230515003257-704a9bb9e313
+	go.etcd.io/bbolt v1.3.7
+	mvdan.cc/sh/v3 v3.7.0
 )
 
 require (
@@ -26,7 +31,6 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.2-0.20181231171920-c182affec369 // indirect
 	github.com/orcaman/concurrent-map v0.0.0-20190107190726-7ed82d9cb717 // indirect
-	github.com/prometheus/client_golang v1.12.1 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
@@ -0,0 +1,13 @@
+package builtin
+
+import (
+	"go-autogpt/internal/agents"
+	fetchActor "go-autogpt/internal/agents/fetch/actor"
+	searchActor "go-autogpt/internal/agents/search/actor"
+	terminalActor "go-autogpt/internal/agents/terminal/actor"
+)
+
+// Tools are the tools that come with the agents, in the order they're described to the LLM
+func Tools() []agents.Tool {
+	return []agents.Tool{terminalActor.Tool{}, searchActor.Tool{}, fetchActor.Tool{}}
+}
@@ -0,0 +1,319 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+	fetchHandler "go-autogpt/internal/agents/fetch/handler"
+	searchHandler "go-autogpt/internal/agents/search/handler"
+	"go-autogpt/internal/agents/terminal/handler"
+	"go-autogpt/pkg/cassette"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
+	"go-autogpt/pkg/llm"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/policy"
+	"go-autogpt/pkg/store"
+	"go-autogpt/pkg/usage"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Deps are the shared services and settings handed to an agent when it is spawned
+type Deps struct {
+	Goals     store.GoalStore
+	Events    *events.Broker
+	LLMs      *llm.Registry
+	Cassettes *cassette.Deck               // optional
+	Usage     *usage.Meter                 // optional
+	Sandbox   handler.Sandbox              // the terminal's commands run in
+	Sessions  *handler.Sessions            // optional, the terminal's commands run in a shell per goal
+	Search    searchHandler.SearchProvider // optional, searches fail without one
+	Tools     *ToolRegistry                // the supervisor can hand tasks to
+	Replan    ReplanConfig
+	Approvals ApprovalConfig
+	Terminal  TerminalConfig
+	Fetch     *fetchHandler.Handler // optional, shared by the fetches of every goal, fetches fail without one
+}
+
+// TerminalConfig limits each command the terminal runs, a zero limit is unlimited
+type TerminalConfig struct {
+	TimeoutSeconds float64               `json:"timeoutSeconds"` // before the command and everything it started are killed
+	MaxOutputBytes int                   `json:"maxOutputBytes"` // kept of stdout and of stderr, the rest is dropped
+	Sandbox        handler.SandboxConfig `json:"sandbox"`
+	Session        bool                  `json:"session"` // the commands of a goal share a long-lived shell
+}
+
+func (c TerminalConfig) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds * float64(time.Second))
+}
+
+// ReplanConfig is how the planner recovers from tasks that go wrong
+type ReplanConfig struct {
+	Max            int  `json:"max"`            // plan revisions per goal before a failed task fails the goal
+	VerifyOutcomes bool `json:"verifyOutcomes"` // ask the LLM whether each result matches the expected outcome
+}
+
+// ApprovalConfig is which steps of a goal wait for a person to approve them
+type ApprovalConfig struct {
+	Plans    bool `json:"plans"`    // the planner waits for its plans, and revisions of them, to be approved
+	Commands bool `json:"commands"` // the terminal waits for each command to be approved
+	// Allow are regular expressions of commands that are approved without asking, a pattern has to match the whole
+	// command
+	Allow []string `json:"allow"`
+}
+
+func (c ApprovalConfig) Validate() error {
+	for _, pattern := range c.Allow {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("allow %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether the command matches the allowlist
+func (c ApprovalConfig) Allowed(command string) bool {
+	for _, pattern := range c.Allow {
+		if ok, _ := regexp.MatchString("^(?:"+pattern+")$", command); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LLM returns the model configured for the agent, if it can't be built every call fails with the reason why
+func (d Deps) LLM(agent string) llms.LLM {
+	model, err := d.LLMs.ForAgent(agent)
+	if err != nil {
+		log.Error().Err(err).Str(logger.AgentNameField, agent).Msg("unable to build llm for agent")
+		model = llm.Unavailable{Err: err}
+	}
+	if d.Cassettes != nil {
+		model = d.Cassettes.LLM(agent, model)
+	}
+	if d.Usage != nil {
+		model = d.Usage.LLM(agent, d.LLMs.AgentModel(agent), model)
+	}
+	return budgetedLLM{deps: d, next: model}
+}
+
+// budgetedLLM refuses the calls of a goal once it has used up its budget, so each call is checked, the repairs of an
+// answer included, not only the steps of the goal
+type budgetedLLM struct {
+	deps Deps
+	next llms.LLM
+}
+
+func (l budgetedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	if err := l.check(ctx); err != nil {
+		return "", err
+	}
+	return l.next.Call(ctx, prompt, options...)
+}
+
+func (l budgetedLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	if err := l.check(ctx); err != nil {
+		return nil, err
+	}
+	return l.next.Generate(ctx, prompts, options...)
+}
+
+// check is the budget of the goal the call is made for, calls made outside a goal aren't limited
+func (l budgetedLLM) check(ctx context.Context) error {
+	id := goalctx.ID(ctx)
+	if id == uuid.Nil {
+		return nil
+	}
+	return l.deps.CheckBudget(id)
+}
+
+// CheckBudget returns models.BudgetExceeded once the goal has used up a limit of its budget an LLM call counts against
+func (d Deps) CheckBudget(id uuid.UUID) error {
+	goal, err := d.Goals.Get(context.Background(), id)
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to check budget")
+		return nil
+	}
+	return goal.CheckBudget(time.Now(), models.LLMLimits)
+}
+
+// TimeLeft is how much of the goal's wall-clock budget is left, false if the goal has no limit on it
+func (d Deps) TimeLeft(id uuid.UUID) (time.Duration, bool) {
+	goal, err := d.Goals.Get(context.Background(), id)
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to get the time left")
+		return 0, false
+	}
+	return goal.TimeLeft(time.Now())
+}
+
+// CheckPolicy returns a policy.Violation if the command breaks the goal's command policy
+func (d Deps) CheckPolicy(id uuid.UUID, command string) error {
+	goal, err := d.Goals.Get(context.Background(), id)
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to get command policy, checking the rules every command follows")
+	}
+	return policy.Check(command, goal.Policy)
+}
+
+// SpendCommand counts a terminal command against the goal's budget, or returns models.BudgetExceeded if the goal
+// can't afford it
+func (d Deps) SpendCommand(id uuid.UUID) error {
+	var exceeded error
+	err := d.Goals.Update(context.Background(), id, func(goal *models.Goal) error {
+		if exceeded = goal.CheckBudget(time.Now(), models.CommandLimits); exceeded != nil {
+			return exceeded
+		}
+		goal.Commands++
+		return nil
+	})
+	if err != nil && exceeded == nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to count command")
+	}
+	return exceeded
+}
+
+// Inputs are the files the user has provided the goal so far
+func (d Deps) Inputs(id uuid.UUID) []models.File {
+	goal, err := d.Goals.Get(context.Background(), id)
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to get the files the user provided")
+	}
+	return goal.Inputs
+}
+
+// RequestApproval holds a step of the goal until a person decides on it, the agent taking the step is sent
+// messages.Decided once they have
+func (d Deps) RequestApproval(id uuid.UUID, approval models.Approval) error {
+	err := d.Goals.Update(context.Background(), id, func(goal *models.Goal) error {
+		goal.Pending = append(goal.Pending, approval)
+		goal.Await()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.Events.Publish(id, events.ApprovalRequested, approval)
+	return nil
+}
+
+// Ask puts a question to the user, the agent asking is sent messages.Answered once they have answered it
+func (d Deps) Ask(id uuid.UUID, question models.Question) error {
+	err := d.Goals.Update(context.Background(), id, func(goal *models.Goal) error {
+		goal.Questions = append(goal.Questions, question)
+		goal.Await()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.Events.Publish(id, events.QuestionAsked, question)
+	return nil
+}
+
+// AutoApprove records a step of the goal the allowlist approved without asking
+func (d Deps) AutoApprove(id uuid.UUID, approval models.Approval) {
+	now := time.Now()
+	approval.Decision = models.Approve
+	approval.Auto = true
+	approval.DecidedAt = &now
+	err := d.Goals.Update(context.Background(), id, func(goal *models.Goal) error {
+		goal.Approvals = append(goal.Approvals, approval)
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to record approval")
+	}
+	d.Events.Publish(id, events.ApprovalDecided, approval)
+}
+
+// BudgetError is the error reported to the parent when a goal exceeds its budget, the message records the limit
+func BudgetError(exceeded error) models.Error {
+	t := time.Now()
+	var limit models.BudgetExceeded
+	if errors.As(exceeded, &limit) {
+		return models.Error{ErrMessage: limit.Error(), Message: limit, Time: &t}
+	}
+	return models.Error{ErrMessage: exceeded.Error(), Message: exceeded, Time: &t}
+}
+
+// Failed is the error reported to the parent when a step of the goal went wrong for msg, a BudgetError if an LLM call
+// of the step was refused because the goal exceeded its budget
+func Failed(err error, msg interface{}) models.Error {
+	if Exceeded(err) {
+		return BudgetError(err)
+	}
+	t := time.Now()
+	return models.Error{ErrMessage: err.Error(), Message: msg, Time: &t}
+}
+
+// Exceeded is whether the error is, or wraps, models.BudgetExceeded
+func Exceeded(err error) bool {
+	return errors.As(err, &models.BudgetExceeded{})
+}
+
+// MarshalAnswers is the json of the questions the user has answered for a prompt, empty if there are none so the prompt
+// leaves them out
+func MarshalAnswers(answers []models.Question) string {
+	if len(answers) == 0 {
+		return ""
+	}
+	res, _ := json.Marshal(models.QAs(answers)) // todo err
+	return string(res)
+}
+
+// LogDir is the directory of a goal's sandbox the logs of its commands are written to
+const LogDir = "logs"
+
+// Workspace is the goal's sandbox directory, its commands run in it
+func Workspace(id uuid.UUID) string {
+	return filepath.Join("sandbox", id.String())
+}
+
+// MarshalInputs is the json of the manifest of the files the user provided for a prompt, empty if there are none so
+// the prompt leaves them out
+func MarshalInputs(inputs []models.File) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+	res, _ := json.Marshal(models.Manifest(inputs)) // todo err
+	return string(res)
+}
+
+// MarshalHistory is the json of the task history for a prompt. The files the tasks changed are left out so the prompt
+// is the same when a goal is replayed without running its commands.
+func MarshalHistory(history []models.TaskHistory) string {
+	stripped := make([]models.TaskHistory, 0, len(history))
+	for _, h := range history {
+		h.Files = nil
+		stripped = append(stripped, h)
+	}
+	res, _ := json.Marshal(stripped) // todo err
+	return string(res)
+}
+
+var unsafeLogName = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// CommandLog is where everything the commands of a task print is logged, relative to the goal's sandbox directory
+func CommandLog(taskID string) string {
+	name := unsafeLogName.ReplaceAllString(taskID, "_")
+	if name == "" {
+		name = "task"
+	}
+	return LogDir + "/" + name + ".log"
+}
+
+// ForwardToChildren passes a control message such as Pause down the actor tree
+func ForwardToChildren(ac actor.Context, msg interface{}) {
+	for _, child := range ac.Children() {
+		ac.Send(child, msg)
+	}
+}
@@ -0,0 +1,104 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/internal/agents"
+	"go-autogpt/internal/agents/fetch/handler"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/models"
+	"strings"
+	"time"
+)
+
+type Fetch struct {
+	deps   agents.Deps
+	id     uuid.UUID
+	taskID string // the task of the plan the page is fetched for
+	state  models.State
+}
+
+func New(deps agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		return &Fetch{
+			deps:  deps,
+			id:    uuid.Nil,
+			state: models.Init,
+		}
+	}
+}
+
+func (agent *Fetch) Receive(ac actor.Context) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "fetch"}).Logger()
+	switch msg := ac.Message().(type) {
+	case *actor.Started:
+		l.Debug().Msg("starting actor")
+	case *actor.Stopping:
+		l.Debug().Msg("stopping actor")
+	case *actor.Stopped:
+		l.Debug().Msg("stopped actor and its children")
+	case *actor.Restarting:
+		l.Debug().Msg("restarting actor")
+	case messages.Pause, messages.Continue:
+		l.Debug().Msgf("nothing to pause, ignoring: %v", msg)
+	case messages.NewFetch:
+		l.Info().Msgf("NewFetch received: %v", msg.URL)
+		agent.state = models.Thinking
+		agent.id = msg.RequestID
+		agent.taskID = msg.TaskID
+		agent.fetch(ac, msg)
+		return
+	default:
+		l.Warn().Msgf("unknown message: %v", msg)
+	}
+	agent.state = models.Idle
+}
+
+// fetch reads the page and returns the chunks of it most relevant to the task, a replayed cassette serves the
+// recorded page instead of fetching it
+func (agent *Fetch) fetch(ac actor.Context, msg messages.NewFetch) {
+	l := log.With().Str(logger.RequestTaskID, agent.id.String()).Logger()
+	if err := agent.deps.CheckBudget(agent.id); err != nil {
+		l.Warn().Err(err).Msg("stopping before fetching")
+		agent.reportErrorToParent(ac, agents.BudgetError(err))
+		return
+	}
+
+	ctx := goalctx.WithTask(goalctx.With(context.Background(), agent.id), agent.taskID)
+	page, err := agent.deps.Cassettes.Fetch(ctx, msg.URL, func() (models.Page, error) {
+		if agent.deps.Fetch == nil {
+			return models.Page{}, handler.ErrNoHandler
+		}
+		return agent.deps.Fetch.Fetch(ctx, msg.URL)
+	})
+	if err == nil && strings.TrimSpace(page.Text) == "" {
+		err = errors.New("the page has no text")
+	}
+	if err != nil {
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+		return
+	}
+
+	text, chunks := handler.Relevant(page.Text, msg.Task+"\n"+msg.ExpectedOutcome)
+	res := messages.FetchResult{TaskID: agent.taskID, URL: page.URL, Title: page.Title, Result: text, Chunks: chunks, Truncated: page.Truncated}
+	l.Info().Msgf("fetched %s in %d chunks", page.URL, chunks)
+	agent.deps.Events.Publish(agent.id, events.PageFetched, res)
+
+	agent.state = models.Idle
+	ac.Send(ac.Parent(), res)
+	ac.Stop(ac.Self())
+}
+
+func (agent *Fetch) reportErrorToParent(ac actor.Context, err models.Error) {
+	agent.state = models.Failed
+	log.Error().Err(errors.New(err.ErrMessage)).Msg("reporting error to parent...")
+	ac.Send(ac.Parent(), messages.ReportError{TaskID: agent.taskID, Error: err})
+	ac.Stop(ac.Self())
+}
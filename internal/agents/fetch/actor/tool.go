@@ -0,0 +1,31 @@
+package actor
+
+import (
+	"github.com/asynkron/protoactor-go/actor"
+	"go-autogpt/internal/agents"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/tools"
+)
+
+// Tool reads the page at the url the LLM gives it and returns the parts of it most relevant to the task
+type Tool struct{}
+
+func (Tool) Name() string { return tools.Fetch }
+
+func (Tool) Description() string {
+	return "reads a web page, the parts of it most relevant to the task are returned as text"
+}
+
+func (Tool) Preference() string {
+	return "only urls from the task, its files or earlier results, never guess a url"
+}
+
+func (Tool) Inputs() []agents.ToolInput { return []agents.ToolInput{{Name: "URL", Type: "string"}} }
+
+func (Tool) Output() string { return "Content: string" }
+
+func (Tool) Producer(deps agents.Deps) actor.Producer { return New(deps) }
+
+func (Tool) Start(d agents.Dispatch) any {
+	return messages.NewFetch{RequestID: d.GoalID, TaskID: d.Task.ID, URL: d.Solution.Inputs[0], Task: d.Task.Task, ExpectedOutcome: d.Solution.Outcome}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config limits the pages the fetch tool reads, a zero limit is unlimited
+type Config struct {
+	TimeoutSeconds float64 `json:"timeoutSeconds"` // to fetch a page, redirects and robots.txt included
+	MaxBytes       int64   `json:"maxBytes"`       // read of a page, the rest is dropped and the page is marked truncated
+	UserAgent      string  `json:"userAgent"`      // sent with each request and matched against robots.txt
+	IgnoreRobots   bool    `json:"ignoreRobots"`   // fetch pages robots.txt disallows
+	// Allow is the only domains pages can be fetched from when it isn't empty, Deny the domains they can't be fetched
+	// from, a domain matches itself and its subdomains
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// Private lets pages be fetched from loopback, private and link-local addresses, such as the api's own network
+	Private bool `json:"private"`
+}
+
+func (c Config) Validate() error {
+	if c.TimeoutSeconds < 0 || c.MaxBytes < 0 {
+		return errors.New("limits can't be negative")
+	}
+	for _, domain := range append(append([]string{}, c.Allow...), c.Deny...) {
+		if domain == "" || strings.ContainsAny(domain, "/:* ") {
+			return fmt.Errorf("%q isn't a domain", domain)
+		}
+	}
+	return nil
+}
+
+func (c Config) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds * float64(time.Second))
+}
+
+// Permits returns an error if pages can't be fetched from the host
+func (c Config) Permits(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range c.Deny {
+		if matchDomain(host, domain) {
+			return fmt.Errorf("%w: %s is denied", ErrForbidden, host)
+		}
+	}
+	if len(c.Allow) == 0 {
+		return nil
+	}
+	for _, domain := range c.Allow {
+		if matchDomain(host, domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s isn't allowed", ErrForbidden, host)
+}
+
+func matchDomain(host, domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-autogpt/pkg/bm25"
+	"go-autogpt/pkg/models"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// chunkWords is about how many words pages are split into chunks of, at paragraph boundaries
+const chunkWords = 150 // todo add as a config
+
+// maxChunks is how many chunks of a page are returned
+const maxChunks = 6 // todo add as a config
+
+// maxRedirects is how many redirects are followed before giving up on a page
+const maxRedirects = 10
+
+const defaultUserAgent = "go-autogpt"
+
+var (
+	ErrForbidden   = errors.New("fetching the page isn't permitted")
+	ErrUnsupported = errors.New("the page isn't text")
+	ErrNoHandler   = errors.New("fetching pages isn't set up")
+)
+
+// Handler fetches pages within the limits and rules of its config, robots.txt is fetched once per site
+type Handler struct {
+	config Config
+	client *http.Client
+	robots *http.Client // checks the domain rules on redirects, but not robots.txt
+	mu     sync.Mutex
+	rules  map[string][]robotsRule // of robots.txt, by scheme and host
+}
+
+func New(config Config) *Handler {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !config.Private {
+		dialer.Control = publicOnly
+		// a proxy would connect to the address on our behalf without it being checked
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	h := &Handler{config: config, rules: map[string][]robotsRule{}}
+	h.client = &http.Client{Transport: transport, CheckRedirect: h.checkRedirect}
+	h.robots = &http.Client{Transport: transport, CheckRedirect: h.checkRobotsRedirect}
+	return h
+}
+
+// Fetch reads the page at the url, html is converted to markdown and other text is kept as it was served
+func (h *Handler) Fetch(ctx context.Context, rawURL string) (models.Page, error) {
+	if timeout := h.config.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return models.Page{}, fmt.Errorf("url: %w", err)
+	}
+	if err := h.permitted(ctx, u); err != nil {
+		return models.Page{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return models.Page{}, err
+	}
+	req.Header.Set("User-Agent", h.userAgent())
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return models.Page{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return models.Page{}, fmt.Errorf("status %s", res.Status)
+	}
+
+	var body io.Reader = res.Body
+	if h.config.MaxBytes > 0 {
+		body = io.LimitReader(res.Body, h.config.MaxBytes+1)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return models.Page{}, fmt.Errorf("read: %w", err)
+	}
+	page := models.Page{URL: res.Request.URL.String()}
+	if h.config.MaxBytes > 0 && int64(len(b)) > h.config.MaxBytes {
+		b = b[:h.config.MaxBytes]
+		page.Truncated = true
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(b)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	text := string(b)
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "")
+	}
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		page.Title, page.Text = Markdown(text, res.Request.URL)
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/xml",
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		page.Text = text
+	default:
+		return models.Page{}, fmt.Errorf("%w: %s", ErrUnsupported, mediaType)
+	}
+	return page, nil
+}
+
+// Relevant returns the chunks of the text most relevant to the query, in the order they're in the text, and how many
+// chunks the text was split into. The text is returned from the start when none of the chunks are relevant.
+func Relevant(text, query string) (string, int) {
+	limit := maxChunks
+	chunks := bm25.Split(text, chunkWords)
+	if len(chunks) <= limit {
+		return strings.Join(chunks, "\n\n"), len(chunks)
+	}
+
+	index := bm25.New()
+	for _, chunk := range chunks {
+		index.Add(chunk)
+	}
+	scores := index.Score(query)
+	picked := make([]int, 0, len(chunks))
+	for i, score := range scores {
+		if score > 0 {
+			picked = append(picked, i)
+		}
+	}
+	sort.SliceStable(picked, func(i, j int) bool { return scores[picked[i]] > scores[picked[j]] })
+	if len(picked) == 0 {
+		for i := 0; i < limit; i++ {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) > limit {
+		picked = picked[:limit]
+	}
+	sort.Ints(picked)
+
+	b := strings.Builder{}
+	for n, i := range picked {
+		switch {
+		case n == 0 && i > 0:
+			b.WriteString("[...]\n\n")
+		case n > 0 && i == picked[n-1]+1:
+			b.WriteString("\n\n")
+		case n > 0:
+			b.WriteString("\n\n[...]\n\n")
+		}
+		b.WriteString(chunks[i])
+	}
+	if picked[len(picked)-1] < len(chunks)-1 {
+		b.WriteString("\n\n[...]")
+	}
+	return b.String(), len(chunks)
+}
+
+// permitted returns an error if the url can't be fetched because of its scheme, the domain rules or robots.txt
+func (h *Handler) permitted(ctx context.Context, u *url.URL) error {
+	if err := h.permittedSite(u); err != nil {
+		return err
+	}
+	if h.config.IgnoreRobots {
+		return nil
+	}
+	rules, err := h.robotsRules(ctx, u)
+	if err != nil {
+		return err
+	}
+	if !robotsAllow(rules, u.RequestURI()) {
+		return fmt.Errorf("%w: robots.txt of %s disallows %s", ErrForbidden, u.Host, u.Path)
+	}
+	return nil
+}
+
+// permittedSite returns an error if the url can't be fetched because of its scheme or the domain rules
+func (h *Handler) permittedSite(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https urls can be fetched", ErrForbidden)
+	}
+	return h.config.Permits(u.Hostname())
+}
+
+func (h *Handler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return h.permitted(req.Context(), req.URL)
+}
+
+// checkRobotsRedirect keeps robots.txt from being read off a site the domain rules refuse
+func (h *Handler) checkRobotsRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return h.permittedSite(req.URL)
+}
+
+// robotsRules returns the rules robots.txt of the url's site has for the user agent, all robots are disallowed from a
+// site whose robots.txt can't be read because of a server error
+func (h *Handler) robotsRules(ctx context.Context, u *url.URL) ([]robotsRule, error) {
+	site := u.Scheme + "://" + u.Host
+	h.mu.Lock()
+	rules, ok := h.rules[site]
+	h.mu.Unlock()
+	if ok {
+		return rules, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", h.userAgent())
+	res, err := h.robots.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("robots.txt: %w", err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusOK:
+		b, err := io.ReadAll(io.LimitReader(res.Body, maxRobotsBytes))
+		if err != nil {
+			return nil, fmt.Errorf("robots.txt: %w", err)
+		}
+		rules = parseRobots(string(b), h.userAgent())
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		rules = []robotsRule{}
+	default:
+		rules = []robotsRule{{pattern: "/", match: robotsPattern("/")}}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rules[site] = rules
+	return rules, nil
+}
+
+func (h *Handler) userAgent() string {
+	if h.config.UserAgent != "" {
+		return h.config.UserAgent
+	}
+	return defaultUserAgent
+}
+
+// reserved are the ranges of addresses that aren't public: private, shared (CGNAT), loopback, link-local,
+// documentation, benchmarking, multicast and the other special purpose ranges of IANA's registries
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"), // 255.255.255.255 included
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),   // translated to ipv4 addresses, private ones included
+	netip.MustParsePrefix("64:ff9b:1::/48"), // same
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"), // 6to4, tunnels to any ipv4 address
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// publicOnly refuses to connect to addresses of the reserved ranges, it's checked on the address a host resolved to
+// so a public name pointing at a private address is refused too
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s isn't a public address", ErrForbidden, addr)
+		}
+	}
+	return nil
+}
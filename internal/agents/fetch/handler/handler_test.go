@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head><title>Sandbox &amp; backends</title><style>body { color: red }</style></head>
+<body>
+<nav><a href="/">Home</a></nav>
+<article>
+<h1>The sandbox</h1>
+<p>Commands run in a <a href="/linux">linux namespace</a>, see <code>unshare</code>.</p>
+<!-- <p>a comment</p> -->
+<script>if (a < b && c) { document.write("<p>script</p>") }</script>
+<ul><li>network</li><li>cgroups<ol><li>cpus</li></ol></li></ul>
+<pre>$ go-autogpt
+  -config config.json</pre>
+</article>
+<footer>Copyright</footer>
+</body>
+</html>`
+
+func TestMarkdown(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/sandbox")
+	title, text := Markdown(page, base)
+	if title != "Sandbox & backends" {
+		t.Errorf("Markdown() title = %q", title)
+	}
+	want := "# The sandbox\n\n" +
+		"Commands run in a [linux namespace](https://example.com/linux), see `unshare`.\n\n" +
+		"- network\n- cgroups\n\n  1. cpus\n\n" +
+		"```\n$ go-autogpt\n  -config config.json\n```"
+	if text != want {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", text, want)
+	}
+
+	title, text = Markdown("<body><nav>menu</nav><h1>Only &lt;body&gt;</h1><p>text</p></body>", base)
+	if title != "Only <body>" || text != "# Only <body>\n\ntext" {
+		t.Errorf("Markdown() = %q, %q", title, text)
+	}
+}
+
+func TestRelevant(t *testing.T) {
+	paragraphs := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		topic := "filler"
+		if i == 12 {
+			topic = "sandbox"
+		}
+		paragraphs = append(paragraphs, fmt.Sprintf("paragraph %d is about %s.%s", i, topic, strings.Repeat(" word", chunkWords)))
+	}
+	text := strings.Join(paragraphs, "\n\n")
+
+	got, chunks := Relevant(text, "sandbox configuration")
+	if chunks != 20 || !strings.HasPrefix(got, "[...]\n\nparagraph 12 is about sandbox") || !strings.HasSuffix(got, "[...]") {
+		t.Errorf("Relevant() = %d chunks, %.60q...", chunks, got)
+	}
+	// every chunk has "is", the sandbox is the most relevant of them
+	if got, _ := Relevant(text, "what is the sandbox"); !strings.Contains(got, "paragraph 12") || strings.Count(got, "paragraph") != maxChunks {
+		t.Errorf("Relevant() = %.60q..., want the sandbox among %d chunks", got, maxChunks)
+	}
+	if got, _ := Relevant(text, "nothing matches"); !strings.HasPrefix(got, "paragraph 0") || strings.Count(got, "paragraph") != maxChunks {
+		t.Errorf("Relevant() = %.60q..., want the start of the text", got)
+	}
+	if got, chunks := Relevant("short", "sandbox"); got != "short" || chunks != 1 {
+		t.Errorf("Relevant() = %q, %d", got, chunks)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `# comment
+User-agent: *
+Disallow: /private
+Allow: /private/open$
+
+User-agent: other
+User-agent: go-autogpt
+Disallow: /*.pdf$
+Disallow: /drafts/
+Allow: /drafts/published
+`
+	tests := []struct {
+		agent string
+		path  string
+		allow bool
+	}{
+		{agent: "someone", path: "/private/page"},
+		{agent: "someone", path: "/private/open", allow: true},
+		{agent: "someone", path: "/private/open/more"},
+		{agent: "someone", path: "/drafts/a", allow: true},
+		{agent: "go-autogpt/1.0", path: "/private/page", allow: true},
+		{agent: "go-autogpt/1.0", path: "/report.pdf"},
+		{agent: "go-autogpt/1.0", path: "/report.pdf?v=2", allow: true},
+		{agent: "go-autogpt/1.0", path: "/drafts/a"},
+		{agent: "go-autogpt/1.0", path: "/drafts/published/a", allow: true},
+	}
+	for _, tt := range tests {
+		if got := robotsAllow(parseRobots(robots, tt.agent), tt.path); got != tt.allow {
+			t.Errorf("robotsAllow(%s, %s) = %v, want %v", tt.agent, tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestHandler_Fetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("0123456789"))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	mux.HandleFunc("/secret", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://denied.example.com/", http.StatusFound)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// a site whose robots.txt redirects elsewhere
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://denied.example.com/robots.txt", http.StatusFound)
+	}))
+	defer elsewhere.Close()
+
+	tests := []struct {
+		name      string
+		config    Config
+		path      string
+		url       string // instead of the path of the test server
+		title     string
+		text      string
+		truncated bool
+		err       error
+	}{
+		{name: "converts html", config: Config{Private: true}, path: "/page", title: "Sandbox & backends", text: "# The sandbox"},
+		{name: "follows redirects", config: Config{Private: true}, path: "/moved", title: "Sandbox & backends", text: "# The sandbox"},
+		{name: "keeps text", config: Config{Private: true}, path: "/text", text: "0123456789"},
+		{name: "truncates", config: Config{Private: true, MaxBytes: 4}, path: "/text", text: "0123", truncated: true},
+		{name: "refuses what isn't text", config: Config{Private: true}, path: "/image", err: ErrUnsupported},
+		{name: "follows robots.txt", config: Config{Private: true}, path: "/secret", err: ErrForbidden},
+		{name: "can ignore robots.txt", config: Config{Private: true, IgnoreRobots: true}, path: "/secret", text: "secret"},
+		{name: "denies domains", config: Config{Private: true, Deny: []string{"127.0.0.1"}}, path: "/page", err: ErrForbidden},
+		{name: "allows domains", config: Config{Private: true, Allow: []string{"example.com"}}, path: "/page", err: ErrForbidden},
+		{name: "checks redirects", config: Config{Private: true, Deny: []string{"example.com"}}, path: "/away", err: ErrForbidden},
+		{name: "checks redirects of robots.txt", config: Config{Private: true, Deny: []string{"example.com"}}, url: elsewhere.URL + "/page", err: ErrForbidden},
+		{name: "refuses private addresses", config: Config{}, path: "/page", err: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.url
+			if u == "" {
+				u = ts.URL + tt.path
+			}
+			got, err := New(tt.config).Fetch(context.Background(), u)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Fetch() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != tt.title || !strings.HasPrefix(got.Text, tt.text) || got.Truncated != tt.truncated {
+				t.Errorf("Fetch() = %+v", got)
+			}
+		})
+	}
+}
+
+func Test_publicOnly(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34:443":        true,
+		"[2606:2800:220:1::1]:443": true,
+		"127.0.0.1:80":             false,
+		"10.1.2.3:80":              false,
+		"172.20.0.1:80":            false,
+		"192.168.1.1:80":           false,
+		"100.64.0.1:80":            false,
+		"100.127.255.254:80":       false,
+		"169.254.169.254:80":       false,
+		"0.0.0.0:80":               false,
+		"198.18.0.1:80":            false,
+		"255.255.255.255:80":       false,
+		"[::1]:80":                 false,
+		"[::ffff:10.0.0.1]:80":     false,
+		"[64:ff9b::a00:1]:80":      false,
+		"[fd00::1]:80":             false,
+		"[fe80::1]:80":             false,
+		"[2002:a00:1::1]:80":       false,
+	}
+	for address, public := range tests {
+		if err := publicOnly("tcp", address, nil); (err == nil) != public {
+			t.Errorf("publicOnly(%s) = %v, want public %v", address, err, public)
+		}
+	}
+}
+
+func TestConfig_Permits(t *testing.T) {
+	config := Config{Allow: []string{"example.com"}, Deny: []string{"private.example.com"}}
+	tests := map[string]bool{
+		"example.com":            true,
+		"docs.example.com":       true,
+		"EXAMPLE.com.":           true,
+		"private.example.com":    false,
+		"a.private.example.com":  false,
+		"notexample.com":         false,
+		"example.com.attack.net": false,
+	}
+	for host, permitted := range tests {
+		if err := config.Permits(host); (err == nil) != permitted {
+			t.Errorf("Permits(%s) = %v, want permitted %v", host, err, permitted)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	startToken
+	endToken
+)
+
+type token struct {
+	kind  tokenKind
+	name  string            // of the element, lower cased
+	attrs map[string]string // of a start tag, unescaped
+	text  string            // of a text token, unescaped
+}
+
+// rawElements hold text rather than markup until their end tag
+var rawElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true, "xmp": true,
+	"iframe": true, "noembed": true, "noframes": true, "noscript": true}
+
+// skippedElements aren't part of the readable content of a page
+var skippedElements = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"canvas": true, "iframe": true, "object": true, "nav": true, "header": true, "footer": true, "aside": true,
+	"form": true, "button": true, "select": true, "textarea": true, "dialog": true}
+
+// blockElements are separated from what's around them by a blank line
+var blockElements = map[string]bool{"p": true, "div": true, "section": true, "article": true, "main": true,
+	"blockquote": true, "table": true, "figure": true, "figcaption": true, "dl": true, "dd": true, "dt": true,
+	"address": true, "details": true, "summary": true, "body": true}
+
+var (
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	spaces     = regexp.MustCompile(`\s+`)
+)
+
+// Markdown converts an html page to markdown, keeping the headings, paragraphs, lists, links and preformatted text of
+// its article or main element, or of the whole body without its navigation, header and footer. It returns the
+// page's title and the markdown. Links are resolved against base.
+func Markdown(page string, base *url.URL) (string, string) {
+	tokens := tokenize(page)
+	title := ""
+	inTitle := false
+	for _, t := range tokens {
+		switch {
+		case t.name == "title":
+			inTitle = t.kind == startToken
+		case t.kind == textToken && inTitle:
+			title += t.text
+		}
+	}
+
+	c := converter{base: base, h1: -1}
+	for _, t := range readable(tokens) {
+		c.token(t)
+	}
+
+	title = strings.TrimSpace(spaces.ReplaceAllString(title, " "))
+	if title == "" {
+		title = c.heading
+	}
+	lines := strings.Split(string(c.out), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(text)
+}
+
+// readable returns the tokens of the page's first article, or main element if it has none, or every token
+func readable(tokens []token) []token {
+	for _, name := range []string{"article", "main"} {
+		for i, t := range tokens {
+			if t.kind != startToken || t.name != name {
+				continue
+			}
+			depth := 0
+			for j := i; j < len(tokens); j++ {
+				switch {
+				case tokens[j].kind == startToken && tokens[j].name == name:
+					depth++
+				case tokens[j].kind == endToken && tokens[j].name == name:
+					depth--
+				}
+				if depth == 0 {
+					return tokens[i : j+1]
+				}
+			}
+			return tokens[i:]
+		}
+	}
+	return tokens
+}
+
+type link struct {
+	start int // of the link's text in the output
+	href  string
+}
+
+type converter struct {
+	base    *url.URL
+	out     []byte
+	skip    int // depth of skipped elements the tokens are in
+	pre     int
+	lists   []int // counter of each ordered list the tokens are in, -1 for unordered lists
+	links   []link
+	inTitle bool
+	heading string // the first h1
+	h1      int    // start of the h1 being read, -1 when not in one
+}
+
+func (c *converter) token(t token) {
+	if skippedElements[t.name] && t.kind != textToken {
+		switch {
+		case t.kind == startToken:
+			c.skip++
+		case c.skip > 0:
+			c.skip--
+		}
+		return
+	}
+	if t.name == "title" {
+		c.inTitle = t.kind == startToken
+		return
+	}
+	if c.skip > 0 || c.inTitle {
+		return
+	}
+	switch t.kind {
+	case textToken:
+		c.text(t.text)
+	case startToken:
+		c.start(t)
+	case endToken:
+		c.end(t)
+	}
+}
+
+func (c *converter) text(text string) {
+	if c.pre > 0 {
+		c.out = append(c.out, text...)
+		return
+	}
+	text = spaces.ReplaceAllString(text, " ")
+	if len(c.out) == 0 || c.out[len(c.out)-1] == ' ' || c.out[len(c.out)-1] == '\n' {
+		text = strings.TrimLeft(text, " ")
+	}
+	c.out = append(c.out, text...)
+}
+
+func (c *converter) start(t token) {
+	switch t.name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.block()
+		c.out = append(c.out, strings.Repeat("#", int(t.name[1]-'0'))+" "...)
+		if t.name == "h1" && c.heading == "" {
+			c.h1 = len(c.out)
+		}
+	case "br":
+		c.newline()
+	case "hr":
+		c.block()
+		c.out = append(c.out, "---"...)
+		c.block()
+	case "ul":
+		c.block()
+		c.lists = append(c.lists, -1)
+	case "ol":
+		c.block()
+		c.lists = append(c.lists, 0)
+	case "li":
+		c.newline()
+		marker := "- "
+		if n := len(c.lists); n > 0 {
+			c.out = append(c.out, strings.Repeat("  ", n-1)...)
+			if c.lists[n-1] >= 0 {
+				c.lists[n-1]++
+				marker = fmt.Sprintf("%d. ", c.lists[n-1])
+			}
+		}
+		c.out = append(c.out, marker...)
+	case "tr":
+		c.newline()
+	case "td", "th":
+		if len(c.out) > 0 && c.out[len(c.out)-1] != '\n' {
+			c.out = append(c.out, " | "...)
+		}
+	case "pre":
+		c.block()
+		c.out = append(c.out, "```\n"...)
+		c.pre++
+	case "code":
+		if c.pre == 0 {
+			c.out = append(c.out, '`')
+		}
+	case "a":
+		c.links = append(c.links, link{start: len(c.out), href: c.resolve(t.attrs["href"])})
+	default:
+		if blockElements[t.name] {
+			c.block()
+		}
+	}
+}
+
+func (c *converter) end(t token) {
+	switch t.name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if t.name == "h1" && c.h1 >= 0 && c.h1 <= len(c.out) {
+			c.heading = strings.TrimSpace(string(c.out[c.h1:]))
+			c.h1 = -1
+		}
+		c.block()
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		c.block()
+	case "tr":
+		c.newline()
+	case "pre":
+		if c.pre > 0 {
+			c.pre--
+		}
+		c.newline()
+		c.out = append(c.out, "```"...)
+		c.block()
+	case "code":
+		if c.pre == 0 {
+			c.out = append(c.out, '`')
+		}
+	case "a":
+		if len(c.links) == 0 {
+			return
+		}
+		l := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+		text := strings.TrimSpace(string(c.out[l.start:]))
+		if l.href == "" || text == "" {
+			return
+		}
+		c.out = append(c.out[:l.start], fmt.Sprintf("[%s](%s)", text, l.href)...)
+	default:
+		if blockElements[t.name] {
+			c.block()
+		}
+	}
+}
+
+// block ends the output with a blank line, unless it's empty
+func (c *converter) block() {
+	if len(c.out) == 0 {
+		return
+	}
+	c.newline()
+	if len(c.out) < 2 || c.out[len(c.out)-2] != '\n' {
+		c.out = append(c.out, '\n')
+	}
+}
+
+// newline ends the output with a line break, unless it's empty
+func (c *converter) newline() {
+	if len(c.out) > 0 && c.out[len(c.out)-1] != '\n' {
+		c.out = append(c.out, '\n')
+	}
+}
+
+// resolve returns the absolute url of a link, or an empty string for links that aren't to a web page
+func (c *converter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// tokenize splits html into text, start and end tags, comments, doctypes and processing instructions are dropped
+func tokenize(page string) []token {
+	tokens := make([]token, 0)
+	text := func(s string) {
+		if s != "" {
+			tokens = append(tokens, token{kind: textToken, text: html.UnescapeString(s)})
+		}
+	}
+	for len(page) > 0 {
+		lt := strings.IndexByte(page, '<')
+		if lt < 0 {
+			text(page)
+			break
+		}
+		text(page[:lt])
+		page = page[lt:]
+
+		switch {
+		case strings.HasPrefix(page, "<!--"):
+			end := strings.Index(page[4:], "-->")
+			if end < 0 {
+				return tokens
+			}
+			page = page[4+end+3:]
+			continue
+		case strings.HasPrefix(page, "<!"), strings.HasPrefix(page, "<?"):
+			end := strings.IndexByte(page, '>')
+			if end < 0 {
+				return tokens
+			}
+			page = page[end+1:]
+			continue
+		}
+
+		closing := strings.HasPrefix(page, "</")
+		nameStart := 1
+		if closing {
+			nameStart = 2
+		}
+		nameEnd := nameStart
+		for nameEnd < len(page) && isNameByte(page[nameEnd]) {
+			nameEnd++
+		}
+		if nameEnd == nameStart {
+			// not a tag, such as a < in the text
+			text("<")
+			page = page[1:]
+			continue
+		}
+		name := strings.ToLower(page[nameStart:nameEnd])
+		attrs, rest := parseAttrs(page[nameEnd:])
+		page = rest
+		if closing {
+			tokens = append(tokens, token{kind: endToken, name: name})
+			continue
+		}
+		tokens = append(tokens, token{kind: startToken, name: name, attrs: attrs})
+
+		if rawElements[name] {
+			end := indexFold(page, "</"+name)
+			if end < 0 {
+				end = len(page)
+			}
+			text(page[:end])
+			page = page[end:]
+		}
+	}
+	return tokens
+}
+
+// parseAttrs reads the attributes of a tag up to its >, it returns what's after the tag
+func parseAttrs(s string) (map[string]string, string) {
+	attrs := map[string]string{}
+	i := 0
+	for i < len(s) {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r' || s[i] == '/') {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '>' {
+			return attrs, s[i+1:]
+		}
+		start := i
+		for i < len(s) && !strings.ContainsRune(" \t\n\r/>=", rune(s[i])) {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			attrs[key] = ""
+			continue
+		}
+		i++
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+		value := ""
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			quote := s[i]
+			end := strings.IndexByte(s[i+1:], quote)
+			if end < 0 {
+				return attrs, ""
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r>", rune(s[i])) {
+				i++
+			}
+			value = s[start:i]
+		}
+		attrs[key] = html.UnescapeString(value)
+	}
+	return attrs, ""
+}
+
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == ':'
+}
+
+// indexFold is the index of the first instance of an ascii substr in s ignoring case, -1 if it isn't in s
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
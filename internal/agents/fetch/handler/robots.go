@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxRobotsBytes is how much of robots.txt is read, the rest is ignored
+const maxRobotsBytes = 500 << 10
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	match   *regexp.Regexp
+}
+
+// parseRobots returns the rules of the groups of robots.txt for the user agent, the groups for every agent (*) when
+// none name it
+func parseRobots(content, userAgent string) []robotsRule {
+	product := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+	named := make([]robotsRule, 0)
+	every := make([]robotsRule, 0)
+	foundNamed := false
+
+	agents := make([]string, 0) // of the group being read
+	inRules := false
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = agents[:0]
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value, match: robotsPattern(value)}
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					every = append(every, rule)
+				case agent == product:
+					named = append(named, rule)
+					foundNamed = true
+				}
+			}
+		}
+	}
+	if foundNamed {
+		return named
+	}
+	return every
+}
+
+// robotsPattern matches paths that start with the pattern, * matches any characters and a trailing $ the end of the path
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsAllow is whether the rules allow the path, the longest matching rule wins and allow wins a tie
+func robotsAllow(rules []robotsRule, path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range rules {
+		if !rule.match.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allowed
+}
@@ -8,11 +8,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/llms/openai"
 	langChainPrompt "github.com/tmc/langchaingo/prompts"
+	"go-autogpt/internal/agents"
 	"go-autogpt/internal/agents/planner/handler"
 	supervisor "go-autogpt/internal/agents/supervisor/actor"
 	"go-autogpt/pkg/data"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
 	"go-autogpt/pkg/logger"
 	"go-autogpt/pkg/memory/buffer"
 	"go-autogpt/pkg/messages"
@@ -23,28 +25,39 @@ import (
 
 type Planner struct {
 	id        uuid.UUID
+	deps      agents.Deps
 	handler   *handler.Handler
+	extractor *data.Extractor
 	memory    buffer.Memories // todo remove when langchaingo supports
 	state     models.State
-	err       models.Error
-	history   []models.TaskHistory // todo store the complete state at the api (with durable storage eventually)???
-	completed bool
+	paused    bool
+	awaiting  *awaitingPlan
+}
+
+// awaitingPlan is a plan held back until a person decides on its approval
+type awaitingPlan struct {
+	approval models.Approval
+	approved func(ac actor.Context) // carries on with the plan
 }
 
 var (
-	NewActionPrompt = langChainPrompt.NewPromptTemplate(prompts.PlanTemplate, []string{"Goal"})
+	NewActionPrompt = langChainPrompt.NewPromptTemplate(prompts.PlanTemplate, []string{"Goal", "Files"})
+	ReplanPrompt    = langChainPrompt.NewPromptTemplate(prompts.ReplanTemplate, []string{"Goal", "History", "Remaining", "Files", "Task", "Reason", "Answers"})
 )
 
-func New() actor.Actor {
-	llm, _ := openai.New() // todo err
-	chain := chains.NewLLMChain(llm, NewActionPrompt)
-	return &Planner{
-		id:        uuid.Nil,
-		handler:   handler.New(chain),
-		memory:    buffer.Memories{Items: make([]buffer.Memory, 0)},
-		state:     models.Init,
-		history:   make([]models.TaskHistory, 0),
-		completed: false,
+func New(deps agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		llm := deps.LLM("planner")
+		chain := chains.NewLLMChain(llm, NewActionPrompt)
+		replan := chains.NewLLMChain(llm, ReplanPrompt)
+		return &Planner{
+			id:        uuid.Nil,
+			deps:      deps,
+			handler:   handler.New(chain, replan),
+			extractor: data.NewExtractor(llm),
+			memory:    buffer.Memories{Items: make([]buffer.Memory, 0)},
+			state:     models.Init,
+		}
 	}
 }
 
@@ -61,109 +74,326 @@ func (agent *Planner) Receive(ac actor.Context) {
 		l.Debug().Msg("restarting actor")
 	case *actor.Terminated:
 		l.Debug().Msg("child actor terminated")
-	case messages.GetStatus:
-		l.Debug().Msg("GetStatus message received from user")
-
-		match, err := data.SanitizeAnswer(agent.memory.Items[0].Answer) // todo restructure
-		if err != nil {
-			l.Error().Err(err).Msg("error unmarshalling json")
-			ac.Respond(err)
-			return
-		}
-		var ans map[string][]string
-		err = json.Unmarshal([]byte(match), &ans)
-		if err != nil {
-			l.Error().Err(err).Msg("error unmarshalling json")
-			ac.Respond(err)
-			return
-		}
-		if agent.completed {
-			agent.state = models.Finished
-			l.Info().Msg("Work complete!")
-			// ac.Stop(ac.Self())
-			// todo need to store the state in the api before stopping the actor
-		}
-		ac.Respond(models.Status{
-			Planner: models.Planner{
-				State:       agent.state,
-				Plan:        ans,
-				TaskHistory: agent.history,
-				Errs:        agent.err,
-			},
-		})
-		return
 	case messages.NewGoal:
 		l.Debug().Str(logger.RequestTaskID, msg.RequestID.String()).Msgf("NewGoal received from user: %v", msg)
+		agent.plan(ac, msg)
+	case messages.ResumeGoal:
+		l.Debug().Str(logger.RequestTaskID, msg.RequestID.String()).Msgf("ResumeGoal received from user: %v", msg)
+		agent.resume(ac, msg)
+	case messages.Cancel:
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("cancelling goal...")
+		agent.state = models.Cancelled
+		agent.record(func(goal *models.Goal) {
+			goal.Transition(models.Cancelled)
+		})
+		agent.publishEnded()
+		ac.Stop(ac.Self()) // stops the supervisor and its tool agents, killing any running command
+		return
+	case messages.Pause:
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("pausing goal...")
+		agent.state = models.Paused
+		agent.paused = true
+		agent.record(func(goal *models.Goal) {
+			goal.Transition(models.Paused)
+		})
+		agents.ForwardToChildren(ac, msg)
+		return
+	case messages.Continue:
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("continuing goal...")
 		agent.state = models.Thinking
-		agent.id = msg.RequestID
-
-		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("planning...")
-		hRes := agent.handler.Plan(context.Background(), msg) // todo timeout
-		if hRes.Error != nil {
-			t := time.Now()
-			agent.err = models.Error{ErrMessage: hRes.Error.Error(), Message: msg, Time: &t}
-			agent.state = models.Failed
-			return
-		}
-		agent.memory.Add(buffer.Memory{
-			Question: hRes.Question,
-			Answer:   hRes.Answer,
+		agent.paused = false
+		agent.record(func(goal *models.Goal) {
+			goal.Transition(models.Thinking)
+			goal.Await()
 		})
-
-		match, err := data.SanitizeAnswer(hRes.Answer)
-		if err != nil {
-			t := time.Now()
-			agent.err = models.Error{ErrMessage: err.Error(), Message: msg, Time: &t}
-			agent.state = models.Failed
-			return
-		}
-
-		tasks, err := parseAnswer(match)
-		if err != nil {
-			t := time.Now()
-			agent.err = models.Error{ErrMessage: hRes.Error.Error(), Message: msg, Time: &t}
-			agent.state = models.Failed
-			l.Error().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to parse answer from plan")
-			return
-		}
-		if len(tasks) == 0 {
-			t := time.Now()
-			agent.completed = true
-			agent.err = models.Error{Message: "unable to build a plan from the goal", Time: &t}
+		agents.ForwardToChildren(ac, msg)
+	case messages.Answered:
+		agents.ForwardToChildren(ac, msg)
+		return
+	case messages.Decided:
+		if agent.awaiting == nil || agent.awaiting.approval.ID != msg.Approval.ID {
+			agents.ForwardToChildren(ac, msg)
 			return
 		}
-
-		props := actor.PropsFromProducer(supervisor.New)
-		child := ac.Spawn(props)
-		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("sending plan to supervisor...")
-		ac.Send(child, messages.NewPlan{RequestID: agent.id, Plan: models.Plan{
-			Goal:  msg.Goal,
-			Tasks: tasks,
-		}})
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msgf("decision on the plan: %s", msg.Approval.Decision)
+		agent.decided(ac, msg.Approval)
+		return
 	case messages.TaskResult:
 		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("TaskResult received from supervisor agent: %v", msg)
-		agent.history = append(agent.history, msg.TaskHistory)
+		agent.record(func(goal *models.Goal) {
+			goal.TaskHistory = append(goal.TaskHistory, msg.TaskHistory)
+		})
+		agent.deps.Events.Publish(agent.id, events.TaskResult, msg)
 	case messages.SupervisorComplete:
 		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("SupervisorComplete received from supervisor agent: %v", msg)
-		agent.completed = true
-		agent.state = models.Finished
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("Work complete!")
+		agent.finish(ac)
+		return
+	case messages.Replan:
+		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("Replan received from supervisor agent: %v", msg)
+		agent.replan(ac, msg)
+		return
 	case messages.ReportError:
 		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("ReportError received from supervisor agent: %v", msg)
-		agent.completed = true
-		agent.state = models.Failed
-		agent.err = msg.Error
+		agent.fail(ac, msg.Error)
+		return
 	default:
 		l.Warn().Str(logger.RequestTaskID, agent.id.String()).Msgf("unknown message: %v", msg)
 	}
 	agent.state = models.Idle
 }
 
-func parseAnswer(answer string) ([]string, error) {
-	ba := []byte(answer)
-	res := map[string][]string{}
-	err := json.Unmarshal(ba, &res)
+func (agent *Planner) plan(ac actor.Context, msg messages.NewGoal) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "planner"}).Logger()
+	agent.state = models.Thinking
+	agent.id = msg.RequestID
+	agent.record(func(goal *models.Goal) {
+		goal.Transition(models.Thinking)
+	})
+
+	l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("planning...")
+	ctx := goalctx.With(context.Background(), agent.id)
+	hRes := agent.handler.Plan(ctx, msg, agents.MarshalInputs(agent.deps.Inputs(agent.id))) // todo timeout
+	if hRes.Error != nil {
+		agent.fail(ac, agents.Failed(hRes.Error, msg))
+		return
+	}
+	agent.memory.Add(buffer.Memory{
+		Question: hRes.Question,
+		Answer:   hRes.Answer,
+	})
+
+	ans := map[string][]models.Task{}
+	if err := agent.extractor.Extract(ctx, hRes.Answer, data.PlanSchema, &ans); err != nil {
+		l.Error().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to parse answer from plan")
+		agent.fail(ac, agents.Failed(err, msg))
+		return
+	}
+	tasks := ans["tasks"]
+	if len(tasks) == 0 {
+		t := time.Now()
+		agent.fail(ac, models.Error{ErrMessage: "unable to build a plan from the goal", Message: msg, Time: &t})
+		return
+	}
+
+	plan, err := models.NewPlan(msg.Goal, tasks)
+	if err != nil {
+		t := time.Now()
+		agent.fail(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+		return
+	}
+	agent.propose(ac, plan, "", func(ac actor.Context) {
+		agent.record(func(goal *models.Goal) {
+			goal.Plan = &plan
+		})
+
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("sending plan to supervisor...")
+		agent.supervise(ac, events.PlanCreated, messages.NewPlan{RequestID: agent.id, Plan: plan})
+	})
+}
+
+// resume continues a goal from the supervisor's last checkpoint, a goal that was never planned is planned from scratch
+func (agent *Planner) resume(ac actor.Context, msg messages.ResumeGoal) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "planner"}).Logger()
+	agent.id = msg.RequestID
+	goal, err := agent.deps.Goals.Get(context.Background(), msg.RequestID)
+	if err != nil {
+		l.Error().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to load goal to resume")
+		ac.Stop(ac.Self())
+		return
+	}
+	if goal.Plan == nil {
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("goal was never planned, planning from scratch...")
+		agent.plan(ac, messages.NewGoal{RequestID: goal.ID, Goal: goal.Goal})
+		return
+	}
+
+	checkpoint := models.Checkpoint{History: make([]models.TaskHistory, 0)}
+	if goal.Checkpoint != nil {
+		checkpoint = *goal.Checkpoint
+	}
+	remaining := goal.Plan.Remaining(checkpoint.History)
+
+	agent.state = models.Thinking
+	agent.record(func(goal *models.Goal) {
+		goal.TaskHistory = checkpoint.History // the checkpoint is the source of truth for what has completed
+		goal.Transition(models.Thinking)
+	})
+	if len(remaining) == 0 {
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("every task had already completed, nothing to resume")
+		agent.finish(ac)
+		return
+	}
+
+	l.Info().Str(logger.RequestTaskID, agent.id.String()).Msgf("resuming plan with %d remaining tasks...", len(remaining))
+	agent.supervise(ac, events.PlanCreated, messages.NewPlan{
+		RequestID: agent.id,
+		Plan:      *goal.Plan,
+		History:   checkpoint.History,
+		Answers:   goal.Answers,
+	})
+}
+
+// replan revises the tasks of the plan that haven't completed after one went wrong, the goal fails with the task's
+// error once it has been revised as many times as it can be
+func (agent *Planner) replan(ac actor.Context, msg messages.Replan) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "planner"}).Logger()
+	goal, err := agent.deps.Goals.Get(context.Background(), agent.id)
+	if err != nil {
+		agent.fail(ac, unrecoverable(msg.Error, err))
+		return
+	}
+	if goal.Plan == nil || len(goal.Revisions) >= agent.deps.Replan.Max {
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("no revisions of the plan left, failing goal")
+		agent.fail(ac, msg.Error)
+		return
+	}
+	if err := agent.deps.CheckBudget(agent.id); err != nil {
+		agent.fail(ac, agents.BudgetError(err))
+		return
+	}
+
+	l.Info().Str(logger.RequestTaskID, agent.id.String()).Msgf("task %q went wrong, revising the plan...", msg.Task)
+	agent.state = models.Thinking
+	remaining := goal.Plan.Remaining(goal.TaskHistory)
+	history := agents.MarshalHistory(goal.TaskHistory)
+	remainingTasks, _ := json.Marshal(remaining) // todo err
+	ctx := goalctx.With(context.Background(), agent.id)
+	hRes := agent.handler.Replan(ctx, goal.Goal, history, string(remainingTasks), agents.MarshalInputs(goal.Inputs), msg.Task, msg.Reason, agents.MarshalAnswers(goal.Answers))
+	if hRes.Error != nil {
+		agent.fail(ac, unrecoverable(msg.Error, hRes.Error))
+		return
+	}
+	agent.memory.Add(buffer.Memory{
+		Question: hRes.Question,
+		Answer:   hRes.Answer,
+	})
+
+	ans := map[string][]models.Task{}
+	if err := agent.extractor.Extract(ctx, hRes.Answer, data.PlanSchema, &ans); err != nil {
+		agent.fail(ac, unrecoverable(msg.Error, err))
+		return
+	}
+	revision := len(goal.Revisions) + 1
+	plan, err := goal.Plan.Revise(goal.TaskHistory, ans["tasks"], revision)
+	if err != nil {
+		agent.fail(ac, unrecoverable(msg.Error, err))
+		return
+	}
+
+	revised := models.PlanRevision{
+		Revision: revision,
+		TaskID:   msg.TaskID,
+		Reason:   msg.Reason,
+		Previous: remaining,
+		Revised:  plan.Remaining(goal.TaskHistory),
+		Time:     time.Now(),
+	}
+	agent.propose(ac, plan, msg.Reason, func(ac actor.Context) {
+		agent.record(func(goal *models.Goal) {
+			goal.Plan = &plan
+			goal.Revisions = append(goal.Revisions, revised)
+		})
+		if len(revised.Revised) == 0 {
+			l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("the revised plan has nothing left to do")
+			agent.finish(ac)
+			return
+		}
+
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msgf("sending revision %d of the plan to supervisor...", revision)
+		agent.supervise(ac, events.PlanRevised, messages.NewPlan{RequestID: agent.id, Plan: plan, History: goal.TaskHistory, Answers: goal.Answers})
+	})
+}
+
+// propose carries on with the plan straight away, or once a person approves it when plans need approval
+func (agent *Planner) propose(ac actor.Context, plan models.Plan, reason string, approved func(ac actor.Context)) {
+	if !agent.deps.Approvals.Plans {
+		approved(ac)
+		return
+	}
+
+	approval := models.Approval{
+		ID:        uuid.NewString(),
+		Kind:      models.PlanApproval,
+		Plan:      &plan,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if err := agent.deps.RequestApproval(agent.id, approval); err != nil {
+		t := time.Now()
+		agent.fail(ac, models.Error{ErrMessage: err.Error(), Message: plan, Time: &t})
+		return
+	}
+	log.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("waiting for the plan to be approved...")
+	agent.state = models.AwaitingApproval
+	agent.awaiting = &awaitingPlan{approval: approval, approved: approved}
+}
+
+// decided carries on with the plan waiting on the approval, the goal fails if the plan was rejected
+func (agent *Planner) decided(ac actor.Context, approval models.Approval) {
+	awaiting := agent.awaiting
+	agent.awaiting = nil
+	if approval.Decision == models.Reject {
+		t := time.Now()
+		agent.fail(ac, models.Error{ErrMessage: approval.Rejection(), Message: approval, Time: &t})
+		return
+	}
+	awaiting.approved(ac)
+}
+
+// unrecoverable is the error of a task that went wrong when the plan couldn't be revised
+func unrecoverable(err models.Error, reason error) models.Error {
+	if agents.Exceeded(reason) {
+		return agents.BudgetError(reason)
+	}
+	err.ErrMessage = fmt.Sprintf("%s, unable to revise the plan: %v", err.ErrMessage, reason)
+	return err
+}
+
+func (agent *Planner) supervise(ac actor.Context, event events.Type, plan messages.NewPlan) {
+	agent.deps.Events.Publish(agent.id, event, plan)
+	props := actor.PropsFromProducer(supervisor.New(agent.deps))
+	child := ac.Spawn(props)
+	if agent.paused {
+		ac.Send(child, messages.Pause{}) // holds the plan's tasks until the goal is continued
+	}
+	ac.Send(child, plan)
+}
+
+func (agent *Planner) finish(ac actor.Context) {
+	agent.state = models.Finished
+	agent.record(func(goal *models.Goal) {
+		goal.Transition(models.Finished)
+	})
+	agent.publishEnded()
+	ac.Stop(ac.Self())
+}
+
+// record persists a change to the goal, the actor keeps going if the store is unavailable
+func (agent *Planner) record(fn func(goal *models.Goal)) {
+	err := agent.deps.Goals.Update(context.Background(), agent.id, func(goal *models.Goal) error {
+		fn(goal)
+		return nil
+	})
 	if err != nil {
-		return []string{}, fmt.Errorf("unmarshal: %w", err)
+		log.Error().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to record goal")
 	}
-	return res["tasks"], nil
+}
+
+func (agent *Planner) fail(ac actor.Context, err models.Error) {
+	agent.state = models.Failed
+	agent.record(func(goal *models.Goal) {
+		goal.AddError(err)
+		goal.Transition(models.Failed)
+	})
+	agent.deps.Events.Publish(agent.id, events.Error, messages.ReportError{Error: err})
+	agent.publishEnded()
+	ac.Stop(ac.Self())
+}
+
+func (agent *Planner) publishEnded() {
+	agent.deps.Cassettes.Eject(agent.id)
+	agent.deps.Sessions.Reset(agent.id.String())
+	agent.deps.Usage.Forget(agent.id)
+	agent.deps.Events.Publish(agent.id, events.Finished, models.Transition{State: agent.state, Time: time.Now()})
 }
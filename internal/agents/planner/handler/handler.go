@@ -11,22 +11,54 @@ import (
 )
 
 type Handler struct {
-	chain chains.Chain
+	chain  chains.Chain
+	replan chains.Chain
 }
 
-func New(chain chains.Chain) *Handler {
+func New(chain, replan chains.Chain) *Handler {
 	return &Handler{
-		chain: chain,
+		chain:  chain,
+		replan: replan,
 	}
 }
 
-func (h *Handler) Plan(ctx context.Context, newAction messages.NewGoal) models.HandlerResult {
-	completion, err := chains.Call(ctx, h.chain, map[string]any{"Goal": newAction.Goal})
+type planInput struct {
+	Goal  string
+	Files string
+}
+
+type replanInput struct {
+	Goal      string
+	History   string
+	Remaining string
+	Files     string
+	Task      string
+	Reason    string
+	Answers   string
+}
+
+func (h *Handler) Plan(ctx context.Context, newAction messages.NewGoal, files string) models.HandlerResult {
+	completion, err := chains.Call(ctx, h.chain, map[string]any{"Goal": newAction.Goal, "Files": files})
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
+	}
+
+	question, err := template.Parse(prompts.PlanTemplate, planInput{Goal: newAction.Goal, Files: files})
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
+	}
+
+	return models.HandlerResult{Question: question, Answer: completion["text"].(string)}
+}
+
+func (h *Handler) Replan(ctx context.Context, goal, history, remaining, files, task, reason, answers string) models.HandlerResult {
+	input := replanInput{Goal: goal, History: history, Remaining: remaining, Files: files, Task: task, Reason: reason, Answers: answers}
+	completion, err := chains.Call(ctx, h.replan, map[string]any{"Goal": goal, "History": history, "Remaining": remaining, "Files": files, "Task": task, "Reason": reason, "Answers": answers})
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
 	}
 
-	question, err := template.Parse(prompts.PlanTemplate, newAction)
+	question, err := template.Parse(prompts.ReplanTemplate, input)
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
 	}
@@ -1,28 +1,48 @@
 package actor
 
 import (
+	"context"
+	"errors"
 	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/chains"
+	langChainPrompts "github.com/tmc/langchaingo/prompts"
+	"go-autogpt/internal/agents"
 	"go-autogpt/internal/agents/search/handler"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
 	"go-autogpt/pkg/logger"
 	"go-autogpt/pkg/memory/buffer"
 	"go-autogpt/pkg/messages"
 	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/prompts"
+	"time"
 )
 
 type Search struct {
 	handler *handler.Handler
+	deps    agents.Deps
+	id      uuid.UUID
+	taskID  string          // the task of the plan the search is for
 	memory  buffer.Memories // todo remove when langchaingo supports
 	state   models.State
-	errs    []models.Error
 }
 
-func New() actor.Actor {
-	return &Search{
-		handler: handler.New(),
-		memory:  buffer.Memories{Items: make([]buffer.Memory, 0)},
-		state:   models.Init,
-		errs:    make([]models.Error, 0),
+var (
+	SearchPrompt = langChainPrompts.NewPromptTemplate(prompts.SearchTemplate, []string{"Search", "Outcome", "Limitations", "Results"})
+)
+
+func New(deps agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		chain := chains.NewLLMChain(deps.LLM("search"), SearchPrompt)
+		return &Search{
+			handler: handler.New(deps.Search, chain),
+			deps:    deps,
+			id:      uuid.Nil,
+			memory:  buffer.Memories{Items: make([]buffer.Memory, 0)},
+			state:   models.Init,
+		}
 	}
 }
 
@@ -37,11 +57,64 @@ func (agent *Search) Receive(ac actor.Context) {
 		l.Debug().Msg("stopped actor and its children")
 	case *actor.Restarting:
 		l.Debug().Msg("restarting actor")
+	case messages.Pause, messages.Continue:
+		l.Debug().Msgf("nothing to pause, ignoring: %v", msg)
 	case messages.NewSearch:
 		l.Info().Msgf("NewSearch received: %v", msg.Search)
-		ac.Send(ac.Parent(), messages.SearchResult{Result: "the result!"}) // todo impl real search
+		agent.state = models.Thinking
+		agent.id = msg.RequestID
+		agent.taskID = msg.TaskID
+		agent.search(ac, msg)
+		return
 	default:
 		l.Warn().Msgf("unknown message: %v", msg)
 	}
 	agent.state = models.Idle
 }
+
+// search finds results for the query and summarizes them against the outcome the search was expected to have, a
+// replayed cassette serves the recorded results instead of searching
+func (agent *Search) search(ac actor.Context, msg messages.NewSearch) {
+	l := log.With().Str(logger.RequestTaskID, agent.id.String()).Logger()
+	if err := agent.deps.CheckBudget(agent.id); err != nil {
+		l.Warn().Err(err).Msg("stopping before searching")
+		agent.reportErrorToParent(ac, agents.BudgetError(err))
+		return
+	}
+
+	ctx := goalctx.WithTask(goalctx.With(context.Background(), agent.id), agent.taskID)
+	hits, err := agent.deps.Cassettes.Search(ctx, msg.Search, func() ([]models.SearchHit, error) {
+		return agent.handler.Search(ctx, msg.Search)
+	})
+	if err == nil && len(hits) == 0 {
+		err = errors.New("the search found nothing, try other keywords")
+	}
+	if err != nil {
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+		return
+	}
+	agent.deps.Events.Publish(agent.id, events.SearchResults, messages.SearchResult{TaskID: agent.taskID, Hits: hits})
+
+	l.Info().Msgf("summarizing %d results", len(hits))
+	hRes := agent.handler.Summarize(ctx, msg.Search, msg.ExpectedOutcome, msg.PossibleLimitations, hits)
+	if hRes.Error != nil {
+		agent.reportErrorToParent(ac, agents.Failed(hRes.Error, msg))
+		return
+	}
+	agent.memory.Add(buffer.Memory{
+		Question: hRes.Question,
+		Answer:   hRes.Answer,
+	})
+
+	agent.state = models.Idle
+	ac.Send(ac.Parent(), messages.SearchResult{TaskID: agent.taskID, Result: hRes.Answer, Hits: hits})
+	ac.Stop(ac.Self())
+}
+
+func (agent *Search) reportErrorToParent(ac actor.Context, err models.Error) {
+	agent.state = models.Failed
+	log.Error().Err(errors.New(err.ErrMessage)).Msg("reporting error to parent...")
+	ac.Send(ac.Parent(), messages.ReportError{TaskID: agent.taskID, Error: err})
+	ac.Stop(ac.Self())
+}
@@ -0,0 +1,29 @@
+package actor
+
+import (
+	"github.com/asynkron/protoactor-go/actor"
+	"go-autogpt/internal/agents"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/tools"
+)
+
+// Tool searches for the query the LLM gives it and summarizes the results against the expected outcome
+type Tool struct{}
+
+func (Tool) Name() string { return tools.Search }
+
+func (Tool) Description() string {
+	return "a search engine (e.g. Google), its results are summarized against the expected outcome"
+}
+
+func (Tool) Preference() string { return "be concise and use keywords" }
+
+func (Tool) Inputs() []agents.ToolInput { return []agents.ToolInput{{Name: "Query", Type: "string"}} }
+
+func (Tool) Output() string { return "Summary: string" }
+
+func (Tool) Producer(deps agents.Deps) actor.Producer { return New(deps) }
+
+func (Tool) Start(d agents.Dispatch) any {
+	return messages.NewSearch{RequestID: d.GoalID, TaskID: d.Task.ID, Search: d.Solution.Inputs[0], ExpectedOutcome: d.Solution.Outcome, PossibleLimitations: d.Solution.Limitations}
+}
@@ -1,8 +1,137 @@
 package handler
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/chains"
+	"go-autogpt/pkg/bm25"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/prompts"
+	"go-autogpt/pkg/template"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxResults is how many results of a search are summarized
+const maxResults = 8 // todo add as a config
+
+// candidates is how many results are asked of the provider, more than are kept so duplicates can be dropped
+const candidates = 2 * maxResults
+
+var ErrNoProvider = errors.New("no search provider is configured")
+
 type Handler struct {
+	provider SearchProvider
+	chain    chains.Chain
+}
+
+func New(provider SearchProvider, chain chains.Chain) *Handler {
+	return &Handler{
+		provider: provider,
+		chain:    chain,
+	}
+}
+
+type input struct {
+	Search      string
+	Outcome     string
+	Limitations string
+	Results     string
+}
+
+// Search returns the provider's results for the query, ranked and without duplicates
+func (h *Handler) Search(ctx context.Context, query string) ([]models.SearchHit, error) {
+	if h.provider == nil {
+		return nil, ErrNoProvider
+	}
+	hits, err := h.provider.Search(ctx, query, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	return Rank(query, hits, maxResults), nil
+}
+
+// Summarize asks the LLM what the results say towards the outcome the search was expected to have
+func (h *Handler) Summarize(ctx context.Context, search, outcome, limitations string, hits []models.SearchHit) models.HandlerResult {
+	results, err := json.Marshal(hits)
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("marshal: %w", err)}
+	}
+	input := input{Search: search, Outcome: outcome, Limitations: limitations, Results: string(results)}
+	completion, err := chains.Call(ctx, h.chain, map[string]any{"Search": search, "Outcome": outcome, "Limitations": limitations, "Results": input.Results})
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
+	}
+
+	question, err := template.Parse(prompts.SearchTemplate, input)
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
+	}
+
+	return models.HandlerResult{Question: question, Answer: completion["text"].(string)}
+}
+
+// Rank orders hits by their position in the provider's results and how many of the query's terms they have, dropping
+// the ones with the same url or snippet as a better hit, at most limit are kept
+func Rank(query string, hits []models.SearchHit, limit int) []models.SearchHit {
+	queryTerms := map[string]bool{}
+	for _, term := range bm25.Terms(query) {
+		queryTerms[term] = true
+	}
+	type ranked struct {
+		hit   models.SearchHit
+		score float64
+	}
+	rankings := make([]ranked, 0, len(hits))
+	for i, hit := range hits {
+		matched := map[string]bool{}
+		for _, term := range bm25.Terms(hit.Title + " " + hit.Snippet) {
+			if queryTerms[term] {
+				matched[term] = true
+			}
+		}
+		score := 1 / float64(i+1)
+		if len(queryTerms) > 0 {
+			score += float64(len(matched)) / float64(len(queryTerms))
+		}
+		rankings = append(rankings, ranked{hit: hit, score: score})
+	}
+	sort.SliceStable(rankings, func(i, j int) bool { return rankings[i].score > rankings[j].score })
+
+	urls := map[string]bool{}
+	snippets := map[string]bool{}
+	kept := make([]models.SearchHit, 0, len(rankings))
+	for _, r := range rankings {
+		u := normalizeURL(r.hit.URL)
+		snippet := strings.Join(strings.Fields(strings.ToLower(r.hit.Snippet)), " ")
+		if (u != "" && urls[u]) || (snippet != "" && snippets[snippet]) {
+			continue
+		}
+		urls[u] = true
+		snippets[snippet] = true
+		kept = append(kept, r.hit)
+		if limit > 0 && len(kept) == limit {
+			break
+		}
+	}
+	return kept
 }
 
-func New() *Handler {
-	return &Handler{}
+// normalizeURL is the url without what doesn't change the page it points to: the scheme, www., the fragment and a
+// trailing slash, a url that can't be parsed is only lower cased
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimSpace(raw))
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	normalized := host + path
+	if u.RawQuery != "" {
+		normalized += "?" + u.RawQuery
+	}
+	return normalized
 }
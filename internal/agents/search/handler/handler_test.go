@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"go-autogpt/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTP_Search(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []models.SearchHit
+		err    string
+	}{
+		{
+			name:   "searxng",
+			status: http.StatusOK,
+			body:   `{"results": [{"title": "Go", "url": "https://go.dev", "content": "the go language", "score": 2.5}, {"title": "Tour", "url": "https://go.dev/tour", "content": "a tour of go"}]}`,
+			want: []models.SearchHit{
+				{Title: "Go", URL: "https://go.dev", Snippet: "the go language", Score: 2.5},
+				{Title: "Tour", URL: "https://go.dev/tour", Snippet: "a tour of go"},
+			},
+		},
+		{
+			name:   "bing",
+			status: http.StatusOK,
+			body:   `{"webPages": {"value": [{"name": "Go", "url": "https://go.dev", "snippet": "the go language"}]}}`,
+			want:   []models.SearchHit{{Title: "Go", URL: "https://go.dev", Snippet: "the go language"}},
+		},
+		{
+			name:   "error status",
+			status: http.StatusTooManyRequests,
+			body:   "slow down",
+			err:    "slow down",
+		},
+		{
+			name:   "not json",
+			status: http.StatusOK,
+			body:   "<html>",
+			err:    "decode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if q := r.URL.Query(); q.Get("q") != "golang" || q.Get("count") != "2" || q.Get("format") != "json" {
+					t.Errorf("unexpected query %s", r.URL.RawQuery)
+				}
+				if key := r.Header.Get("Ocp-Apim-Subscription-Key"); key != "secret" {
+					t.Errorf("expected the api key to be sent, got %q", key)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			provider := NewHTTP(Config{Provider: HTTPProvider, URL: ts.URL + "/search?format=json", APIKey: "secret"})
+			hits, err := provider.Search(context.Background(), "golang", 2)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Search() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(hits, tt.want) {
+				t.Errorf("Search() = %+v, want %+v", hits, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocal_Search(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sandbox.md":     "# Sandbox\n\nThe sandbox runs commands in a linux namespace.\n\nThe local backend runs them unsandboxed.",
+		"guide/cats.txt": "Cats sleep most of the day.",
+		"notes.go":       "package sandbox // not a document",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := provider.Search(context.Background(), "Sandbox namespace", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Sandbox" || !strings.HasPrefix(hits[0].URL, "sandbox.md#") || hits[0].Score <= 0 {
+		t.Fatalf("Search() = %+v, want the sandbox doc", hits)
+	}
+	if hits, _ := provider.Search(context.Background(), "dogs", 5); len(hits) != 0 {
+		t.Errorf("Search() = %+v, want nothing", hits)
+	}
+
+	if _, err := NewLocal(filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewLocal() indexed a dir that doesn't exist")
+	}
+}
+
+func TestRank(t *testing.T) {
+	hits := []models.SearchHit{
+		{Title: "Unrelated", URL: "https://a.com", Snippet: "nothing to see"},
+		{Title: "Go sandbox", URL: "https://b.com/sandbox/", Snippet: "how the go sandbox works"},
+		{Title: "Copy", URL: "http://www.b.com/sandbox#intro", Snippet: "a copy"},
+		{Title: "Mirror", URL: "https://c.com", Snippet: "How the Go  sandbox works"},
+		{Title: "Go", URL: "https://d.com", Snippet: "a sandbox for go"},
+	}
+	got := Rank("go sandbox", hits, 2)
+	want := []models.SearchHit{hits[1], hits[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank() = %+v, want %+v", got, want)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{config: Config{}, valid: true},
+		{config: Config{Provider: HTTPProvider, URL: "http://localhost:8888/search"}, valid: true},
+		{config: Config{Provider: HTTPProvider}},
+		{config: Config{Provider: LocalProvider, Dir: "docs"}, valid: true},
+		{config: Config{Provider: LocalProvider}},
+		{config: Config{Provider: "google"}},
+		{config: Config{TimeoutSeconds: -1}},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.config, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-autogpt/pkg/models"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HTTP searches a json search api, SearxNG's results and Bing's web pages are both understood
+type HTTP struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewHTTP(config Config) *HTTP {
+	apiKey := config.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("SEARCH_API_KEY")
+	}
+	return &HTTP{url: config.URL, apiKey: apiKey, client: &http.Client{Timeout: config.Timeout()}}
+}
+
+// httpResponse is the results of SearxNG or the web pages of Bing
+type httpResponse struct {
+	Results []struct {
+		Title   string  `json:"title"`
+		URL     string  `json:"url"`
+		Content string  `json:"content"`
+		Score   float64 `json:"score"`
+	} `json:"results"`
+	WebPages struct {
+		Value []struct {
+			Name    string `json:"name"`
+			URL     string `json:"url"`
+			Snippet string `json:"snippet"`
+		} `json:"value"`
+	} `json:"webPages"`
+}
+
+func (h *HTTP) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, error) {
+	u, err := url.Parse(h.url)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	params := u.Query()
+	params.Set("q", query)
+	if limit > 0 {
+		params.Set("count", strconv.Itoa(limit))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Ocp-Apim-Subscription-Key", h.apiKey)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	body := httpResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	hits := make([]models.SearchHit, 0, len(body.Results)+len(body.WebPages.Value))
+	for _, r := range body.Results {
+		hits = append(hits, models.SearchHit{Title: r.Title, URL: r.URL, Snippet: r.Content, Score: r.Score})
+	}
+	for _, v := range body.WebPages.Value {
+		hits = append(hits, models.SearchHit{Title: v.Name, URL: v.URL, Snippet: v.Snippet})
+	}
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"go-autogpt/pkg/bm25"
+	"go-autogpt/pkg/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// passageWords is about how many words the documents are split into passages of, at paragraph boundaries
+const passageWords = 200
+
+// documentExtensions are the files the local provider indexes
+var documentExtensions = map[string]bool{".md": true, ".txt": true, ".rst": true}
+
+type passage struct {
+	title string
+	url   string // the document's path relative to the dir, with the passage's number as the fragment
+	text  string
+}
+
+// Local ranks the passages of the documents in a directory with BM25, the documents are indexed once when it's created
+type Local struct {
+	passages []passage
+	index    *bm25.Index
+}
+
+func NewLocal(dir string) (*Local, error) {
+	l := &Local{index: bm25.New()}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !documentExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		l.add(filepath.ToSlash(rel), string(content))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %w", dir, err)
+	}
+	return l, nil
+}
+
+// add indexes the passages of a document, titled by its first heading
+func (l *Local) add(path, content string) {
+	title := path
+	for _, line := range strings.Split(content, "\n") {
+		if heading, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+			title = strings.TrimSpace(heading)
+			break
+		}
+	}
+	for _, text := range bm25.Split(content, passageWords) {
+		l.passages = append(l.passages, passage{title: title, url: fmt.Sprintf("%s#%d", path, len(l.passages)), text: text})
+		l.index.Add(text)
+	}
+}
+
+func (l *Local) Search(_ context.Context, query string, limit int) ([]models.SearchHit, error) {
+	hits := make([]models.SearchHit, 0)
+	for i, score := range l.index.Score(query) {
+		if score > 0 {
+			p := l.passages[i]
+			hits = append(hits, models.SearchHit{Title: p.title, URL: p.url, Snippet: p.text, Score: score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-autogpt/pkg/models"
+	"time"
+)
+
+const (
+	HTTPProvider  = "http"  // a SearxNG or Bing style json api
+	LocalProvider = "local" // full text search of a directory of documents
+)
+
+// SearchProvider finds what's relevant to a query, most relevant first
+type SearchProvider interface {
+	Search(ctx context.Context, query string, limit int) ([]models.SearchHit, error)
+}
+
+// Config picks the provider searches are made with, searches fail without one
+type Config struct {
+	Provider string `json:"provider"`
+	// URL is the search endpoint of the http provider, the query is added to it as q and the limit as count, e.g.
+	// http://localhost:8888/search?format=json for SearxNG or https://api.bing.microsoft.com/v7.0/search for Bing
+	URL string `json:"url"`
+	// APIKey is sent in the Ocp-Apim-Subscription-Key header of the http provider, defaults to SEARCH_API_KEY
+	APIKey         string  `json:"apiKey,omitempty"`
+	TimeoutSeconds float64 `json:"timeoutSeconds"`
+	Dir            string  `json:"dir"` // of the documents the local provider indexes when the api starts
+}
+
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "":
+	case HTTPProvider:
+		if c.URL == "" {
+			return errors.New("the http provider needs a url")
+		}
+	case LocalProvider:
+		if c.Dir == "" {
+			return errors.New("the local provider needs a dir")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q, use %q or %q", c.Provider, HTTPProvider, LocalProvider)
+	}
+	if c.TimeoutSeconds < 0 {
+		return errors.New("the timeout can't be negative")
+	}
+	return nil
+}
+
+func (c Config) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds * float64(time.Second))
+}
+
+// NewProvider returns the provider of the config, nil if none is configured
+func NewProvider(config Config) (SearchProvider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	switch config.Provider {
+	case HTTPProvider:
+		return NewHTTP(config), nil
+	case LocalProvider:
+		local, err := NewLocal(config.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return local, nil
+	}
+	return nil, nil
+}
@@ -9,45 +9,86 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/llms/openai"
 	langChainPrompts "github.com/tmc/langchaingo/prompts"
-	searchActor "go-autogpt/internal/agents/search/actor"
+	"go-autogpt/internal/agents"
 	"go-autogpt/internal/agents/supervisor/handler"
-	terminalActor "go-autogpt/internal/agents/terminal/actor"
+	supervisorModels "go-autogpt/internal/agents/supervisor/models"
 	"go-autogpt/pkg/data"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
 	"go-autogpt/pkg/logger"
 	"go-autogpt/pkg/memory/buffer"
 	"go-autogpt/pkg/messages"
 	"go-autogpt/pkg/models"
 	"go-autogpt/pkg/prompts"
-	"go-autogpt/pkg/tools"
+	"go-autogpt/pkg/workspace"
+	"os"
+	"path/filepath"
 	"time"
 )
 
+// maxRunning is how many tasks of a plan are worked on at the same time
+const maxRunning = 4 // todo add as a config
+
+// maxTail is how many of the latest lines of a task's commands are kept in its history
+const maxTail = 50 // todo add as a config
+
+// outputInterval is how often the latest lines of the running tasks are persisted for the status, at most
+const outputInterval = time.Second
+
+// maxQuestions is how many questions the user is asked about a task before it's treated as failed
+const maxQuestions = 3 // todo add as a config
+
 type Supervisor struct {
-	handler    *handler.Handler
-	id         uuid.UUID
-	goal       string
-	tasksQueue []string
-	history    []models.TaskHistory
-	memory     buffer.Memories // todo remove when langchaingo supports
-	state      models.State
+	handler   *handler.Handler
+	extractor *data.Extractor
+	deps      agents.Deps
+	id        uuid.UUID
+	goal      string
+	plan      models.Plan
+	done      map[string]bool                // ids of the completed tasks
+	running   map[string]models.TaskHistory  // tasks being thought about or handed to a tool agent, by id
+	thinking  map[string]bool                // ids of the running tasks the LLM is working out a solution for
+	verifying map[string]bool                // ids of the completed tasks the LLM is verifying the outcome of
+	asked     map[string]string              // ids of the tasks waiting on the user's answer, by question id
+	answers   []models.Question              // the user has answered about the goal
+	questions map[string][]models.Question   // answered while working on each task, by task id
+	output    map[string][]models.OutputLine // latest lines of each task's commands, by task id
+	saved     time.Time                      // when the supervisor last checkpointed
+	files     workspace.Snapshot             // the goal's sandbox as the running tasks found it, nil if unknown
+	paused    bool
+	replan    *messages.Replan // held until the running tasks have completed
+	history   []models.TaskHistory
+	memory    buffer.Memories // todo remove when langchaingo supports
+	state     models.State
 }
 
 var (
-	TaskPrompt = langChainPrompts.NewPromptTemplate(prompts.TaskTemplate, []string{"Goal", "Task", "History"})
+	TaskPrompt   = langChainPrompts.NewPromptTemplate(prompts.TaskTemplate, []string{"Goal", "Task", "Artifacts", "Files", "History", "Answers", "Tools"})
+	VerifyPrompt = langChainPrompts.NewPromptTemplate(prompts.VerifyTemplate, []string{"Goal", "Task", "Outcome", "Result"})
 )
 
-func New() actor.Actor {
-	llm, _ := openai.New() // todo err
-	chain := chains.NewLLMChain(llm, TaskPrompt)
-	return &Supervisor{
-		handler:    handler.New(chain),
-		id:         uuid.Nil,
-		tasksQueue: make([]string, 0),
-		history:    make([]models.TaskHistory, 0),
-		memory:     buffer.Memories{Items: make([]buffer.Memory, 0)},
-		state:      models.Init,
+func New(deps agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		llm := deps.LLM("supervisor")
+		chain := chains.NewLLMChain(llm, TaskPrompt)
+		verify := chains.NewLLMChain(llm, VerifyPrompt)
+		return &Supervisor{
+			handler:   handler.New(chain, verify),
+			extractor: data.NewExtractor(llm),
+			deps:      deps,
+			id:        uuid.Nil,
+			done:      map[string]bool{},
+			running:   map[string]models.TaskHistory{},
+			thinking:  map[string]bool{},
+			verifying: map[string]bool{},
+			asked:     map[string]string{},
+			questions: map[string][]models.Question{},
+			output:    map[string][]models.OutputLine{},
+			history:   make([]models.TaskHistory, 0),
+			memory:    buffer.Memories{Items: make([]buffer.Memory, 0)},
+			state:     models.Init,
+		}
 	}
 }
 
@@ -68,105 +109,445 @@ func (agent *Supervisor) Receive(ac actor.Context) {
 		l.Debug().Str(logger.RequestTaskID, msg.RequestID.String()).Msgf("NewPlan received from planner agent: %v", msg)
 		agent.goal = msg.Goal
 		agent.id = msg.RequestID
-		agent.tasksQueue = append(agent.tasksQueue, msg.Tasks...)
+		agent.plan = msg.Plan
+		agent.history = append(agent.history, msg.History...)
+		agent.answers = append(agent.answers, msg.Answers...)
+		for _, task := range msg.History {
+			agent.done[task.ID] = true
+		}
 		agent.Next(ac, msg)
-	case messages.SearchResult: // from search actor
-		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("SearchResult received from search agent: %v", msg)
-		agent.history[len(agent.history)-1].Result = msg.Result
-		if finish := agent.reportTaskToParent(ac, agent.history[len(agent.history)-1]); finish {
+	case messages.Result: // from a tool's actor
+		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("%T received for task %s", msg, msg.ResultOf())
+		if finish := agent.completeTask(ac, msg.ResultOf(), msg); finish {
 			return
 		}
 		agent.Next(ac, msg)
-	case messages.CommandResult:
-		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("CommandResult received from terminal agent: %v", msg)
-		agent.history[len(agent.history)-1].Result = msg
-		if finish := agent.reportTaskToParent(ac, agent.history[len(agent.history)-1]); finish {
+	case solved: // from the goroutine working out the solution
+		agent.solved(ac, msg)
+	case verified: // from the goroutine verifying the outcome
+		if finish := agent.verified(ac, msg); finish {
 			return
 		}
 		agent.Next(ac, msg)
+	case messages.CommandOutputLine: // from terminal actor, as its command runs
+		agent.outputLine(msg)
+		return
+	case messages.Pause: // from planner
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("pausing once the running tasks complete...")
+		agent.paused = true
+		agents.ForwardToChildren(ac, msg)
+		agent.state = models.Paused
+		return
+	case messages.Continue: // from planner
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("continuing...")
+		agent.paused = false
+		agents.ForwardToChildren(ac, msg)
+		agent.Next(ac, msg)
+	case messages.Decided: // from planner, for the tool agent waiting on the approval
+		agents.ForwardToChildren(ac, msg)
+		return
+	case messages.Answered: // from planner
+		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("Answered received from planner agent: %v", msg)
+		question := msg.Question
+		agent.answers = append(agent.answers, question)
+		agent.questions[question.TaskID] = append(agent.questions[question.TaskID], question)
+		agents.ForwardToChildren(ac, msg)
+		if id, ok := agent.asked[question.ID]; ok {
+			// the task is thought about again with the answer
+			delete(agent.asked, question.ID)
+			delete(agent.running, id)
+			agent.Next(ac, msg)
+		}
 	case messages.ReportError:
 		l.Debug().Str(logger.RequestTaskID, agent.id.String()).Msgf("ReportError received from child agent: %v", msg)
-		agent.reportErrorToParent(ac, msg.Error)
+		task, ok := agent.running[msg.TaskID]
+		if _, budget := msg.Error.Message.(models.BudgetExceeded); budget || !ok {
+			agent.reportErrorToParent(ac, msg.Error)
+			return
+		}
+		agent.requestReplan(ac, task.ID, task.Task, msg.Error)
 		return
 	default:
 		l.Warn().Str(logger.RequestTaskID, agent.id.String()).Msgf("unknown message: %v", msg)
 	}
-	agent.state = models.Idle
+	if agent.state != models.Failed {
+		agent.state = models.Idle
+	}
 }
 
+// Next hands every task whose dependencies have completed to a tool agent, so independent tasks run at the same time
 func (agent *Supervisor) Next(ac actor.Context, msg interface{}) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "supervisor"}).Logger()
+	if agent.replan != nil {
+		return
+	}
+	if agent.paused {
+		l.Info().Str(logger.RequestTaskID, agent.id.String()).Msg("paused, holding the next tasks until continued")
+		return
+	}
+	for _, task := range agent.ready() {
+		if len(agent.running) >= maxRunning {
+			return
+		}
+		if err := agent.deps.CheckBudget(agent.id); err != nil {
+			l.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("stopping before the next task")
+			agent.reportErrorToParent(ac, agents.BudgetError(err))
+			return
+		}
+		agent.think(ac, task, msg)
+	}
+}
+
+// ready is the tasks that haven't started and whose dependencies have all completed, and been verified, in the order
+// of the plan
+func (agent *Supervisor) ready() []models.Task {
+	ready := make([]models.Task, 0)
+	for _, task := range agent.plan.Tasks {
+		if _, ok := agent.running[task.ID]; ok || agent.done[task.ID] {
+			continue
+		}
+		met := true
+		for _, dep := range task.DependsOn {
+			met = met && agent.done[dep] && !agent.verifying[dep]
+		}
+		if met {
+			ready = append(ready, task)
+		}
+	}
+	return ready
+}
+
+// solved is the solution the LLM worked out for a task, sent to the supervisor by the goroutine that asked for it
+type solved struct {
+	task     models.Task
+	result   models.HandlerResult
+	solution models.Solution
+	err      error
+	msg      interface{} // the task was dispatched on
+}
+
+// think works out a solution for the task outside the mailbox, so the supervisor can still be paused, cancelled and
+// handed results while the LLM thinks. The solution is dispatched once it's sent back.
+func (agent *Supervisor) think(ac actor.Context, task models.Task, msg interface{}) {
 	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "supervisor"}).Logger()
 	agent.state = models.Thinking
-	task := agent.tasksQueue[0]
-	agent.tasksQueue = agent.tasksQueue[1:] // pop
+	agent.running[task.ID] = models.TaskHistory{ID: task.ID, Task: task.Task}
+	agent.thinking[task.ID] = true
 
-	l.Info().Str(logger.TaskField, task).Msg("grabbing next task off the queue...")
-	l.Info().Str(logger.TaskField, task).Msg("thinking about a solution for the task...")
-	hRes := agent.handler.Solution(context.Background(), task, agent.goal, agent.marshalHistory())
-	if hRes.Error != nil {
-		t := time.Now()
-		agent.reportErrorToParent(ac, models.Error{ErrMessage: hRes.Error.Error(), Time: &t, Message: msg})
+	l.Info().Str(logger.TaskField, task.Task).Msg("thinking about a solution for the task...")
+	ctx := goalctx.WithTask(goalctx.With(context.Background(), agent.id), task.ID)
+	goal, history, files, answers, tools := agent.goal, agent.marshalHistory(task), agents.MarshalInputs(agent.deps.Inputs(agent.id)), agents.MarshalAnswers(agent.answers), agent.deps.Tools.Describe()
+	self, root := ac.Self(), ac.ActorSystem().Root
+	go func() {
+		res := solved{task: task, msg: msg}
+		res.result = agent.handler.Solution(ctx, task, goal, history, files, answers, tools)
+		res.err = res.result.Error
+		if res.err == nil {
+			res.err = agent.extractor.Extract(ctx, res.result.Answer, data.SolutionSchema, &res.solution)
+		}
+		root.Send(self, res)
+	}()
+}
+
+// solved spawns the tool agent of the solution to carry out the task
+func (agent *Supervisor) solved(ac actor.Context, res solved) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "supervisor"}).Logger()
+	task, ans, msg := res.task, res.solution, res.msg
+	if !agent.thinking[task.ID] {
+		l.Debug().Str(logger.TaskField, task.Task).Msg("dropping the solution of a task that was dropped")
+		return
+	}
+	delete(agent.thinking, task.ID)
+	if res.err != nil {
+		failed := agents.Failed(res.err, msg)
+		if _, budget := failed.Message.(models.BudgetExceeded); budget {
+			agent.reportErrorToParent(ac, failed)
+			return
+		}
+		agent.requestReplan(ac, task.ID, task.Task, failed)
 		return
 	}
 	agent.memory.Add(buffer.Memory{
-		Question: hRes.Question,
-		Answer:   hRes.Answer,
+		Question: res.result.Question,
+		Answer:   res.result.Answer,
 	})
 
-	match, err := data.SanitizeAnswer(hRes.Answer)
-	if err != nil {
+	l.Info().Str(logger.TaskField, task.Task).Msgf("solution determined, using %s to solve the task...", ans.Tool)
+	agent.deps.Events.Publish(agent.id, events.ToolChosen, ans)
+	agent.snapshot(task.ID)
+	tool, known := agent.deps.Tools.Get(ans.Tool)
+	switch {
+	case known && tool == agents.AskUser:
+		if ok := agent.ask(ac, task, ans, msg); !ok {
+			return
+		}
+	case !known:
+		l.Error().Msgf("unknown tool: %v", ans.Tool)
 		t := time.Now()
-		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+		agent.requestReplan(ac, task.ID, task.Task, models.Error{ErrMessage: "unknown tool when determining solution from task", Message: msg, Time: &t})
+		return
+	case len(ans.Inputs) < len(tool.Inputs()):
+		l.Error().Msgf("%s needs %d inputs, got %d", ans.Tool, len(tool.Inputs()), len(ans.Inputs))
+		t := time.Now()
+		agent.requestReplan(ac, task.ID, task.Task, models.Error{ErrMessage: fmt.Sprintf("the %s tool needs %d inputs, the solution gave %d", ans.Tool, len(tool.Inputs()), len(ans.Inputs)), Message: msg, Time: &t})
 		return
+	default:
+		child := ac.Spawn(actor.PropsFromProducer(tool.Producer(agent.deps)))
+		start := tool.Start(agents.Dispatch{GoalID: agent.id, Task: task, Solution: ans, Answers: agent.answers})
+		ac.Send(child, start)
+		if agent.paused {
+			ac.Send(child, messages.Pause{}) // paused while the LLM thought about the task
+		}
+		agent.deps.Events.Publish(agent.id, events.TaskDispatched, start)
 	}
+	agent.running[task.ID] = models.TaskHistory{ID: task.ID, Task: task.Task, Solution: ans}
+	agent.checkpoint()
+}
 
-	ans, err := parseAnswer(match)
-	if err != nil {
+// ask puts the solution's question to the user, the task is thought about again once they have answered. It returns
+// false if the supervisor failed.
+func (agent *Supervisor) ask(ac actor.Context, task models.Task, ans models.Solution, msg interface{}) bool {
+	if len(agent.questions[task.ID]) >= maxQuestions {
 		t := time.Now()
-		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Time: &t, Message: msg})
-		return
+		agent.requestReplan(ac, task.ID, task.Task, models.Error{ErrMessage: "asked the user too many questions about the task", Message: msg, Time: &t})
+		return false
+	}
+	question := models.Question{
+		ID:       uuid.NewString(),
+		TaskID:   task.ID,
+		Agent:    "supervisor",
+		Question: ans.Inputs[0],
+		Reason:   ans.Reasoning,
+		AskedAt:  time.Now(),
 	}
+	if err := agent.deps.Ask(agent.id, question); err != nil {
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+		return false
+	}
+	agent.asked[question.ID] = task.ID
+	return true
+}
 
-	l.Info().Str(logger.TaskField, task).Msgf("solution determined, using %s to solve the task...", ans.Tool)
-	switch tools.Tool(ans.Tool) {
-	case tools.Search: // todo impl
-		props := actor.PropsFromProducer(searchActor.New)
-		child := ac.Spawn(props)
-		ac.Send(child, messages.NewSearch{Search: ans.Inputs[0], ExpectedOutcome: ans.Outcome, PossibleLimitations: ans.Limitations})
-		agent.history = append(agent.history, models.TaskHistory{Task: task, Solution: ans})
-		return
-	case tools.Terminal:
-		props := actor.PropsFromProducer(terminalActor.New)
-		child := ac.Spawn(props)
-		ac.Send(child, messages.ExecuteCommand{RequestID: agent.id, Command: ans.Inputs[0], Reason: ans.Reasoning, Task: task}) // todo dont assume one input
-		agent.history = append(agent.history, models.TaskHistory{Task: task, Solution: ans})
-		return
-	default:
-		l.Error().Msgf("unknown tool: %v", ans.Tool)
+// marshalHistory is the history of the tasks the task depends on, which is everything it can build on
+func (agent *Supervisor) marshalHistory(task models.Task) string {
+	deps := agent.plan.Dependencies(task.ID)
+	history := make([]models.TaskHistory, 0, len(deps))
+	for _, h := range agent.history {
+		if deps[h.ID] {
+			history = append(history, h)
+		}
+	}
+	return agents.MarshalHistory(history)
+}
+
+// completeTask moves a running task to the history with its result and reports it, the outcome is verified before
+// the tasks depending on it start. It returns true once the plan has finished.
+func (agent *Supervisor) completeTask(ac actor.Context, id string, result any) bool {
+	task, ok := agent.running[id]
+	if !ok {
+		log.Warn().Str(logger.RequestTaskID, agent.id.String()).Msgf("result for a task that isn't running: %s", id)
+		return false
+	}
+	delete(agent.running, id)
+	task.Result = result
+	task.Usage = agent.deps.Usage.Task(agent.id, id)
+	task.Questions = agent.questions[id]
+	task.Output = agent.output[id]
+	delete(agent.output, id)
+	if _, err := os.Stat(filepath.Join(agents.Workspace(agent.id), agents.CommandLog(id))); err == nil {
+		task.Log = agents.CommandLog(id)
+	}
+	task.Files = agent.changes()
+	agent.history = append(agent.history, task)
+	agent.done[id] = true
+	agent.checkpoint()
+	ac.Send(ac.Parent(), messages.TaskResult{TaskHistory: task})
+
+	if agent.deps.Replan.VerifyOutcomes {
+		agent.verify(ac, task)
+		return false
+	}
+	return agent.finishTask(ac, task)
+}
+
+// finishTask sends the held replan once the running tasks have completed, or reports the plan complete once every task
+// has, it returns true if the supervisor is done
+func (agent *Supervisor) finishTask(ac actor.Context, task models.TaskHistory) bool {
+	if agent.replan != nil {
+		agent.drain(ac)
+		return true
+	}
+	return agent.reportCompleteToParent(ac, task)
+}
+
+// verified is the LLM's verdict on the outcome of a completed task, sent to the supervisor by the goroutine that
+// asked for it
+type verified struct {
+	task    models.TaskHistory
+	verdict supervisorModels.Verdict
+}
+
+// verify asks the LLM outside the mailbox whether the result of a task matches the outcome its solution expected, a
+// result that can't be verified is given the benefit of the doubt
+func (agent *Supervisor) verify(ac actor.Context, task models.TaskHistory) {
+	agent.verifying[task.ID] = true
+	l := log.With().Str(logger.RequestTaskID, agent.id.String()).Str(logger.TaskField, task.Task).Logger()
+	result, _ := json.Marshal(task.Result) // todo err
+	ctx := goalctx.WithTask(goalctx.With(context.Background(), agent.id), task.ID)
+	goal := agent.goal
+	self, root := ac.Self(), ac.ActorSystem().Root
+	go func() {
+		res := verified{task: task, verdict: supervisorModels.Verdict{Matches: true}}
+		defer func() { root.Send(self, res) }()
+		hRes := agent.handler.Verify(ctx, goal, task.Task, task.Solution.Outcome, string(result))
+		if hRes.Error != nil {
+			l.Warn().Err(hRes.Error).Msg("unable to verify the outcome of the task")
+			return
+		}
+		verdict := supervisorModels.Verdict{}
+		if err := agent.extractor.Extract(ctx, hRes.Answer, data.VerifySchema, &verdict); err != nil {
+			l.Warn().Err(err).Msg("unable to parse the verdict on the outcome of the task")
+			return
+		}
+		res.verdict = verdict
+	}()
+}
+
+// verified revises the plan if the outcome of the task was contradicted, or carries on as if the task had just
+// completed. It returns true if the supervisor is done.
+func (agent *Supervisor) verified(ac actor.Context, res verified) bool {
+	if !agent.verifying[res.task.ID] {
+		return false
+	}
+	delete(agent.verifying, res.task.ID)
+	if !res.verdict.Matches {
 		t := time.Now()
-		agent.reportErrorToParent(ac, models.Error{ErrMessage: "unknown tool when determining solution from task", Message: msg, Time: &t})
+		agent.requestReplan(ac, res.task.ID, res.task.Task, models.Error{ErrMessage: "the result contradicts the expected outcome: " + res.verdict.Reason, Message: res.task, Time: &t})
+		return true
+	}
+	return agent.finishTask(ac, res.task)
+}
+
+// checkpoint persists the completed history so the plan can be resumed from the tasks that completed, tasks still
+// running are run again on resume
+func (agent *Supervisor) checkpoint() {
+	running := make([]string, 0, len(agent.running))
+	for _, task := range agent.plan.Tasks {
+		if _, ok := agent.running[task.ID]; ok {
+			running = append(running, task.ID)
+		}
+	}
+	checkpoint := models.Checkpoint{
+		Running: running,
+		History: agent.history,
+	}
+	output := make(map[string][]models.OutputLine, len(agent.output))
+	for id, tail := range agent.output {
+		output[id] = tail
+	}
+	agent.saved = time.Now()
+	err := agent.deps.Goals.Update(context.Background(), agent.id, func(goal *models.Goal) error {
+		goal.Checkpoint = &checkpoint
+		goal.Output = output
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to checkpoint plan")
+	}
+}
+
+// snapshot takes the goal's sandbox as the task about to run finds it, unless other tasks are running and changing it.
+// Tasks the LLM is still thinking about haven't changed anything yet.
+func (agent *Supervisor) snapshot(id string) {
+	if agent.files != nil {
+		for running := range agent.running {
+			if running != id && !agent.thinking[running] {
+				return
+			}
+		}
+	}
+	files, err := workspace.Take(agents.Workspace(agent.id), agent.files, agents.LogDir)
+	if err != nil {
+		log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to snapshot the workspace")
 		return
 	}
+	agent.files = files
+}
+
+// changes are the files created, modified and deleted since the last snapshot. While tasks run at the same time their
+// changes are recorded in the task that completes first.
+func (agent *Supervisor) changes() []models.FileChange {
+	files, err := workspace.Take(agents.Workspace(agent.id), agent.files, agents.LogDir)
+	if err != nil {
+		log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to snapshot the workspace")
+		agent.files = nil
+		return nil
+	}
+	before := agent.files
+	agent.files = files
+	if before == nil {
+		return nil
+	}
+	return before.Diff(files)
 }
 
-func (agent *Supervisor) marshalHistory() string {
-	res, _ := json.Marshal(agent.history) // todo err
-	return string(res)
+// outputLine keeps the latest lines of the running task's commands and streams the line on, the lines are persisted
+// for the status at most every outputInterval
+func (agent *Supervisor) outputLine(msg messages.CommandOutputLine) {
+	if _, ok := agent.running[msg.TaskID]; !ok {
+		return
+	}
+	agent.output[msg.TaskID] = models.AppendTail(agent.output[msg.TaskID], msg.OutputLine, maxTail)
+	agent.deps.Events.Publish(agent.id, events.CommandLine, msg)
+	if time.Since(agent.saved) >= outputInterval {
+		agent.checkpoint()
+	}
 }
 
-func (agent *Supervisor) reportTaskToParent(ac actor.Context, task models.TaskHistory) bool {
-	log.Info().Msg("reporting completed task to parent...")
-	if len(agent.tasksQueue) == 0 {
-		log.Info().Msg("we have completed all the tasks in our queue, report the results back to the user!")
+func (agent *Supervisor) reportCompleteToParent(ac actor.Context, task models.TaskHistory) bool {
+	if len(agent.done) == len(agent.plan.Tasks) && len(agent.verifying) == 0 {
+		log.Info().Msg("we have completed all the tasks in our plan, report the results back to the user!")
 		agent.state = models.Finished
-		ac.Send(ac.Parent(), messages.TaskResult{TaskHistory: task})
 		ac.Send(ac.Parent(), messages.SupervisorComplete{Result: task.Result})
 		ac.Stop(ac.Self())
 		return true
+	}
+	return false
+}
+
+// requestReplan hands the goal back to the planner to revise what's left of the plan, once the tasks still running
+// have completed as none of them depend on the task. Tasks waiting on the user's answer are left to the revised plan,
+// which is run by a new supervisor.
+func (agent *Supervisor) requestReplan(ac actor.Context, id, task string, err models.Error) {
+	l := log.With().Str(logger.RequestTaskID, agent.id.String()).Str(logger.TaskField, task).Logger()
+	agent.state = models.Failed
+	delete(agent.running, id)
+	delete(agent.thinking, id)
+	if agent.replan != nil {
+		l.Warn().Err(errors.New(err.ErrMessage)).Msg("task went wrong while waiting to revise the plan, leaving it to the revision")
 	} else {
-		ac.Send(ac.Parent(), messages.TaskResult{TaskHistory: task})
+		l.Warn().Err(errors.New(err.ErrMessage)).Msg("task went wrong, asking parent to revise the plan...")
+		agent.replan = &messages.Replan{TaskID: id, Task: task, Reason: err.ErrMessage, Error: err}
+	}
+	for question, id := range agent.asked {
+		delete(agent.asked, question)
+		delete(agent.running, id)
+	}
+	if !agent.drain(ac) {
+		l.Info().Msgf("waiting on %d running tasks before revising the plan", len(agent.running))
+		agent.checkpoint()
+	}
+}
+
+// drain sends the held replan to the planner once no tasks are running or being verified, it returns true if it did
+func (agent *Supervisor) drain(ac actor.Context) bool {
+	if agent.replan == nil || len(agent.running) > 0 || len(agent.verifying) > 0 {
 		return false
 	}
+	ac.Send(ac.Parent(), *agent.replan)
+	ac.Stop(ac.Self())
+	return true
 }
 
 func (agent *Supervisor) reportErrorToParent(ac actor.Context, err models.Error) {
@@ -175,13 +556,3 @@ func (agent *Supervisor) reportErrorToParent(ac actor.Context, err models.Error)
 	ac.Send(ac.Parent(), messages.ReportError{Error: err})
 	ac.Stop(ac.Self())
 }
-
-func parseAnswer(answer string) (models.Solution, error) {
-	ba := []byte(answer)
-	res := models.Solution{}
-	err := json.Unmarshal(ba, &res)
-	if err != nil {
-		return models.Solution{}, fmt.Errorf("unmarshal: %w", err)
-	}
-	return res, nil
-}
@@ -7,31 +7,46 @@ import (
 	"go-autogpt/pkg/models"
 	"go-autogpt/pkg/prompts"
 	"go-autogpt/pkg/template"
+	"strings"
 )
 
 type Handler struct {
-	chain chains.Chain
+	chain  chains.Chain
+	verify chains.Chain
 }
 
-func New(chain chains.Chain) *Handler {
+func New(chain, verify chains.Chain) *Handler {
 	return &Handler{
-		chain: chain,
+		chain:  chain,
+		verify: verify,
 	}
 }
 
-type input struct {
+type verifyInput struct {
 	Goal    string
 	Task    string
-	History string
+	Outcome string
+	Result  string
+}
+
+type input struct {
+	Goal      string
+	Task      string
+	Artifacts string
+	Files     string
+	History   string
+	Answers   string
+	Tools     string
 }
 
-func (h *Handler) Solution(ctx context.Context, task, goal, history string) models.HandlerResult {
-	completion, err := chains.Call(ctx, h.chain, map[string]any{"Task": task, "Goal": goal, "History": history})
+func (h *Handler) Solution(ctx context.Context, task models.Task, goal, history, files, answers, tools string) models.HandlerResult {
+	artifacts := strings.Join(task.Artifacts, ", ")
+	completion, err := chains.Call(ctx, h.chain, map[string]any{"Task": task.Task, "Artifacts": artifacts, "Files": files, "Goal": goal, "History": history, "Answers": answers, "Tools": tools})
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
 	}
 
-	input := input{Goal: goal, Task: task, History: history}
+	input := input{Goal: goal, Task: task.Task, Artifacts: artifacts, Files: files, History: history, Answers: answers, Tools: tools}
 	question, err := template.Parse(prompts.TaskTemplate, input)
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
@@ -42,3 +57,18 @@ func (h *Handler) Solution(ctx context.Context, task, goal, history string) mode
 		Answer:   completion["text"].(string),
 	}
 }
+
+func (h *Handler) Verify(ctx context.Context, goal, task, outcome, result string) models.HandlerResult {
+	input := verifyInput{Goal: goal, Task: task, Outcome: outcome, Result: result}
+	completion, err := chains.Call(ctx, h.verify, map[string]any{"Goal": goal, "Task": task, "Outcome": outcome, "Result": result})
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
+	}
+
+	question, err := template.Parse(prompts.VerifyTemplate, input)
+	if err != nil {
+		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
+	}
+
+	return models.HandlerResult{Question: question, Answer: completion["text"].(string)}
+}
@@ -0,0 +1,6 @@
+package models
+
+type Verdict struct {
+	Matches bool   `json:"matches"`
+	Reason  string `json:"reason"`
+}
@@ -9,41 +9,96 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/llms/openai"
 	langChainPrompts "github.com/tmc/langchaingo/prompts"
+	"go-autogpt/internal/agents"
 	"go-autogpt/internal/agents/terminal/handler"
 	agentModel "go-autogpt/internal/agents/terminal/models"
 	"go-autogpt/pkg/data"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/goalctx"
 	"go-autogpt/pkg/logger"
 	"go-autogpt/pkg/memory/buffer"
 	"go-autogpt/pkg/messages"
 	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/policy"
 	"go-autogpt/pkg/prompts"
+	"os"
+	"path/filepath"
 	"time"
 )
 
 type Terminal struct {
 	handler     *handler.Handler
+	extractor   *data.Extractor
+	deps        agents.Deps
 	id          uuid.UUID
 	memory      buffer.Memories // todo remove when langchaingo supports
 	state       models.State
 	maxAttempts int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	paused      bool
+	pending     interface{} // next step held back while paused
+	taskID      string      // the task of the plan the terminal is working on
+	awaiting    *awaitingCommand
+	asking      *askingQuestion
+	answers     []models.Question // the user has answered about the goal
+}
+
+// askingQuestion is a diagnosis held back until the user answers the diagnoser's question
+type askingQuestion struct {
+	question models.Question
+	trigger  messages.DiagnoseCommand // tried again once answered
+}
+
+// awaitingCommand is a command held back until a person decides on its approval
+type awaitingCommand struct {
+	approval models.Approval
+	trigger  interface{} // the ExecuteCommand or DiagnoseCommand that wants to run the command
+	command  string
+	reason   string
+}
+
+// diagnosed is the next attempt the LLM diagnosed for a failed command, sent to the terminal by the goroutine that asked
+// for it
+type diagnosed struct {
+	trigger  messages.DiagnoseCommand
+	result   models.HandlerResult
+	diagnose agentModel.Diagnose
+	err      error // extracting the diagnosis from the answer
+}
+
+// commandFinished is sent by the terminal to itself when a command running in the background exits,
+// commands run outside the mailbox so the actor can still be paused or stopped while they run
+type commandFinished struct {
+	trigger interface{} // the ExecuteCommand or DiagnoseCommand that ran the command
+	command string
+	reason  string
+	output  models.CommandOutput
+	err     error
 }
 
 var (
-	TerminalDiagnoseErrorPrompt = langChainPrompts.NewPromptTemplate(prompts.CommandDiagnoseTemplate, []string{"PreviousAttempts", "Task"})
+	TerminalDiagnoseErrorPrompt = langChainPrompts.NewPromptTemplate(prompts.CommandDiagnoseTemplate, []string{"PreviousAttempts", "Task", "Answers"})
 )
 
-func New() actor.Actor {
-	llm, _ := openai.New() // todo err
-	chain := chains.NewLLMChain(llm, TerminalDiagnoseErrorPrompt)
-	return &Terminal{
-		handler: handler.New(chain),
-		id:      uuid.Nil,
-		memory:  buffer.Memories{Items: make([]buffer.Memory, 0)},
-		state:   models.Init,
-		// to prevent infinite loop
-		maxAttempts: 5, // todo add as a config
+func New(deps agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		llm := deps.LLM("terminal")
+		chain := chains.NewLLMChain(llm, TerminalDiagnoseErrorPrompt)
+		ctx, cancel := context.WithCancel(context.Background())
+		return &Terminal{
+			handler:   handler.New(chain, deps.Sandbox, deps.Sessions, handler.Limits{Timeout: deps.Terminal.Timeout(), MaxOutput: deps.Terminal.MaxOutputBytes}),
+			extractor: data.NewExtractor(llm),
+			deps:      deps,
+			id:        uuid.Nil,
+			memory:    buffer.Memories{Items: make([]buffer.Memory, 0)},
+			state:     models.Init,
+			// to prevent infinite loop
+			maxAttempts: 5, // todo add as a config
+			ctx:         ctx,
+			cancel:      cancel,
+		}
 	}
 }
 
@@ -54,16 +109,36 @@ func (agent *Terminal) Receive(ac actor.Context) {
 		l.Debug().Msg("starting actor")
 	case *actor.Stopping:
 		l.Debug().Msg("stopping actor")
+		agent.cancel() // kills any command still running
 	case *actor.Stopped:
 		l.Debug().Msg("stopped actor and its children")
 	case *actor.Restarting:
 		l.Debug().Msg("restarting actor")
+		agent.cancel()
+	case messages.Pause:
+		l.Info().Msg("pausing after the running command...")
+		agent.paused = true
+		agent.state = models.Paused
+		return
+	case messages.Continue:
+		l.Info().Msg("continuing...")
+		agent.paused = false
+		if agent.pending != nil {
+			ac.Send(ac.Self(), agent.pending)
+			agent.pending = nil
+		}
 	case messages.ExecuteCommand:
 		l.Debug().Msgf("ExecuteCommand received: %v", msg)
 		agent.state = models.Thinking
 		if msg.RequestID != uuid.Nil {
 			agent.id = msg.RequestID
 		}
+		if msg.TaskID != "" {
+			agent.taskID = msg.TaskID
+		}
+		if msg.Answers != nil {
+			agent.answers = msg.Answers
+		}
 
 		err := agent.handler.CreateDirectoryIfNotExists(agent.id.String())
 		if err != nil {
@@ -73,22 +148,8 @@ func (agent *Terminal) Receive(ac actor.Context) {
 		}
 
 		l.Info().Msgf("attempting to run command: %v", msg.Command)
-		out, err := agent.handler.RunCommand(context.Background(), msg.Command, agent.id.String()) // todo timeout
-		if err != nil {
-			agent.state = models.Failed
-			l.Error().Err(err).Msgf("command failed: %v", msg.Command)
-			previous := append(msg.PreviousAttempts, messages.CommandAttempt{
-				Command: msg.Command,
-				Error:   err.Error(),
-				Reason:  msg.Reason,
-			})
-			ac.Send(ac.Self(), messages.DiagnoseCommand{PreviousAttempts: previous, Task: msg.Task})
-			return
-		}
-
-		l.Info().Msgf("command succeeded with output: %v", out)
-		ac.Send(ac.Parent(), messages.CommandResult{Result: out, DiagnosticAttempts: msg.PreviousAttempts})
-		ac.Stop(ac.Self())
+		agent.runCommand(ac, msg, msg.Command, msg.Reason)
+		return
 	case messages.DiagnoseCommand:
 		// todo this should honestly use sub-prompts to determine what is available to help determine the next step
 		// it currently will attempt to brute force rather than intelligently diagnose
@@ -102,59 +163,320 @@ func (agent *Terminal) Receive(ac actor.Context) {
 		}
 		agent.maxAttempts--
 
+		if err := agent.deps.CheckBudget(agent.id); err != nil {
+			l.Warn().Err(err).Msg("stopping before diagnosing the command")
+			agent.reportErrorToParent(ac, agents.BudgetError(err))
+			return
+		}
+
 		l.Info().Msg("diagnosing problem from previous command...")
-		previousAttempts := agent.marshalPreviousAttempts(msg.PreviousAttempts)
-		hRes := agent.handler.DiagnoseNextAttempt(context.Background(), msg.Task, previousAttempts)
-		if hRes.Error != nil {
-			t := time.Now()
-			agent.reportErrorToParent(ac, models.Error{ErrMessage: hRes.Error.Error(), Message: msg, Time: &t})
+		agent.deps.Events.Publish(agent.id, events.DiagnosisAttempt, msg)
+		agent.diagnose(ac, msg)
+		return
+	case diagnosed: // from the goroutine diagnosing the command
+		if agent.ctx.Err() != nil {
 			return
 		}
-		agent.memory.Add(buffer.Memory{
-			Question: hRes.Question,
-			Answer:   hRes.Answer,
-		})
+		if agent.paused {
+			agent.pending = msg
+			return
+		}
+		agent.diagnosed(ac, msg)
+		return
+	case messages.Decided: // from supervisor
+		if agent.awaiting == nil || agent.awaiting.approval.ID != msg.Approval.ID {
+			return
+		}
+		if agent.paused {
+			agent.pending = msg
+			return
+		}
+		l.Info().Msgf("decision on the command: %s", msg.Approval.Decision)
+		agent.decided(ac, msg.Approval)
+		return
+	case messages.Answered: // from supervisor
+		if agent.asking == nil || agent.asking.question.ID != msg.Question.ID {
+			return
+		}
+		if agent.paused {
+			agent.pending = msg
+			return
+		}
+		l.Info().Msgf("the user answered: %s", msg.Question.Answer)
+		agent.answers = append(agent.answers, msg.Question)
+		trigger := agent.asking.trigger
+		agent.asking = nil
+		ac.Send(ac.Self(), trigger)
+		return
+	case commandFinished:
+		agent.commandFinished(ac, msg)
+	default:
+		l.Warn().Str(logger.RequestTaskID, agent.id.String()).Msgf("unknown message: %v", msg)
+	}
+	if agent.paused {
+		agent.state = models.Paused
+		return
+	}
+	agent.state = models.Idle
+}
 
-		match, err := data.SanitizeAnswer(hRes.Answer)
-		if err != nil {
-			t := time.Now()
-			agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+// diagnose asks the LLM for the next attempt outside the mailbox, so the terminal can still be paused or stopped while
+// it thinks. The attempt is made once it's sent back.
+func (agent *Terminal) diagnose(ac actor.Context, msg messages.DiagnoseCommand) {
+	previousAttempts := agent.marshalPreviousAttempts(msg.PreviousAttempts)
+	answers := agents.MarshalAnswers(agent.answers)
+	ctx := goalctx.WithTask(goalctx.With(agent.ctx, agent.id), agent.taskID)
+	self, root := ac.Self(), ac.ActorSystem().Root
+	go func() {
+		res := diagnosed{trigger: msg}
+		res.result = agent.handler.DiagnoseNextAttempt(ctx, msg.Task, previousAttempts, answers)
+		if res.result.Error == nil {
+			res.err = agent.extractor.Extract(ctx, res.result.Answer, data.DiagnoseSchema, &res.diagnose)
+		}
+		root.Send(self, res)
+	}()
+}
+
+// diagnosed runs the command the LLM diagnosed, or asks the user when it couldn't work one out
+func (agent *Terminal) diagnosed(ac actor.Context, res diagnosed) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "terminal"}).Logger()
+	if res.result.Error != nil {
+		agent.reportErrorToParent(ac, agents.Failed(res.result.Error, res.trigger))
+		return
+	}
+	agent.memory.Add(buffer.Memory{
+		Question: res.result.Question,
+		Answer:   res.result.Answer,
+	})
+	if res.err != nil {
+		agent.reportErrorToParent(ac, agents.Failed(res.err, res.trigger))
+		return
+	}
+
+	diagnose := res.diagnose
+	if diagnose.Command == "" {
+		l.Info().Msgf("unable to determine a command, asking the user: %s because %s...", diagnose.Question, diagnose.Reason)
+		agent.ask(ac, res.trigger, diagnose)
+		return
+	}
+
+	l.Info().Msgf("new solution determined, I should run the command: %s because %s...", diagnose.Command, diagnose.Reason)
+	agent.runCommand(ac, res.trigger, diagnose.Command, diagnose.Reason)
+}
+
+// runCommand runs the command once it's approved, commands that break the goal's policy aren't run and commands are
+// approved straight away unless they need approval and aren't in the allowlist
+func (agent *Terminal) runCommand(ac actor.Context, trigger interface{}, command, reason string) {
+	if agent.refused(ac, trigger, command, reason) {
+		return
+	}
+	if !agent.deps.Approvals.Commands {
+		agent.startCommand(ac, trigger, command, reason)
+		return
+	}
+
+	approval := models.Approval{
+		ID:        uuid.NewString(),
+		Kind:      models.CommandApproval,
+		TaskID:    agent.taskID,
+		Command:   command,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if agent.deps.Approvals.Allowed(command) {
+		agent.deps.AutoApprove(agent.id, approval)
+		agent.startCommand(ac, trigger, command, reason)
+		return
+	}
+	if err := agent.deps.RequestApproval(agent.id, approval); err != nil {
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: trigger, Time: &t})
+		return
+	}
+	log.Info().Str(logger.RequestTaskID, agent.id.String()).Msgf("waiting for approval to run the command: %s", command)
+	agent.state = models.AwaitingApproval
+	agent.awaiting = &awaitingCommand{approval: approval, trigger: trigger, command: command, reason: reason}
+}
+
+// refused checks the command against the goal's policy, a command that breaks it is fed back to the diagnoser like a
+// command that failed, without running it
+func (agent *Terminal) refused(ac actor.Context, trigger interface{}, command, reason string) bool {
+	err := agent.deps.CheckPolicy(agent.id, command)
+	if err == nil {
+		return false
+	}
+	log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msgf("refusing to run the command: %s", command)
+	agent.commandFinished(ac, commandFinished{trigger: trigger, command: command, reason: reason, err: err})
+	return true
+}
+
+// ask puts the diagnoser's question to the user, the command is diagnosed again once they have answered
+func (agent *Terminal) ask(ac actor.Context, trigger messages.DiagnoseCommand, diagnose agentModel.Diagnose) {
+	question := models.Question{
+		ID:       uuid.NewString(),
+		TaskID:   agent.taskID,
+		Agent:    "terminal",
+		Question: diagnose.Question,
+		Reason:   diagnose.Reason,
+		AskedAt:  time.Now(),
+	}
+	if err := agent.deps.Ask(agent.id, question); err != nil {
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: trigger, Time: &t})
+		return
+	}
+	agent.state = models.WaitingForInput
+	agent.asking = &askingQuestion{question: question, trigger: trigger}
+}
+
+// decided runs the command waiting on the approval as approved or edited, a rejected command is reported to the parent
+// as an error. An edited command follows the goal's policy like any other.
+func (agent *Terminal) decided(ac actor.Context, approval models.Approval) {
+	awaiting := agent.awaiting
+	agent.awaiting = nil
+	switch approval.Decision {
+	case models.Reject:
+		t := time.Now()
+		agent.reportErrorToParent(ac, models.Error{ErrMessage: approval.Rejection(), Message: approval, Time: &t})
+	case models.Edit:
+		if agent.refused(ac, awaiting.trigger, approval.Edited, awaiting.reason) {
 			return
 		}
+		agent.startCommand(ac, awaiting.trigger, approval.Edited, awaiting.reason)
+	default:
+		agent.startCommand(ac, awaiting.trigger, awaiting.command, awaiting.reason)
+	}
+}
+
+// startCommand runs the command in the background and reports back to the actor with commandFinished
+func (agent *Terminal) startCommand(ac actor.Context, trigger interface{}, command, reason string) {
+	agent.state = models.Thinking
+	if err := agent.deps.SpendCommand(agent.id); err != nil {
+		log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msgf("stopping before running the command: %s", command)
+		agent.reportErrorToParent(ac, agents.BudgetError(err))
+		return
+	}
+	self := ac.Self()
+	parent := ac.Parent()
+	root := ac.ActorSystem().Root
+	// the command can't run past the goal's wall-clock budget
+	ctx := goalctx.With(agent.ctx, agent.id)
+	cancel := func() {}
+	if left, limited := agent.deps.TimeLeft(agent.id); limited {
+		ctx, cancel = context.WithTimeout(ctx, left)
+	}
+	id := agent.id.String()
+	taskID := agent.taskID
+	agent.deps.Events.Publish(agent.id, events.CommandStarted, messages.CommandAttempt{Command: command, Reason: reason})
+	logFile := agent.openLog(command)
+	go func() {
+		// each line is streamed to the supervisor and logged in full, however much of the output is kept
+		lines := func(stream, line string) {
+			root.Send(parent, messages.CommandOutputLine{TaskID: taskID, OutputLine: models.OutputLine{Stream: stream, Line: line}})
+			if logFile != nil {
+				_, _ = fmt.Fprintln(logFile, line)
+			}
+		}
+		// a replayed cassette serves the recorded output instead of running the command, its lines are streamed after
+		ran := false
+		out, err := agent.deps.Cassettes.Command(ctx, command, func() (models.CommandOutput, error) {
+			ran = true
+			return agent.handler.RunCommand(ctx, command, id, lines)
+		})
+		if !ran {
+			handler.StreamLines(out, lines)
+		}
+		if logFile != nil {
+			if err != nil {
+				_, _ = fmt.Fprintf(logFile, "# %s\n", err)
+			}
+			_ = logFile.Close()
+		}
+		cancel()
+		root.Send(self, commandFinished{trigger: trigger, command: command, reason: reason, output: out, err: err})
+	}()
+}
 
-		diagnose, err := parseDiagnose(match)
-		if err != nil {
-			t := time.Now()
-			agent.reportErrorToParent(ac, models.Error{ErrMessage: err.Error(), Message: msg, Time: &t})
+// openLog opens the log of the task's commands to append the command to, the command still runs without a log if it
+// can't be opened
+func (agent *Terminal) openLog(command string) *os.File {
+	path := filepath.Join(agents.Workspace(agent.id), agents.CommandLog(agent.taskID))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to create the command log directory")
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Warn().Err(err).Str(logger.RequestTaskID, agent.id.String()).Msg("unable to open the command log")
+		return nil
+	}
+	_, _ = fmt.Fprintf(f, "$ %s\n", command)
+	return f
+}
+
+func (agent *Terminal) commandFinished(ac actor.Context, msg commandFinished) {
+	l := log.With().Fields(map[string]interface{}{logger.ActorIDField: ac.Self().GetId(), logger.AgentNameField: "terminal"}).Logger()
+	if agent.ctx.Err() != nil {
+		l.Debug().Msgf("command cancelled: %v", msg.command)
+		return
+	}
+	attempt := messages.CommandAttempt{
+		Command:   msg.command,
+		Reason:    msg.reason,
+		Output:    msg.output.Stdout,
+		Stderr:    msg.output.Stderr,
+		Truncated: msg.output.Truncated,
+	}
+	if msg.err != nil {
+		attempt.Error = msg.err.Error()
+		attempt.Refused = errors.As(msg.err, &policy.Violation{})
+	}
+	agent.deps.Events.Publish(agent.id, events.CommandOutput, attempt)
+
+	switch trigger := msg.trigger.(type) {
+	case messages.ExecuteCommand:
+		if msg.err != nil {
+			agent.state = models.Failed
+			l.Error().Err(msg.err).Msgf("command failed: %v", msg.command)
+			previous := append(trigger.PreviousAttempts, attempt)
+			agent.next(ac, messages.DiagnoseCommand{PreviousAttempts: previous, Task: trigger.Task})
 			return
 		}
 
-		l.Info().Msgf("new solution determined, I should run the command: %s because %s...", diagnose.Command, diagnose.Reason)
-		out, err := agent.handler.RunCommand(context.Background(), diagnose.Command, agent.id.String())
-		if err != nil {
+		l.Info().Msgf("command succeeded with output: %v", msg.output.Stdout)
+		ac.Send(ac.Parent(), messages.CommandResult{TaskID: agent.taskID, Result: msg.output.Stdout, DiagnosticAttempts: trigger.PreviousAttempts})
+		ac.Stop(ac.Self())
+	case messages.DiagnoseCommand:
+		if msg.err != nil {
 			agent.state = models.Failed
-			l.Error().Err(err).Msgf("command failed again: %v", diagnose.Command)
-			previous := append(msg.PreviousAttempts, messages.CommandAttempt{
-				Command: diagnose.Command,
-				Error:   err.Error(),
-				Reason:  diagnose.Reason,
-			})
-			ac.Send(ac.Self(), messages.DiagnoseCommand{PreviousAttempts: previous, Task: msg.Task})
+			l.Error().Err(msg.err).Msgf("command failed again: %v", msg.command)
+			previous := append(trigger.PreviousAttempts, attempt)
+			agent.next(ac, messages.DiagnoseCommand{PreviousAttempts: previous, Task: trigger.Task})
 			return
 		}
 
-		previous := append(msg.PreviousAttempts, messages.CommandAttempt{
-			Command: diagnose.Command,
-			Reason:  diagnose.Reason,
-			Output:  out,
-		})
+		previous := append(trigger.PreviousAttempts, attempt)
+
+		if trigger.PreviousAttempts[0].Refused {
+			// the original command can't be run, the diagnosed command took its place
+			l.Info().Msgf("command succeeded in place of a command the policy refused, with output: %v", msg.output.Stdout)
+			ac.Send(ac.Parent(), messages.CommandResult{TaskID: agent.taskID, Result: msg.output.Stdout, DiagnosticAttempts: previous})
+			ac.Stop(ac.Self())
+			return
+		}
 
 		l.Info().Msg("command succeeded, I should try the original command now...")
-		ac.Send(ac.Self(), messages.ExecuteCommand{Command: msg.PreviousAttempts[0].Command, Task: msg.Task, Reason: msg.PreviousAttempts[0].Reason, PreviousAttempts: previous})
-	default:
-		l.Warn().Str(logger.RequestTaskID, agent.id.String()).Msgf("unknown message: %v", msg)
+		agent.next(ac, messages.ExecuteCommand{Command: trigger.PreviousAttempts[0].Command, Task: trigger.Task, Reason: trigger.PreviousAttempts[0].Reason, PreviousAttempts: previous})
 	}
-	agent.state = models.Idle
+}
+
+// next moves on to the next step, unless paused in which case it is held until the terminal continues
+func (agent *Terminal) next(ac actor.Context, msg interface{}) {
+	if agent.paused {
+		agent.pending = msg
+		return
+	}
+	ac.Send(ac.Self(), msg)
 }
 
 func (agent *Terminal) marshalPreviousAttempts(previousAttempts []messages.CommandAttempt) string {
@@ -165,16 +487,6 @@ func (agent *Terminal) marshalPreviousAttempts(previousAttempts []messages.Comma
 func (agent *Terminal) reportErrorToParent(ac actor.Context, err models.Error) {
 	agent.state = models.Failed
 	log.Error().Err(errors.New(err.ErrMessage)).Msg("reporting error to parent...")
-	ac.Send(ac.Parent(), messages.ReportError{Error: err})
+	ac.Send(ac.Parent(), messages.ReportError{TaskID: agent.taskID, Error: err})
 	ac.Stop(ac.Self())
 }
-
-func parseDiagnose(answer string) (agentModel.Diagnose, error) {
-	ba := []byte(answer)
-	res := agentModel.Diagnose{}
-	err := json.Unmarshal(ba, &res)
-	if err != nil {
-		return agentModel.Diagnose{}, fmt.Errorf("unmarshal: %w", err)
-	}
-	return res, nil
-}
@@ -0,0 +1,29 @@
+package actor
+
+import (
+	"github.com/asynkron/protoactor-go/actor"
+	"go-autogpt/internal/agents"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/tools"
+)
+
+// Tool runs the command the LLM gives it in the goal's sandbox, diagnosing it when it fails
+type Tool struct{}
+
+func (Tool) Name() string { return tools.Terminal }
+
+func (Tool) Description() string { return "a bash based unix terminal" }
+
+func (Tool) Preference() string {
+	return "use verbose flags where possible and avoid any dangerous commands"
+}
+
+func (Tool) Inputs() []agents.ToolInput { return []agents.ToolInput{{Name: "Command", Type: "string"}} }
+
+func (Tool) Output() string { return "OutputFile: []File" }
+
+func (Tool) Producer(deps agents.Deps) actor.Producer { return New(deps) }
+
+func (Tool) Start(d agents.Dispatch) any {
+	return messages.ExecuteCommand{RequestID: d.GoalID, TaskID: d.Task.ID, Command: d.Solution.Inputs[0], Reason: d.Solution.Reasoning, Task: d.Task.Task, Answers: d.Answers}
+}
@@ -1,42 +1,82 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/tmc/langchaingo/chains"
 	"go-autogpt/pkg/models"
 	"go-autogpt/pkg/prompts"
 	"go-autogpt/pkg/template"
+	"io"
 	"os"
-	"os/exec"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Handler struct {
-	chain chains.Chain
+	chain    chains.Chain
+	sandbox  Sandbox
+	sessions *Sessions // optional, commands run in the goal's shell when set
+	limits   Limits
 }
 
-func New(chain chains.Chain) *Handler {
+// Limits are how long a command can run for and how much of its output is kept, zero is unlimited
+type Limits struct {
+	Timeout   time.Duration
+	MaxOutput int // bytes kept of stdout and of stderr
+}
+
+// Until caps the timeout at the time left until the deadline
+func (l Limits) Until(deadline time.Time) Limits {
+	left := time.Until(deadline)
+	if left < 0 {
+		left = 0
+	}
+	if l.Timeout <= 0 || left < l.Timeout {
+		l.Timeout = left
+	}
+	return l
+}
+
+func New(chain chains.Chain, sandbox Sandbox, sessions *Sessions, limits Limits) *Handler {
 	return &Handler{
-		chain: chain,
+		chain:    chain,
+		sandbox:  sandbox,
+		sessions: sessions,
+		limits:   limits,
 	}
 }
 
 type input struct {
 	Task             string
 	PreviousAttempts string
+	Answers          string
 }
 
-func (h *Handler) RunCommand(ctx context.Context, command, id string) (string, error) {
-	output, err := executeCommand(command, id)
-	if err != nil {
-		return "", err
-	}
+// Lines is called with each line a command prints as it prints it, one line at a time
+type Lines func(stream, line string)
 
-	return output, nil
+// RunCommand runs the command in the goal's sandbox, the output is returned even when the command fails. The command
+// times out at ctx's deadline if it comes before the timeout. lines can be nil.
+func (h *Handler) RunCommand(ctx context.Context, command, id string, lines Lines) (models.CommandOutput, error) {
+	limits := h.limits
+	if deadline, ok := ctx.Deadline(); ok {
+		limits = limits.Until(deadline)
+	}
+	if h.sessions != nil {
+		return h.sessions.Run(ctx, id, command, limits, lines)
+	}
+	if h.sandbox == nil {
+		return models.CommandOutput{}, errors.New("no sandbox to run commands in is configured")
+	}
+	return executeCommand(ctx, h.sandbox, command, id, limits, lines)
 }
 
-func (h *Handler) DiagnoseNextAttempt(ctx context.Context, task, previousAttempts string) models.HandlerResult {
-	completion, err := chains.Call(ctx, h.chain, map[string]any{"Task": task, "PreviousAttempts": previousAttempts})
+func (h *Handler) DiagnoseNextAttempt(ctx context.Context, task, previousAttempts, answers string) models.HandlerResult {
+	completion, err := chains.Call(ctx, h.chain, map[string]any{"Task": task, "PreviousAttempts": previousAttempts, "Answers": answers})
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("call: %w", err)}
 	}
@@ -44,6 +84,7 @@ func (h *Handler) DiagnoseNextAttempt(ctx context.Context, task, previousAttempt
 	question, err := template.Parse(prompts.CommandDiagnoseTemplate, input{
 		Task:             task,
 		PreviousAttempts: previousAttempts,
+		Answers:          answers,
 	})
 	if err != nil {
 		return models.HandlerResult{Error: fmt.Errorf("execute: %w", err)}
@@ -52,16 +93,139 @@ func (h *Handler) DiagnoseNextAttempt(ctx context.Context, task, previousAttempt
 	return models.HandlerResult{Question: question, Answer: completion["text"].(string)}
 }
 
-func executeCommand(command, id string) (string, error) {
-	// Create the command with redirected standard input
-	cmd := exec.Command("bash", "-c", "cd sandbox/"+id+" && "+command)
+func executeCommand(ctx context.Context, sandbox Sandbox, command, id string, limits Limits, lines Lines) (models.CommandOutput, error) {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	// the command and anything it starts are killed together if ctx is done, stdin is /dev/null so a command that
+	// prompts for input reads EOF rather than hanging
+	cmd, release, err := sandbox.Command(ctx, "sandbox/"+id, command)
+	if err != nil {
+		return models.CommandOutput{}, fmt.Errorf("sandbox: %w", err)
+	}
+	defer release()
+	killProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	stdout, stderr := &cappedBuffer{max: limits.MaxOutput}, &cappedBuffer{max: limits.MaxOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	var stdoutLines, stderrLines *lineWriter
+	if lines != nil {
+		// stdout and stderr are copied by goroutines of their own
+		mu := &sync.Mutex{}
+		stdoutLines = &lineWriter{stream: models.Stdout, lines: lines, mu: mu}
+		stderrLines = &lineWriter{stream: models.Stderr, lines: lines, mu: mu}
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(stdout, stdoutLines), io.MultiWriter(stderr, stderrLines)
+	}
+
+	err = cmd.Run()
+	stdoutLines.flush()
+	stderrLines.flush()
+	output := models.CommandOutput{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.dropped > 0 || stderr.dropped > 0,
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("timed out after %s and was killed", limits.Timeout)
+	}
+	if err != nil {
+		return output, fmt.Errorf("process state=[%s], error=[%w]", cmd.ProcessState.String(), err)
+	}
+
+	return output, nil
+}
+
+// waitDelay is how long to wait for the output of a killed command to close, in case something outside its process
+// group still holds it open
+const waitDelay = 5 * time.Second
 
-	output, err := cmd.CombinedOutput()
-	if err != nil || cmd.ProcessState.ExitCode() != 0 {
-		return "", fmt.Errorf("output=[%s], process state=[%s], error=[%w]", output, cmd.ProcessState.String(), err)
+// cappedBuffer keeps the first max bytes written to it and counts the rest, writes never fail so the command isn't
+// stopped by a broken pipe
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.max > 0 && b.buf.Len()+len(p) > b.max {
+		keep := b.max - b.buf.Len()
+		b.dropped += len(p) - keep
+		p = p[:keep]
 	}
+	b.buf.Write(p)
+	return n, nil
+}
 
-	return string(output), nil
+// StreamLines calls lines with each line of output that has already been printed, stdout then stderr
+func StreamLines(output models.CommandOutput, lines Lines) {
+	stdout := &lineWriter{stream: models.Stdout, lines: lines}
+	_, _ = io.WriteString(stdout, output.Stdout)
+	stdout.flush()
+	stderr := &lineWriter{stream: models.Stderr, lines: lines}
+	_, _ = io.WriteString(stderr, output.Stderr)
+	stderr.flush()
+}
+
+// maxLine is the longest line streamed, longer lines are split
+const maxLine = 4096
+
+// lineWriter calls lines with each line written to it, without its newline
+type lineWriter struct {
+	stream string
+	lines  Lines
+	mu     *sync.Mutex // shared by the writers of a command, optional
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w == nil {
+		return len(p), nil
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		switch {
+		case i >= 0:
+			w.call(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+			w.buf = w.buf[i+1:]
+		case len(w.buf) >= maxLine:
+			w.call(string(w.buf[:maxLine]))
+			w.buf = w.buf[maxLine:]
+		default:
+			w.buf = append([]byte(nil), w.buf...)
+			return len(p), nil
+		}
+	}
+}
+
+// flush calls lines with the last line if it didn't end with a newline
+func (w *lineWriter) flush() {
+	if w == nil || len(w.buf) == 0 {
+		return
+	}
+	w.call(string(w.buf))
+	w.buf = nil
+}
+
+func (w *lineWriter) call(line string) {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+	w.lines(w.stream, line)
+}
+
+// String is what was kept, marked with how much was dropped
+func (b *cappedBuffer) String() string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n[truncated %d bytes]", b.buf.String(), b.dropped)
 }
 
 func (h *Handler) CreateDirectoryIfNotExists(id string) error {
@@ -1,14 +1,151 @@
 package handler
 
 import (
-	"fmt"
+	"context"
+	"go-autogpt/pkg/models"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-func Test_executeCommand(t *testing.T) {
-	s, err := executeCommand("apt-get install python -y", "test")
+// inSandbox runs the test from a temporary directory with a sandbox for the goal id
+func inSandbox(t *testing.T, id string) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(dir+"/sandbox/"+id, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func Test_executeCommand_limits(t *testing.T) {
+	inSandbox(t, "limits")
+	tests := []struct {
+		name      string
+		command   string
+		limits    Limits
+		stdout    string
+		stderr    string
+		truncated bool
+		err       string
+	}{
+		{
+			name:    "runs in the goal's sandbox",
+			command: "basename $PWD",
+			stdout:  "limits\n",
+		},
+		{
+			name:    "captures stdout and stderr separately",
+			command: "echo out && echo err >&2",
+			stdout:  "out\n",
+			stderr:  "err\n",
+		},
+		{
+			name:    "keeps the output of a failed command",
+			command: "echo out && echo err >&2 && exit 3",
+			stdout:  "out\n",
+			stderr:  "err\n",
+			err:     "exit status 3",
+		},
+		{
+			name:      "caps the output and marks what was dropped",
+			command:   "yes | head -c 100",
+			limits:    Limits{MaxOutput: 10},
+			stdout:    "y\ny\ny\ny\ny\n\n[truncated 90 bytes]",
+			truncated: true,
+		},
+		{
+			name:    "closes stdin",
+			command: "read line; echo read $?",
+			stdout:  "read 1\n",
+		},
+		{
+			name:    "kills the command and anything it started when it times out",
+			command: "echo started && sleep 30 & sleep 30",
+			limits:  Limits{Timeout: 100 * time.Millisecond},
+			stdout:  "started\n",
+			err:     "timed out after 100ms",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			out, err := executeCommand(context.Background(), UnsafeLocal{}, tt.command, "limits", tt.limits, nil)
+			if time.Since(start) > 3*time.Second {
+				t.Errorf("executeCommand() took %s", time.Since(start))
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("executeCommand() error = %v, want %q", err, tt.err)
+			}
+			if out.Stdout != tt.stdout || out.Stderr != tt.stderr || out.Truncated != tt.truncated {
+				t.Errorf("executeCommand() = %+v, want stdout %q, stderr %q, truncated %v", out, tt.stdout, tt.stderr, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestLimits_Until(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		limits   Limits
+		deadline time.Time
+		min, max time.Duration
+	}{
+		{name: "keeps a timeout before the deadline", limits: Limits{Timeout: time.Minute}, deadline: deadline, min: time.Minute, max: time.Minute},
+		{name: "caps a timeout after the deadline", limits: Limits{Timeout: 2 * time.Hour}, deadline: deadline, min: 59 * time.Minute, max: time.Hour},
+		{name: "limits an unlimited timeout", limits: Limits{}, deadline: deadline, min: 59 * time.Minute, max: time.Hour},
+		{name: "times out straight away past the deadline", limits: Limits{Timeout: time.Minute}, deadline: time.Now().Add(-time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.Until(tt.deadline); got.Timeout < tt.min || got.Timeout > tt.max {
+				t.Errorf("Until() = %s, want between %s and %s", got.Timeout, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func Test_executeCommand_cancel(t *testing.T) {
+	inSandbox(t, "cancel")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := executeCommand(ctx, UnsafeLocal{}, "sleep 30 | sleep 30", "cancel", Limits{}, nil)
+	if err == nil {
+		t.Fatal("executeCommand() error = nil, want the command killed")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("executeCommand() took %s after it was cancelled", time.Since(start))
+	}
+}
+
+func Test_executeCommand_lines(t *testing.T) {
+	inSandbox(t, "lines")
+	var mu sync.Mutex
+	var got []models.OutputLine
+	lines := func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, models.OutputLine{Stream: stream, Line: line})
+	}
+
+	_, err := executeCommand(context.Background(), UnsafeLocal{}, "echo a; sleep 0.1; echo b >&2; sleep 0.1; printf c", "lines", Limits{}, lines)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	want := []models.OutputLine{{Stream: models.Stdout, Line: "a"}, {Stream: models.Stderr, Line: "b"}, {Stream: models.Stdout, Line: "c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("executeCommand() streamed %v, want %v", got, want)
 	}
-	fmt.Println(s)
 }
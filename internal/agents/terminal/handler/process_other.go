@@ -0,0 +1,18 @@
+//go:build !unix
+
+package handler
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// killProcessGroup leaves the command to be killed on its own, process groups are only supported on unix
+func killProcessGroup(cmd *exec.Cmd) {}
+
+func startShell(cmd *exec.Cmd) (*os.File, error) {
+	return nil, errors.New("shell sessions are only supported on unix")
+}
+
+func killShell(cmd *exec.Cmd) {}
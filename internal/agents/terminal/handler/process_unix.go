@@ -0,0 +1,38 @@
+//go:build unix
+
+package handler
+
+import (
+	"github.com/creack/pty"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup runs the command in a process group of its own, so when it's cancelled everything it started is
+// killed with it rather than only the shell
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// startShell starts the command on a new pty as the leader of its own session, so it can be killed as a process group
+func startShell(cmd *exec.Cmd) (*os.File, error) {
+	attrs := cmd.SysProcAttr
+	if attrs == nil {
+		attrs = &syscall.SysProcAttr{}
+	}
+	attrs.Setsid = true
+	attrs.Setctty = true
+	return pty.StartWithAttrs(cmd, nil, attrs)
+}
+
+// killShell kills a shell started with startShell and everything it started
+func killShell(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
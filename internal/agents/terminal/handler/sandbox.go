@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+const (
+	LinuxBackend       = "linux"        // namespaces, a chroot of the goal directory and cgroup v2 limits
+	UnsafeLocalBackend = "unsafe-local" // bash on the machine itself, only use it in a container or vm
+)
+
+// Sandbox is where the terminal's commands run, isolated from the rest of the machine as much as the backend allows
+type Sandbox interface {
+	// Command returns the command to run in the goal directory dir, release is called once it has exited
+	Command(ctx context.Context, dir, command string) (cmd *exec.Cmd, release func(), err error)
+}
+
+// SandboxConfig picks the backend commands run in and how they are limited, limits of zero are unlimited
+type SandboxConfig struct {
+	Backend      string  `json:"backend"`
+	Network      bool    `json:"network"` // commands of the linux backend have no network unless it's set
+	CPUs         float64 `json:"cpus"`
+	MemoryBytes  int64   `json:"memoryBytes"`
+	MaxProcesses int     `json:"maxProcesses"`
+	// Cgroup is the cgroup v2 directory each command gets a cgroup in, it has to be delegated to the user running
+	// the api when limits are set
+	Cgroup string `json:"cgroup"`
+}
+
+func (c SandboxConfig) Validate() error {
+	switch c.Backend {
+	case LinuxBackend, UnsafeLocalBackend:
+	default:
+		return fmt.Errorf("unknown backend %q, use %q or %q", c.Backend, LinuxBackend, UnsafeLocalBackend)
+	}
+	if c.CPUs < 0 || c.MemoryBytes < 0 || c.MaxProcesses < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	return nil
+}
+
+// limited reports whether the commands need a cgroup
+func (c SandboxConfig) limited() bool {
+	return c.CPUs > 0 || c.MemoryBytes > 0 || c.MaxProcesses > 0
+}
+
+// NewSandbox returns the backend of the config, the linux backend is only supported on linux
+func NewSandbox(config SandboxConfig) (Sandbox, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Backend == UnsafeLocalBackend {
+		return UnsafeLocal{}, nil
+	}
+	return newLinux(config)
+}
+
+// UnsafeLocal runs commands with bash on the machine itself, they can read and write anything the api can
+type UnsafeLocal struct{}
+
+func (UnsafeLocal) Command(ctx context.Context, dir, command string) (*exec.Cmd, func(), error) {
+	return exec.CommandContext(ctx, "bash", "-c", "cd "+dir+" && "+command), func() {}, nil
+}
@@ -0,0 +1,186 @@
+//go:build linux
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// linuxSetup runs as pid 1 of the command's namespaces, it builds a root filesystem on an empty directory ($1) from
+// read-only binds of the system directories and a bind of the goal directory ($2) at /sandbox, then runs the
+// command ($3) chrooted into it. The mounts are only visible inside the namespace.
+const linuxSetup = `set -e
+root=$1
+mount --make-rprivate /
+mount -t tmpfs -o mode=755 sandbox "$root"
+for d in /bin /sbin /lib /lib32 /lib64 /libx32 /usr /etc /opt; do
+	if [ -L "$d" ]; then
+		ln -s "$(readlink "$d")" "$root$d"
+	elif [ -d "$d" ]; then
+		mkdir -p "$root$d"
+		mount --rbind "$d" "$root$d"
+		mount -o remount,bind,ro,nosuid,nodev "$root$d"
+	fi
+done
+mkdir -p "$root/sandbox" "$root/proc" "$root/dev" "$root/tmp"
+mount --bind "$2" "$root/sandbox"
+mount -t proc proc "$root/proc"
+mount -t tmpfs -o mode=1777 tmp "$root/tmp"
+for f in null zero full random urandom; do
+	touch "$root/dev/$f"
+	mount --bind "/dev/$f" "$root/dev/$f"
+done
+exec chroot "$root" /bin/bash -c "cd /sandbox && $3"
+`
+
+// env of the commands, nothing of the api's environment like its api keys is passed on
+var env = []string{
+	"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	"HOME=/sandbox",
+	"LANG=C.UTF-8",
+}
+
+// Linux runs each command in new user, mount, pid, ipc, uts and network namespaces, chrooted into the goal directory
+// with read-only system directories, and in a cgroup of its own when the config has limits
+type Linux struct {
+	config SandboxConfig
+	root   string // empty directory each command's root filesystem is mounted on
+	cgroup string // the cgroup of each command is made in, empty without limits
+	next   atomic.Int64
+}
+
+func newLinux(config SandboxConfig) (Sandbox, error) {
+	root := filepath.Join(os.TempDir(), "go-autogpt-root")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("root: %w", err)
+	}
+	l := &Linux{config: config, root: root}
+	if err := l.check(); err != nil {
+		return nil, fmt.Errorf("unable to run commands in namespaces on this machine: %w", err)
+	}
+	if !config.limited() {
+		return l, nil
+	}
+
+	l.cgroup = config.Cgroup
+	if l.cgroup == "" {
+		l.cgroup = "/sys/fs/cgroup/go-autogpt"
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(l.cgroup), "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is needed for limits: %w", err)
+	}
+	if err := os.MkdirAll(l.cgroup, 0o755); err != nil {
+		return nil, fmt.Errorf("cgroup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(l.cgroup, "cgroup.subtree_control"), []byte("+cpu +memory +pids"), 0o644); err != nil {
+		return nil, fmt.Errorf("enable cgroup controllers, they have to be delegated to %s: %w", filepath.Dir(l.cgroup), err)
+	}
+	return l, nil
+}
+
+func (l *Linux) Command(ctx context.Context, dir, command string) (*exec.Cmd, func(), error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", linuxSetup, "sandbox", l.root, dir, command)
+	cmd.Env = env
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !l.config.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: uintptr(flags),
+		// root of the namespace is the user running the api, so it can mount and chroot but nothing more
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if l.cgroup == "" {
+		return cmd, func() {}, nil
+	}
+
+	cgroup, fd, err := l.newCgroup()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cgroup: %w", err)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return cmd, func() {
+		_ = syscall.Close(fd)
+		removeCgroup(cgroup)
+	}, nil
+}
+
+// newCgroup makes a cgroup with the config's limits for a command, the command is started in it with the returned fd
+func (l *Linux) newCgroup() (string, int, error) {
+	path := filepath.Join(l.cgroup, fmt.Sprintf("command-%d-%d", os.Getpid(), l.next.Add(1)))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return "", 0, err
+	}
+
+	limits := map[string]string{}
+	if l.config.CPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", int(l.config.CPUs*100000))
+	}
+	if l.config.MemoryBytes > 0 {
+		limits["memory.max"] = strconv.FormatInt(l.config.MemoryBytes, 10)
+		limits["memory.swap.max"] = "0"
+	}
+	if l.config.MaxProcesses > 0 {
+		limits["pids.max"] = strconv.Itoa(l.config.MaxProcesses)
+	}
+	for file, limit := range limits {
+		err := os.WriteFile(filepath.Join(path, file), []byte(limit), 0o644)
+		if err != nil && !(file == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			removeCgroup(path)
+			return "", 0, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		removeCgroup(path)
+		return "", 0, err
+	}
+	return path, fd, nil
+}
+
+// removeCgroup kills anything left in the cgroup and removes it, a cgroup can only be removed once it's empty
+func removeCgroup(path string) {
+	_ = os.WriteFile(filepath.Join(path, "cgroup.kill"), []byte("1"), 0o644)
+	for i := 0; i < 50; i++ {
+		err := syscall.Rmdir(path)
+		if err == nil || !errors.Is(err, syscall.EBUSY) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// check runs a command that does nothing, user namespaces are often turned off or blocked inside containers
+func (l *Linux) check() error {
+	dir, err := os.MkdirTemp("", "go-autogpt-check")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	cmd, _, err := l.Command(context.Background(), dir, "true")
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build linux
+
+package handler
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newLinuxSandbox skips the test when the machine can't run commands in namespaces
+func newLinuxSandbox(t *testing.T, config SandboxConfig) Sandbox {
+	config.Backend = LinuxBackend
+	sandbox, err := NewSandbox(config)
+	if err != nil {
+		t.Skipf("linux backend isn't supported: %v", err)
+	}
+	return sandbox
+}
+
+func TestLinux(t *testing.T) {
+	inSandbox(t, "linux")
+	sandbox := newLinuxSandbox(t, SandboxConfig{})
+	wd, _ := os.Getwd()
+	if err := os.WriteFile("sandbox/linux/input.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		command string
+		stdout  string
+		err     string
+	}{
+		{
+			name:    "runs in the goal directory",
+			command: "pwd && cat input.txt && echo world > output.txt",
+			stdout:  "/sandbox\nhello",
+		},
+		{
+			name:    "is the first process of its own pid namespace",
+			command: "echo $$",
+			stdout:  "1\n",
+		},
+		{
+			name:    "can't see the rest of the machine",
+			command: "ls " + wd,
+			err:     "exit status 2",
+		},
+		{
+			name:    "can't write to the system directories",
+			command: "touch /usr/sandboxed",
+			err:     "exit status 1",
+		},
+		{
+			name:    "has no network",
+			command: "echo > /dev/tcp/127.0.0.1/80",
+			err:     "exit status 1",
+		},
+		{
+			name:    "doesn't pass on the environment",
+			command: "echo ${OPENAI_API_KEY:-none}",
+			stdout:  "none\n",
+		},
+	}
+	t.Setenv("OPENAI_API_KEY", "secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeCommand(context.Background(), sandbox, tt.command, "linux", Limits{Timeout: 10 * time.Second}, nil)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("executeCommand() error = %v, want %q, stderr %q", err, tt.err, out.Stderr)
+			}
+			if out.Stdout != tt.stdout && tt.err == "" {
+				t.Errorf("executeCommand() stdout = %q, want %q", out.Stdout, tt.stdout)
+			}
+		})
+	}
+
+	b, err := os.ReadFile("sandbox/linux/output.txt")
+	if err != nil || string(b) != "world\n" {
+		t.Errorf("output.txt = %q, %v, want the command's output in the goal directory", b, err)
+	}
+}
+
+func TestLinux_limits(t *testing.T) {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		t.Skip("cgroup v2 isn't mounted")
+	}
+	inSandbox(t, "limits")
+	sandbox := newLinuxSandbox(t, SandboxConfig{MaxProcesses: 8, Cgroup: "/sys/fs/cgroup/go-autogpt-test"})
+	t.Cleanup(func() { _ = syscall.Rmdir("/sys/fs/cgroup/go-autogpt-test") })
+
+	out, err := executeCommand(context.Background(), sandbox, "for i in $(seq 16); do sleep 1 & done; wait", "limits", Limits{Timeout: 10 * time.Second}, nil)
+	if err == nil && !strings.Contains(out.Stderr, "fork") {
+		t.Errorf("executeCommand() = %+v, want it to run out of processes", out)
+	}
+}
+
+func TestLinux_session(t *testing.T) {
+	inSandbox(t, "session")
+	sessions := NewSessions(newLinuxSandbox(t, SandboxConfig{}))
+	t.Cleanup(func() { sessions.Reset("session") })
+
+	if _, err := sessions.Run(context.Background(), "session", "mkdir -p tmp && cd tmp && export GREETING=hello", Limits{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := sessions.Run(context.Background(), "session", "echo $GREETING from $PWD, pid $$", Limits{}, nil)
+	if err != nil || out.Stdout != "hello from /sandbox/tmp, pid 1\n" {
+		t.Errorf("Run() = %+v, %v, want the shell to carry on in the sandbox", out, err)
+	}
+}
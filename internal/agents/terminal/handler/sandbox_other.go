@@ -0,0 +1,11 @@
+//go:build !linux
+
+package handler
+
+import (
+	"errors"
+)
+
+func newLinux(config SandboxConfig) (Sandbox, error) {
+	return nil, errors.New("the linux backend is only supported on linux, use a container or the unsafe-local backend")
+}
@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-autogpt/pkg/models"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sessions are the long-lived shells of goals. The commands of a goal run one at a time in its shell, so environment
+// variables, the working directory, activated virtualenvs and background processes carry over between commands and
+// tasks.
+type Sessions struct {
+	mu       sync.Mutex
+	sandbox  Sandbox
+	sessions map[string]*session
+}
+
+func NewSessions(sandbox Sandbox) *Sessions {
+	return &Sessions{
+		sandbox:  sandbox,
+		sessions: map[string]*session{},
+	}
+}
+
+// Run runs the command in the goal's shell, starting one if the goal hasn't got one. A command that times out or is
+// cancelled resets the shell, there's no telling what state it was left in.
+func (s *Sessions) Run(ctx context.Context, id, command string, limits Limits, lines Lines) (models.CommandOutput, error) {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	sess, err := s.session(id)
+	if err != nil {
+		return models.CommandOutput{}, fmt.Errorf("start shell: %w", err)
+	}
+	output, err := sess.run(ctx, command, limits.MaxOutput, lines)
+	if ctx.Err() != nil {
+		s.drop(id, sess)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return output, fmt.Errorf("timed out after %s and was killed, the shell was reset", limits.Timeout)
+		}
+		return output, fmt.Errorf("cancelled, the shell was reset: %w", ctx.Err())
+	}
+	return output, err
+}
+
+// Reset kills the goal's shell and everything it started, the goal's next command starts a new one
+func (s *Sessions) Reset(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	sess := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if sess != nil {
+		sess.close()
+	}
+}
+
+func (s *Sessions) session(id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok && !sess.closed() {
+		return sess, nil
+	}
+	sess, err := startSession(s.sandbox, "sandbox/"+id)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[id] = sess
+	return sess, nil
+}
+
+// drop closes the session unless the goal has already moved on to another one
+func (s *Sessions) drop(id string, sess *session) {
+	s.mu.Lock()
+	if s.sessions[id] == sess {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+	sess.close()
+}
+
+// session is a bash shell on a pty. Each command is followed by markers only the session knows, so its output can be
+// told apart from the next command's and its exit status read back.
+type session struct {
+	cmd       *exec.Cmd
+	pty       *os.File
+	stderr    *os.File // read end of the pipe of the commands' stderr
+	release   func()
+	marker    string
+	errFD     int           // of the shell, the commands' stderr is redirected to it
+	output    chan []byte   // read from the pty, closed once the shell has exited
+	errOutput chan []byte   // read from the stderr pipe, closed once the shell has exited
+	turn      chan struct{} // held by the command running in the shell
+	done      chan struct{} // closed once the session is closed
+	closeOnce sync.Once
+}
+
+// sessionSetup quiets the shell so only what the commands print comes back: no echo, prompts or job notices, newlines
+// aren't translated and lines can be longer than the terminal's line buffer.
+const sessionSetup = "stty -echo -onlcr -icanon; PS1= PS2= PROMPT_COMMAND=; set +m; unset HISTFILE\n"
+
+// startTimeout is how long a new shell has to come up
+const startTimeout = 10 * time.Second
+
+func startSession(sandbox Sandbox, dir string) (*session, error) {
+	cmd, release, err := sandbox.Command(context.Background(), dir, "exec bash --noprofile --norc --noediting")
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(append([]string{}, cmd.Env...), "TERM=dumb")
+	// a pty has a single output, so the commands' stderr is passed on a pipe of its own
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	errFD := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, errWriter)
+	pty, err := startShell(cmd)
+	_ = errWriter.Close() // held by the shell
+	if err != nil {
+		_ = errReader.Close()
+		release()
+		return nil, err
+	}
+
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	sess := &session{
+		cmd:       cmd,
+		pty:       pty,
+		stderr:    errReader,
+		release:   release,
+		marker:    "__GOAUTOGPT_" + hex.EncodeToString(nonce),
+		errFD:     errFD,
+		output:    make(chan []byte),
+		errOutput: make(chan []byte),
+		turn:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	go sess.read(pty, sess.output)
+	go sess.read(errReader, sess.errOutput)
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	if _, err := io.WriteString(pty, sessionSetup); err != nil {
+		sess.close()
+		return nil, err
+	}
+	// anything the shell printed while it was set up comes back as the output of the first command
+	if _, err := sess.run(ctx, "true", 0, nil); err != nil {
+		sess.close()
+		return nil, fmt.Errorf("set up shell: %w", err)
+	}
+	return sess, nil
+}
+
+// run writes the command to the shell followed by the markers, and reads back its output until the end markers of
+// both stdout and stderr
+func (s *session) run(ctx context.Context, command string, maxOutput int, lines Lines) (models.CommandOutput, error) {
+	select {
+	case s.turn <- struct{}{}:
+	case <-s.done:
+		return models.CommandOutput{}, errors.New("the shell was reset")
+	case <-ctx.Done():
+		return models.CommandOutput{}, ctx.Err()
+	}
+	defer func() { <-s.turn }()
+
+	// the markers are printed in two parts so the command written to the shell never contains them whole
+	half := len(s.marker) / 2
+	split := quote(s.marker[:half]) + " " + quote(s.marker[half:])
+	script := fmt.Sprintf("eval %s </dev/null 2>&%d; __status=$?; printf '\\n%%s%%s_ERR\\n' %s >&%d; printf '\\n%%s%%s_END %%d\\n' %s \"$__status\"\n",
+		quote(command), s.errFD, split, s.errFD, split)
+	if _, err := io.WriteString(s.pty, script); err != nil {
+		return models.CommandOutput{}, fmt.Errorf("write to shell: %w", err)
+	}
+
+	f := newFramer(s.marker, maxOutput, lines)
+	for {
+		var status int
+		var done bool
+		select {
+		case p, ok := <-s.output:
+			if !ok {
+				s.close()
+				return f.result(), errors.New("the shell exited")
+			}
+			status, done = f.writeStdout(p)
+		case p, ok := <-s.errOutput:
+			if !ok {
+				s.close()
+				return f.result(), errors.New("the shell exited")
+			}
+			status, done = f.writeStderr(p)
+		case <-s.done:
+			return f.result(), errors.New("the shell was reset")
+		case <-ctx.Done():
+			return f.result(), ctx.Err()
+		}
+		if done {
+			if status != 0 {
+				return f.result(), fmt.Errorf("exit status %d", status)
+			}
+			return f.result(), nil
+		}
+	}
+}
+
+// read sends what's read from r to output until r is closed
+func (s *session) read(r io.Reader, output chan<- []byte) {
+	defer close(output)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case output <- append([]byte(nil), buf[:n]...):
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close kills the shell and everything it started
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		killShell(s.cmd)
+		_ = s.pty.Close()
+		_ = s.stderr.Close()
+		_ = s.cmd.Wait()
+		s.release()
+	})
+}
+
+// quote makes s a single bash word
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// framer splits what the shell prints into a command's stdout and stderr, and finds its exit status. Both are
+// streamed as they're printed.
+type framer struct {
+	stdout *framed
+	stderr *framed
+	status int
+	exited bool // once the exit status has been read
+}
+
+func newFramer(marker string, maxOutput int, lines Lines) *framer {
+	f := &framer{
+		stdout: &framed{buf: &cappedBuffer{max: maxOutput}, marker: []byte("\n" + marker + "_END ")}, // followed by the exit status
+		stderr: &framed{buf: &cappedBuffer{max: maxOutput}, marker: []byte("\n" + marker + "_ERR\n")},
+	}
+	if lines != nil {
+		// both are written to by the goroutine running the command, they don't need a mutex
+		f.stdout.lines = &lineWriter{stream: models.Stdout, lines: lines}
+		f.stderr.lines = &lineWriter{stream: models.Stderr, lines: lines}
+	}
+	return f
+}
+
+// writeStdout adds what the shell printed on the pty, it returns the exit status once the command's output is complete
+func (f *framer) writeStdout(p []byte) (int, bool) {
+	if f.stdout.write(p) && !f.exited {
+		status, _, ok := bytes.Cut(f.stdout.pending, []byte("\n"))
+		if ok {
+			f.status, _ = strconv.Atoi(string(status))
+			f.exited = true
+		}
+	}
+	return f.complete()
+}
+
+// writeStderr adds what the command printed on the stderr pipe, it returns the exit status once the command's output
+// is complete
+func (f *framer) writeStderr(p []byte) (int, bool) {
+	f.stderr.write(p)
+	return f.complete()
+}
+
+func (f *framer) complete() (int, bool) {
+	if !f.exited || !f.stderr.ended {
+		return 0, false
+	}
+	f.stdout.lines.flush()
+	f.stderr.lines.flush()
+	return f.status, true
+}
+
+func (f *framer) result() models.CommandOutput {
+	return models.CommandOutput{
+		Stdout:    f.stdout.buf.String(),
+		Stderr:    f.stderr.buf.String(),
+		Truncated: f.stdout.buf.dropped > 0 || f.stderr.buf.dropped > 0,
+	}
+}
+
+// framed is an output of the shell up to a marker. The marker starts with a newline, so the newline ending a line is
+// held back until it's known not to be the marker's, the line is streamed without waiting for it.
+type framed struct {
+	buf     *cappedBuffer
+	lines   *lineWriter // optional
+	marker  []byte
+	pending []byte // could be the start of the marker, or follows it once it has been found
+	ended   bool
+	early   bool // the line before the pending newline has been streamed
+}
+
+// write moves p to the output unless it's past the marker, it returns whether the marker has been found
+func (o *framed) write(p []byte) bool {
+	o.pending = append(o.pending, p...)
+	if o.ended {
+		return true
+	}
+	i := bytes.Index(o.pending, o.marker)
+	if i >= 0 {
+		o.emit(o.pending[:i])
+		o.pending = o.pending[i+len(o.marker):]
+		o.ended = true
+		return true
+	}
+
+	// keep the end that could be the start of the marker
+	if n := len(o.pending) - partial(o.pending, o.marker); n > 0 {
+		o.emit(o.pending[:n])
+		o.pending = append([]byte(nil), o.pending[n:]...)
+	}
+	if o.lines != nil && len(o.lines.buf) > 0 && len(o.pending) > 0 && o.pending[0] == '\n' {
+		o.lines.flush()
+		o.early = true
+	}
+	return false
+}
+
+func (o *framed) emit(p []byte) {
+	_, _ = o.buf.Write(p)
+	if o.early && len(p) > 0 {
+		p = p[1:] // the newline ending the line that was streamed early
+		o.early = false
+	}
+	_, _ = o.lines.Write(p)
+}
+
+// partial is the length of the longest end of p that is the start of marker
+func partial(p, marker []byte) int {
+	n := len(marker) - 1
+	if len(p) < n {
+		n = len(p)
+	}
+	for ; n > 0; n-- {
+		if bytes.HasPrefix(marker, p[len(p)-n:]) {
+			return n
+		}
+	}
+	return 0
+}
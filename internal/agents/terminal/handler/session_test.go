@@ -0,0 +1,165 @@
+//go:build unix
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"go-autogpt/pkg/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions_Run(t *testing.T) {
+	inSandbox(t, "session")
+	sessions := NewSessions(UnsafeLocal{})
+	t.Cleanup(func() { sessions.Reset("session") })
+
+	steps := []struct {
+		name      string
+		command   string
+		reset     bool // the shell before the command
+		limits    Limits
+		stdout    string
+		stderr    string
+		truncated bool
+		err       string
+	}{
+		{
+			name:    "keeps the environment and working directory between commands",
+			command: "export GREETING=hello && mkdir -p tmp && cd tmp",
+		},
+		{
+			name:    "",
+			command: "echo $GREETING from $(basename $PWD)",
+			stdout:  "hello from tmp\n",
+		},
+		{
+			name:    "captures stderr and the exit status",
+			command: "echo out; echo err >&2; false",
+			stdout:  "out\n",
+			stderr:  "err\n",
+			err:     "exit status 1",
+		},
+		{
+			name:    "runs commands that span lines and quotes",
+			command: "printf '%s\\n' \"it's\" \\\n  'multi-line'",
+			stdout:  "it's\nmulti-line\n",
+		},
+		{
+			name:    "runs commands longer than the terminal's line buffer",
+			command: "echo " + strings.Repeat("a", 8000) + " | wc -c",
+			stdout:  "8001\n",
+		},
+		{
+			name:    "closes stdin",
+			command: "read line; echo read $?",
+			stdout:  "read 1\n",
+		},
+		{
+			name:      "caps the output",
+			command:   "yes | head -c 100",
+			limits:    Limits{MaxOutput: 10},
+			stdout:    "y\ny\ny\ny\ny\n\n[truncated 90 bytes]",
+			truncated: true,
+		},
+		{
+			name:    "kills the command and resets the shell when it times out",
+			command: "sleep 30",
+			limits:  Limits{Timeout: 100 * time.Millisecond},
+			err:     "timed out after 100ms and was killed, the shell was reset",
+		},
+		{
+			name:    "starts a new shell after a reset",
+			command: "echo ${GREETING:-gone} from $(basename $PWD)",
+			stdout:  "gone from session\n",
+		},
+		{
+			name:    "starts a new shell after it exits",
+			command: "exit 3 2>/dev/null", // the shell's exit notice could race it exiting
+			err:     "the shell exited",
+		},
+		{
+			name:    "",
+			command: "echo back",
+			stdout:  "back\n",
+		},
+		{
+			name:    "resets the shell when asked to",
+			command: "export GREETING=hello",
+		},
+		{
+			name:    "",
+			reset:   true,
+			command: "echo ${GREETING:-gone}",
+			stdout:  "gone\n",
+		},
+	}
+	for i, step := range steps {
+		if step.reset {
+			sessions.Reset("session")
+		}
+		start := time.Now()
+		out, err := sessions.Run(context.Background(), "session", step.command, step.limits, nil)
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("step %d %s: took %s", i, step.name, time.Since(start))
+		}
+		if step.err == "" && err != nil || step.err != "" && (err == nil || !strings.Contains(err.Error(), step.err)) {
+			t.Fatalf("step %d %s: Run() error = %v, want %q", i, step.name, err, step.err)
+		}
+		if out.Stdout != step.stdout || out.Stderr != step.stderr || out.Truncated != step.truncated {
+			t.Errorf("step %d %s: Run() = %+v, want stdout %q, stderr %q, truncated %v", i, step.name, out, step.stdout, step.stderr, step.truncated)
+		}
+	}
+}
+
+func TestSessions_Run_concurrently(t *testing.T) {
+	inSandbox(t, "concurrent")
+	sessions := NewSessions(UnsafeLocal{})
+	t.Cleanup(func() { sessions.Reset("concurrent") })
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			want := strings.Repeat("x", i*1000) + "\n"
+			out, err := sessions.Run(context.Background(), "concurrent", "echo "+want, Limits{}, nil)
+			if err == nil && out.Stdout != want {
+				err = errors.New("output of another command: " + out.Stdout[:10])
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessions_Run_lines(t *testing.T) {
+	inSandbox(t, "lines")
+	sessions := NewSessions(UnsafeLocal{})
+	t.Cleanup(func() { sessions.Reset("lines") })
+
+	var got []models.OutputLine
+	streamed := map[string]time.Time{}
+	lines := func(stream, line string) {
+		got = append(got, models.OutputLine{Stream: stream, Line: line})
+		streamed[line] = time.Now()
+	}
+	// stdout and stderr are read apart, the sleeps keep their lines in order
+	if _, err := sessions.Run(context.Background(), "lines", "echo a; sleep 0.2; echo b >&2; sleep 1; printf c", Limits{}, lines); err != nil {
+		t.Fatal(err)
+	}
+	exited := time.Now()
+	// the line without a newline at the end is streamed once the command has exited
+	want := []models.OutputLine{{Stream: models.Stdout, Line: "a"}, {Stream: models.Stderr, Line: "b"}, {Stream: models.Stdout, Line: "c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() streamed %v, want %v", got, want)
+	}
+	if exited.Sub(streamed["b"]) < 500*time.Millisecond {
+		t.Errorf("Run() streamed stderr %s before the command exited, want it streamed as it was printed", exited.Sub(streamed["b"]))
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 type Diagnose struct {
-	Command string `json:"command"`
-	Reason  string `json:"reason"`
+	Command  string `json:"command"`
+	Question string `json:"question,omitempty"` // for the user, when the command depends on something only they know
+	Reason   string `json:"reason"`
 }
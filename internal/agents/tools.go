@@ -0,0 +1,139 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/tools"
+	"strings"
+	"sync"
+)
+
+// Tool is what the supervisor can hand a task to. Each tool is described to the LLM in the task prompt, and a new
+// actor of the tool is spawned for each task the LLM picks it for. The actor sends its result to its parent, as a
+// messages.Result such as messages.ToolResult, or a messages.ReportError, and then stops.
+type Tool interface {
+	Name() string        // the LLM picks the tool by, e.g. TERMINAL
+	Description() string // of what the tool does
+	Preference() string  // how the LLM should use the tool
+	Inputs() []ToolInput // the LLM gives the tool, in order
+	Output() string      // of the tool as the LLM is told it, e.g. Summary: string
+	Producer(deps Deps) actor.Producer
+	Start(dispatch Dispatch) any // the message the tool's actor is sent to work on the task
+}
+
+// ToolInput is an input of a tool's schema
+type ToolInput struct {
+	Name string
+	Type string
+}
+
+// Dispatch is a task handed to a tool with the solution the LLM chose
+type Dispatch struct {
+	GoalID   uuid.UUID
+	Task     models.Task
+	Solution models.Solution // its inputs match the tool's
+	Answers  []models.Question
+}
+
+var ErrToolExists = errors.New("a tool with the same name is registered")
+
+// AskUser is the tool the LLM asks the user a question about a task with. Every registry has it, it has no actor as
+// the supervisor asks the question and thinks about the task again with the answer.
+var AskUser Tool = askUser{}
+
+type askUser struct{}
+
+func (askUser) Name() string { return tools.AskUser }
+
+func (askUser) Description() string { return "asks the user a question and waits for their answer" }
+
+func (askUser) Preference() string {
+	return "only when the task is too ambiguous to solve without the user, never ask a question that has been answered"
+}
+
+func (askUser) Inputs() []ToolInput { return []ToolInput{{Name: "Question", Type: "string"}} }
+
+func (askUser) Output() string { return "Answer: string" }
+
+func (askUser) Producer(Deps) actor.Producer { return nil }
+
+func (askUser) Start(Dispatch) any { return nil }
+
+// ToolRegistry is the tools the supervisor can use, in the order they're described to the LLM, followed by the tools
+// reserved for the supervisor
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools []Tool
+}
+
+// reserved are the tools of every registry, handled by the supervisor itself
+var reserved = []Tool{AskUser}
+
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, error) {
+	r := &ToolRegistry{}
+	for _, tool := range tools {
+		if err := r.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a tool, its name can't be taken by another tool or by a reserved tool such as ASK_USER
+func (r *ToolRegistry) Register(tool Tool) error {
+	name := tool.Name()
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("%q isn't a tool name", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.all() {
+		if t.Name() == name {
+			return fmt.Errorf("%w: %s", ErrToolExists, name)
+		}
+	}
+	r.tools = append(r.tools, tool)
+	return nil
+}
+
+// Get returns the tool of the name, reserved tools included
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.all() {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Describe is the list of tools as the LLM is given it in the task prompt
+func (r *ToolRegistry) Describe() string {
+	if r == nil {
+		return ""
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	descriptions := make([]string, 0, len(r.tools)+len(reserved))
+	for _, t := range r.all() {
+		inputs := make([]string, 0, len(t.Inputs()))
+		for _, input := range t.Inputs() {
+			inputs = append(inputs, input.Name+": "+input.Type)
+		}
+		descriptions = append(descriptions, fmt.Sprintf("\t- %s\n\t\t- preference: %s\n\t\t- description: %s\n\t\t- interface: Input([%s]): Output(%s)",
+			t.Name(), t.Preference(), t.Description(), strings.Join(inputs, ", "), t.Output()))
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+// all is the registered tools followed by the reserved ones, the caller holds the lock
+func (r *ToolRegistry) all() []Tool {
+	return append(append(make([]Tool, 0, len(r.tools)+len(reserved)), r.tools...), reserved...)
+}
@@ -0,0 +1,58 @@
+package agents
+
+import (
+	"errors"
+	"github.com/asynkron/protoactor-go/actor"
+	"testing"
+)
+
+type stubTool struct {
+	name string
+}
+
+func (s stubTool) Name() string        { return s.name }
+func (s stubTool) Description() string { return "does " + s.name }
+func (s stubTool) Preference() string  { return "never" }
+func (s stubTool) Inputs() []ToolInput {
+	return []ToolInput{{Name: "A", Type: "string"}, {Name: "B", Type: "[]int"}}
+}
+func (s stubTool) Output() string                    { return "C: bool" }
+func (s stubTool) Producer(deps Deps) actor.Producer { return nil }
+func (s stubTool) Start(dispatch Dispatch) any       { return nil }
+
+func TestToolRegistry(t *testing.T) {
+	r, err := NewToolRegistry(stubTool{name: "ONE"}, stubTool{name: "TWO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ONE", "ASK_USER"} {
+		if err := r.Register(stubTool{name: name}); !errors.Is(err, ErrToolExists) {
+			t.Errorf("Register(%s) = %v, want %v", name, err, ErrToolExists)
+		}
+	}
+	if err := r.Register(stubTool{name: "TWO WORDS"}); err == nil {
+		t.Error("Register() accepted a name with a space")
+	}
+
+	if tool, ok := r.Get("TWO"); !ok || tool.Name() != "TWO" {
+		t.Errorf("Get(TWO) = %v, %v", tool, ok)
+	}
+	if _, ok := r.Get("two"); ok {
+		t.Error("Get(two) found a tool of another case")
+	}
+	if tool, ok := r.Get("ASK_USER"); !ok || tool != AskUser {
+		t.Errorf("Get(ASK_USER) = %v, %v", tool, ok)
+	}
+	want := "\t- ONE\n\t\t- preference: never\n\t\t- description: does ONE\n\t\t- interface: Input([A: string, B: []int]): Output(C: bool)\n" +
+		"\t- TWO\n\t\t- preference: never\n\t\t- description: does TWO\n\t\t- interface: Input([A: string, B: []int]): Output(C: bool)\n" +
+		"\t- ASK_USER\n\t\t- preference: only when the task is too ambiguous to solve without the user, never ask a question that has been answered\n" +
+		"\t\t- description: asks the user a question and waits for their answer\n\t\t- interface: Input([Question: string]): Output(Answer: string)"
+	if got := r.Describe(); got != want {
+		t.Errorf("Describe() =\n%s\nwant\n%s", got, want)
+	}
+
+	var none *ToolRegistry
+	if _, ok := none.Get("ONE"); ok || none.Describe() != "" {
+		t.Error("a nil registry has tools")
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"net/http"
+)
+
+var (
+	errNoApproval  = errors.New("no such pending approval")
+	errInvalidEdit = errors.New("only commands can be edited")
+)
+
+type decision struct {
+	Decision models.Decision `json:"decision"`
+	Command  string          `json:"command,omitempty"` // to run instead, when editing a command
+	Comment  string          `json:"comment,omitempty"`
+}
+
+type listPending struct {
+	Pending   []models.Approval `json:"pending"`
+	Questions []models.Question `json:"questions"`
+}
+
+// listPending returns the plans and commands of a goal waiting on a person's approval, and the questions waiting on the
+// user's answer
+func (s *Server) listPending(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("pending request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	goal, err := s.deps.Goals.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get goal from store")
+		return
+	}
+
+	res := listPending{Pending: goal.Pending, Questions: goal.Questions}
+	if res.Pending == nil {
+		res.Pending = make([]models.Approval, 0)
+	}
+	if res.Questions == nil {
+		res.Questions = make([]models.Question, 0)
+	}
+	render.JSON(w, r, res)
+}
+
+// decide approves, rejects or edits a pending approval and passes the decision on to the agent waiting on it
+func (s *Server) decide(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("approval request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	aid := chi.URLParam(r, "aid")
+
+	d := decision{}
+	if err := unmarshalRequestBody(r, &d); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Debug().Msg("cannot parse body")
+		render.JSON(w, r, errorResponse{Error: "unable to parse body"})
+		return
+	}
+	if !d.Decision.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: "decision must be approve, reject or edit"})
+		return
+	}
+	if d.Decision == models.Edit && d.Command == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: "an edit needs the command to run instead"})
+		return
+	}
+
+	pid, live := s.requests.get(id)
+	if !live {
+		w.WriteHeader(http.StatusConflict)
+		render.JSON(w, r, errorResponse{Error: fmt.Sprintf("%s: no agents are running", errConflict)})
+		return
+	}
+
+	var approval models.Approval
+	err := s.deps.Goals.Update(r.Context(), id, func(goal *models.Goal) error {
+		for _, pending := range goal.Pending {
+			if pending.ID == aid && pending.Kind != models.CommandApproval && d.Decision == models.Edit {
+				return errInvalidEdit
+			}
+		}
+		var ok bool
+		if approval, ok = goal.Decide(aid, d.Decision, d.Command, d.Comment); !ok {
+			return errNoApproval
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, errNoApproval):
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msgf("cannot find approval %s", aid)
+		return
+	case errors.Is(err, errInvalidEdit):
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to record decision")
+		return
+	}
+
+	s.deps.Events.Publish(id, events.ApprovalDecided, approval)
+	s.ac.Send(pid, messages.Decided{Approval: approval})
+	log.Debug().Str(logger.RequestTaskID, idParam).Msgf("%s sent to agent job", d.Decision)
+	render.JSON(w, r, approval)
+}
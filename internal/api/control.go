@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"net/http"
+)
+
+var errConflict = errors.New("goal cannot do that in its current state")
+
+// controlGoal wraps an action on a single goal, such as cancelling it, in an http handler
+func (s *Server) controlGoal(action string, fn func(ctx context.Context, id uuid.UUID) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debug().Msgf("%s request", action)
+		id, idParam, ok := parseID(w, r)
+		if !ok {
+			return
+		}
+
+		err := fn(r.Context(), id)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+			return
+		case errors.Is(err, errConflict):
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, errorResponse{Error: err.Error()})
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msgf("unable to %s goal", action)
+			return
+		}
+
+		log.Debug().Str(logger.RequestTaskID, idParam).Msgf("%s sent to agent job", action)
+		render.JSON(w, r, struct {
+			Id string `json:"id"`
+		}{idParam})
+	}
+}
+
+// Rehydrate marks goals left active by a previous process as interrupted, when resume is set they are picked back up
+// from their last checkpoint
+func (s *Server) Rehydrate(ctx context.Context, resume bool) error {
+	goals, _, err := s.deps.Goals.List(ctx, store.Filter{States: []models.State{models.Init, models.Thinking, models.Idle, models.AwaitingApproval, models.WaitingForInput, models.Interrupted}})
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+
+	for _, goal := range goals {
+		if goal.State.Active() {
+			err := s.deps.Goals.Update(ctx, goal.ID, func(goal *models.Goal) error {
+				goal.Transition(models.Interrupted)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("interrupt %s: %w", goal.ID, err)
+			}
+		}
+		if !resume {
+			continue
+		}
+		if err := s.resume(ctx, goal.ID); err != nil {
+			return fmt.Errorf("resume %s: %w", goal.ID, err)
+		}
+		log.Info().Str(logger.RequestTaskID, goal.ID.String()).Msg("resumed interrupted goal")
+	}
+	return nil
+}
+
+// resume continues a paused goal, or respawns the agents of a goal that was interrupted or paused by a previous process
+func (s *Server) resume(ctx context.Context, id uuid.UUID) error {
+	pid, live := s.requests.get(id)
+	goal, err := s.deps.Goals.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if goal.State == models.Paused && live {
+		s.ac.Send(pid, messages.Continue{})
+		return nil
+	}
+
+	err = s.deps.Goals.Update(ctx, id, func(goal *models.Goal) error {
+		if goal.State != models.Paused && goal.State != models.Interrupted {
+			return fmt.Errorf("%w: %s", errConflict, goal.State)
+		}
+		goal.Transition(models.Thinking)
+		goal.Pending = nil // the agents waiting on them are gone, the new agents ask again
+		goal.Questions = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.insertCassette(goal); err != nil {
+		return err
+	}
+
+	pid = s.spawnPlanner(id)
+	s.ac.Send(pid, messages.ResumeGoal{RequestID: id})
+	return nil
+}
+
+// resetShell kills the goal's shell session and everything it started, its next command starts in a new shell
+func (s *Server) resetShell(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.deps.Goals.Get(ctx, id); err != nil {
+		return err
+	}
+	if s.deps.Sessions == nil {
+		return fmt.Errorf("%w: shell sessions aren't enabled", errConflict)
+	}
+	s.deps.Sessions.Reset(id.String())
+	return nil
+}
+
+func (s *Server) pause(ctx context.Context, id uuid.UUID) error {
+	pid, live := s.requests.get(id)
+	goal, err := s.deps.Goals.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !goal.State.Active() || !live {
+		return fmt.Errorf("%w: %s", errConflict, goal.State)
+	}
+
+	s.ac.Send(pid, messages.Pause{})
+	return nil
+}
+
+// cancel asks the planner to stop its agents, goals without agents in this process are cancelled straight away
+func (s *Server) cancel(ctx context.Context, id uuid.UUID) error {
+	pid, live := s.requests.get(id)
+	goal, err := s.deps.Goals.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if goal.State.Ended() {
+		return fmt.Errorf("%w: %s", errConflict, goal.State)
+	}
+	if live {
+		s.ac.Send(pid, messages.Cancel{})
+		return nil
+	}
+
+	return s.deps.Goals.Update(ctx, id, func(goal *models.Goal) error {
+		if goal.State.Ended() {
+			return fmt.Errorf("%w: %s", errConflict, goal.State)
+		}
+		goal.Transition(models.Cancelled)
+		return nil
+	})
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"io"
+	"net/http"
+	"time"
+)
+
+const keepAliveInterval = 15 * time.Second
+
+// streamEvents streams the events of a goal as server-sent events until the goal finishes or the client goes away,
+// clients reconnecting with Last-Event-ID only receive the events they missed, or the whole backlog if the id is from
+// before a restart
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("events request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	goal, err := s.deps.Goals.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get goal from store")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Msg("streaming is not supported by the response writer")
+		return
+	}
+
+	backlog, live, unsubscribe := s.deps.Events.Subscribe(id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	lastID := s.deps.Events.After(r.Header.Get("Last-Event-ID"))
+	finished := false
+	for _, event := range backlog {
+		if event.ID <= lastID {
+			continue
+		}
+		if err := s.writeEvent(w, event); err != nil {
+			return
+		}
+		finished = event.Type == events.Finished
+	}
+	// events are only kept in memory, a goal that ended before this process started has none
+	if !finished && len(backlog) == 0 && goal.State.Ended() {
+		_ = s.writeEvent(w, events.Event{GoalID: id, Type: events.Finished, Time: goal.UpdatedAt, Data: models.Transition{State: goal.State, Time: goal.UpdatedAt}})
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-live:
+			if !ok {
+				return
+			}
+			if err := s.writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", s.deps.Events.LastEventID(event), event.Type, data)
+	return err
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/internal/agents"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"go-autogpt/pkg/workspace"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// inputDir is the directory of a goal's sandbox the files the user provides are written to
+const inputDir = "tmp"
+
+// maxUploadBytes is how much the files of a request can add up to
+const maxUploadBytes = 100 << 20 // todo add as a config
+
+var errUpload = errors.New("unable to parse upload")
+
+type listFiles struct {
+	Files []models.File `json:"files"`
+}
+
+// listFiles returns the files in the goal's sandbox, the logs of its commands included
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("files request")
+	id, idParam, ok := s.findGoal(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := workspace.Take(agents.Workspace(id), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to list files")
+		return
+	}
+	render.JSON(w, r, listFiles{Files: files.Files()})
+}
+
+// getFile returns a file in the goal's sandbox
+func (s *Server) getFile(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("file request")
+	id, idParam, ok := s.findGoal(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "*")
+	f, info, err := workspace.Open(agents.Workspace(id), name)
+	if errors.Is(err, fs.ErrNotExist) {
+		w.WriteHeader(http.StatusNotFound)
+		render.JSON(w, r, errorResponse{Error: "no such file"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to open file")
+		return
+	}
+	defer f.Close()
+	http.ServeContent(w, r, path.Base(name), info.ModTime(), f)
+}
+
+// getArchive streams the goal's sandbox as a gzipped tarball
+func (s *Server) getArchive(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("archive request")
+	id, idParam, ok := s.findGoal(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", idParam+".tar.gz"))
+	if err := workspace.Archive(w, agents.Workspace(id)); err != nil {
+		// the status has been sent, the client is left with a truncated tarball
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to archive files")
+	}
+}
+
+// putFile writes a file the user provides the goal to its tmp directory, the planner and supervisor are given a
+// manifest of the files in their prompts
+func (s *Server) putFile(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("put file request")
+	id, idParam, ok := s.findGoal(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "*")
+	if !strings.HasPrefix(path.Clean(name), inputDir+"/") {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: "files can only be put in " + inputDir + "/"})
+		return
+	}
+	file, err := workspace.Write(agents.Workspace(id), name, http.MaxBytesReader(w, r.Body, maxUploadBytes))
+	if ok := writeFileError(w, r, idParam, err); !ok {
+		return
+	}
+
+	err = s.deps.Goals.Update(r.Context(), id, func(goal *models.Goal) error {
+		goal.AddInput(file)
+		return nil
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to record file")
+		return
+	}
+	render.JSON(w, r, file)
+}
+
+// readUpload reads the command of a multipart request to create a goal from its command field, as json, and writes
+// the files of its files fields to the goal's tmp directory
+func readUpload(w http.ResponseWriter, r *http.Request, id uuid.UUID) (command, []models.File, error) {
+	cmd := command{}
+	inputs := make([]models.File, 0)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return cmd, inputs, fmt.Errorf("%w: %s", errUpload, err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return cmd, inputs, nil
+		}
+		var tooLarge *http.MaxBytesError
+		if err != nil && !errors.As(err, &tooLarge) {
+			return cmd, inputs, fmt.Errorf("%w: %s", errUpload, err)
+		}
+		if err != nil {
+			return cmd, inputs, err
+		}
+		switch part.FormName() {
+		case "command":
+			if err := json.NewDecoder(part).Decode(&cmd); err != nil {
+				return cmd, inputs, fmt.Errorf("%w: command: %s", errUpload, err)
+			}
+		case "files":
+			name := part.FileName()
+			if name == "" || name == "." || name == ".." {
+				return cmd, inputs, fmt.Errorf("%w: %q isn't a file name", errUpload, name)
+			}
+			file, err := workspace.Write(agents.Workspace(id), inputDir+"/"+name, part)
+			if err != nil {
+				return cmd, inputs, err
+			}
+			inputs = append(inputs, file)
+		default:
+			return cmd, inputs, fmt.Errorf("%w: unknown field %q", errUpload, part.FormName())
+		}
+	}
+}
+
+// writeFileError writes the response to a file the user provided that couldn't be written, it returns true if there
+// was no error
+func writeFileError(w http.ResponseWriter, r *http.Request, idParam string, err error) bool {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &tooLarge):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		render.JSON(w, r, errorResponse{Error: fmt.Sprintf("files can't add up to more than %d bytes", tooLarge.Limit)})
+	case errors.Is(err, errUpload), errors.Is(err, workspace.ErrOutside):
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to write file")
+	}
+	return false
+}
+
+// findGoal returns the id of the goal of the request, it writes the response if there's no such goal
+func (s *Server) findGoal(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, bool) {
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return id, idParam, false
+	}
+
+	_, err := s.deps.Goals.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+		return id, idParam, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get goal from store")
+		return id, idParam, false
+	}
+	return id, idParam, true
+}
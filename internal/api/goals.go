@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type listGoals struct {
+	Goals  []models.GoalSummary `json:"goals"`
+	Total  int                  `json:"total"`
+	Offset int                  `json:"offset"`
+	Limit  int                  `json:"limit"`
+}
+
+// listGoals returns a page of goal summaries, newest first. Supported query parameters are state (repeatable or comma
+// separated), from and to (RFC 3339 creation time range), q (text in the goal), offset and limit.
+func (s *Server) listGoals(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("list request")
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Debug().Err(err).Msg("cannot parse filter")
+		render.JSON(w, r, errorResponse{Error: err.Error()})
+		return
+	}
+
+	goals, total, err := s.deps.Goals.List(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Err(err).Msg("unable to list goals from store")
+		return
+	}
+
+	summaries := make([]models.GoalSummary, 0, len(goals))
+	for _, goal := range goals {
+		summaries = append(summaries, goal.Summary())
+	}
+	render.JSON(w, r, listGoals{Goals: summaries, Total: total, Offset: filter.Offset, Limit: filter.Limit})
+}
+
+// getGoal returns the full record of a goal
+func (s *Server) getGoal(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("goal request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	goal, err := s.deps.Goals.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get goal from store")
+		return
+	}
+
+	render.JSON(w, r, goal)
+}
+
+func parseFilter(query url.Values) (store.Filter, error) {
+	filter := store.Filter{Query: query.Get("q"), Limit: defaultPageSize}
+	for _, param := range query["state"] {
+		for _, state := range strings.Split(param, ",") {
+			if state != "" {
+				filter.States = append(filter.States, models.State(state))
+			}
+		}
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, from); err != nil {
+			return store.Filter{}, fmt.Errorf("from must be an RFC 3339 time: %w", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, to); err != nil {
+			return store.Filter{}, fmt.Errorf("to must be an RFC 3339 time: %w", err)
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			return store.Filter{}, errors.New("offset must be a positive integer")
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > maxPageSize {
+			return store.Filter{}, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	return filter, nil
+}
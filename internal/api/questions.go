@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"net/http"
+)
+
+var errNoQuestion = errors.New("no such question waiting on an answer")
+
+type answer struct {
+	QuestionID string `json:"questionId,omitempty"` // can be left out when only one question is waiting
+	Answer     string `json:"answer"`
+}
+
+// answer records the user's answer to a question an agent asked and passes it on to the agent waiting on it
+func (s *Server) answer(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("answer request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	a := answer{}
+	if err := unmarshalRequestBody(r, &a); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Debug().Msg("cannot parse body")
+		render.JSON(w, r, errorResponse{Error: "unable to parse body"})
+		return
+	}
+	if a.Answer == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, errorResponse{Error: "answer can't be empty"})
+		return
+	}
+
+	pid, live := s.requests.get(id)
+	if !live {
+		w.WriteHeader(http.StatusConflict)
+		render.JSON(w, r, errorResponse{Error: fmt.Sprintf("%s: no agents are running", errConflict)})
+		return
+	}
+
+	var question models.Question
+	err := s.deps.Goals.Update(r.Context(), id, func(goal *models.Goal) error {
+		var ok bool
+		if question, ok = goal.AnswerQuestion(a.QuestionID, a.Answer); !ok {
+			return errNoQuestion
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, errNoQuestion):
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msgf("cannot find question %s", a.QuestionID)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to record answer")
+		return
+	}
+
+	s.deps.Events.Publish(id, events.QuestionAnswered, question)
+	s.ac.Send(pid, messages.Answered{Question: question})
+	log.Debug().Str(logger.RequestTaskID, idParam).Msg("answer sent to agent job")
+	render.JSON(w, r, question)
+}
@@ -10,19 +10,27 @@ import (
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
 	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
+	"go-autogpt/internal/agents"
 	planner "go-autogpt/internal/agents/planner/actor"
 	"go-autogpt/pkg/logger"
 	"go-autogpt/pkg/messages"
 	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
 	"io"
+	"mime"
 	"net/http"
+	"os"
 	"time"
 )
 
 type command struct {
-	Goal string `json:"goal"`
+	Goal   string         `json:"goal"`
+	Replay string         `json:"replay,omitempty"` // id of a recorded goal to replay
+	Budget *models.Budget `json:"budget,omitempty"` // limits replacing the server's defaults
+	Policy *models.Policy `json:"policy,omitempty"` // command rules added to the server's defaults
 }
 
 type getStatus struct {
@@ -34,113 +42,228 @@ type errorResponse struct {
 }
 
 type Server struct {
-	ac     *actor.RootContext
-	server *http.Server
-	state  requestsCache
+	ac       *actor.RootContext
+	server   *http.Server
+	requests *requestsCache
+	deps     agents.Deps
+	budget   models.Budget // default budget of new goals
+	policy   models.Policy // default command policy of new goals
 }
 
-func New(ac *actor.RootContext) *Server {
+func New(ac *actor.RootContext, deps agents.Deps, budget models.Budget, policy models.Policy) *Server {
+	s := &Server{
+		ac:       ac,
+		requests: newRequestsCache(),
+		deps:     deps,
+		budget:   budget,
+		policy:   policy,
+	}
+
 	r := chi.NewRouter()
 	r.Use(logMiddleware())
-	requests := newRequestsCache()
+	r.Get("/status/{id}", s.getStatus)
+	r.Post("/new", s.newGoal)
+	r.Get("/goals", s.listGoals)
+	r.Get("/goals/{id}", s.getGoal)
+	r.Post("/goals/{id}/cancel", s.controlGoal("cancel", s.cancel))
+	r.Post("/goals/{id}/pause", s.controlGoal("pause", s.pause))
+	r.Post("/goals/{id}/resume", s.controlGoal("resume", s.resume))
+	r.Get("/goals/{id}/events", s.streamEvents)
+	r.Get("/goals/{id}/pending", s.listPending)
+	r.Post("/goals/{id}/approvals/{aid}", s.decide)
+	r.Post("/goals/{id}/answers", s.answer)
+	r.Post("/goals/{id}/shell/reset", s.controlGoal("reset shell", s.resetShell))
+	r.Get("/goals/{id}/files", s.listFiles)
+	r.Get("/goals/{id}/files/*", s.getFile)
+	r.Put("/goals/{id}/files/*", s.putFile)
+	r.Get("/goals/{id}/archive", s.getArchive)
+	r.Handle("/metrics", promhttp.Handler())
 
-	r.Get("/status/{id}", func(w http.ResponseWriter, r *http.Request) {
-		log.Debug().Msg("status request")
-		idParam := chi.URLParam(r, "id")
-		id, err := uuid.Parse(idParam)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			log.Debug().Msg("cannot parse id")
-			render.JSON(w, r, errorResponse{Error: "unable to parse id"})
-			return
+	s.server = &http.Server{
+		Addr:    fmt.Sprint(":", 8080), // todo use config
+		Handler: r,
+	}
+	return s
+}
+
+func (s *Server) Start() error {
+	err := s.server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		return fmt.Errorf("http server: %w", err)
+	}
+
+	log.Info().Msg("http server started")
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("status request")
+	id, idParam, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	goal, err := s.deps.Goals.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get goal from store")
+		return
+	}
+
+	render.JSON(w, r, getStatus{goal.Status()})
+}
+
+// newGoal creates a goal from a json command, or a multipart form of the command and the files the goal is given
+func (s *Server) newGoal(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Msg("new request")
+	id := uuid.New()
+	created := false
+	defer func() {
+		if !created {
+			_ = os.RemoveAll(agents.Workspace(id)) // of the files that were uploaded
 		}
-		pid, ok := requests.get(id)
-		if !ok {
-			w.WriteHeader(http.StatusNotFound)
-			log.Debug().Str(logger.RequestTaskID, idParam).Msg("cannot find id")
+	}()
+
+	cmd := command{}
+	inputs := make([]models.File, 0)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		var err error
+		cmd, inputs, err = readUpload(w, r, id)
+		if ok := writeFileError(w, r, id.String(), err); !ok {
 			return
 		}
+	} else if err := unmarshalRequestBody(r, &cmd); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Debug().Err(err).Msg("cannot parse body")
+		render.JSON(w, r, errorResponse{Error: "unable to parse body"})
+		return
+	}
 
-		future := ac.RequestFuture(pid, messages.GetStatus{}, time.Minute) // blocking
-		res, err := future.Result()
-		if err != nil {
-			requests.remove(id)
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get status from actor")
+	goal := models.NewGoal(id, cmd.Goal)
+	goal.Inputs = inputs
+	goal.Budget = s.budget
+	if cmd.Budget != nil {
+		if !cmd.Budget.Valid() {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, errorResponse{Error: "budget limits can't be negative, other than -1 for unlimited"})
 			return
 		}
-		if err, ok := res.(error); ok {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unable to get status from actor")
+		goal.Budget = goal.Budget.Merge(*cmd.Budget)
+	}
+	goal.Policy = s.policy
+	if cmd.Policy != nil {
+		if cmd.Policy.MaxLength < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, errorResponse{Error: "policy max length can't be negative"})
 			return
 		}
-
-		if status, ok := res.(models.Status); ok {
-			render.JSON(w, r, getStatus{status})
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error().Str(logger.RequestTaskID, idParam).Err(err).Msg("unknown status from actor")
+		if goal.Policy.Disjoint(*cmd.Policy) {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, errorResponse{Error: "policy allowlist has no program in common with the server's"})
+			return
 		}
-	})
-
-	r.Post("/new", func(w http.ResponseWriter, r *http.Request) {
-		log.Debug().Msg("new request")
-		cmd := command{}
-		err := unmarshalRequestBody(r, &cmd)
+		goal.Policy = goal.Policy.Merge(*cmd.Policy)
+	}
+	if cmd.Replay != "" {
+		from, err := uuid.Parse(cmd.Replay)
+		if err != nil || s.deps.Cassettes == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, errorResponse{Error: "unable to parse replay id"})
+			return
+		}
+		c, err := s.deps.Cassettes.Load(from)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			log.Debug().Msg("cannot parse body")
-			render.JSON(w, r, errorResponse{Error: "unable to parse body"})
+			log.Debug().Err(err).Str(logger.RequestTaskID, cmd.Replay).Msg("cannot load cassette")
+			render.JSON(w, r, errorResponse{Error: "unable to load cassette to replay"})
 			return
 		}
-
-		decider := func(reason interface{}) actor.Directive {
-			log.Error().Msgf("handling failure for child. reason: %v", reason)
-			return actor.RestartDirective
+		if goal.Goal == "" {
+			goal.Goal = c.Goal
 		}
+		goal.ReplayOf = &from
+	}
 
-		strategy := actor.NewOneForOneStrategy(3, 10000, decider)
-
-		// todo allow for the configuration of remote actors
-		props := actor.PropsFromProducer(planner.New, actor.WithSupervisor(strategy))
-		pid := ac.Spawn(props)
+	err := s.insertCassette(goal)
+	if err == nil {
+		err = s.deps.Goals.Create(r.Context(), goal)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Str(logger.RequestTaskID, id.String()).Err(err).Msg("unable to store goal")
+		return
+	}
 
-		id := uuid.New()
-		ac.Send(pid, messages.NewGoal{RequestID: id, Goal: cmd.Goal})
-		requests.add(id, pid)
+	created = true
+	pid := s.spawnPlanner(id)
+	s.ac.Send(pid, messages.NewGoal{RequestID: id, Goal: goal.Goal})
 
-		log.Debug().Str(logger.RequestTaskID, id.String()).Msg("agent job has been started")
-		render.JSON(w, r, struct {
-			Id string `json:"id"`
-		}{id.String()})
-	})
+	log.Debug().Str(logger.RequestTaskID, id.String()).Msg("agent job has been started")
+	render.JSON(w, r, struct {
+		Id string `json:"id"`
+	}{id.String()})
+}
 
-	return &Server{
-		ac: ac,
-		server: &http.Server{
-			Addr:    fmt.Sprint(":", 8080), // todo use config
-			Handler: r,
-		},
+// insertCassette replays the cassette of the goal, or records it if the server is recording
+func (s *Server) insertCassette(goal models.Goal) error {
+	if s.deps.Cassettes == nil {
+		return nil
 	}
+	if goal.ReplayOf != nil {
+		_, err := s.deps.Cassettes.Replay(goal.ID, *goal.ReplayOf)
+		return err
+	}
+	return s.deps.Cassettes.Record(goal.ID, goal.Goal)
 }
 
-func (s *Server) Start() error {
-	err := s.server.ListenAndServe()
-	if err != http.ErrServerClosed {
-		return fmt.Errorf("http server: %w", err)
+// spawnPlanner spawns the planner of a goal and tracks it until it stops, once the goal has ended
+func (s *Server) spawnPlanner(id uuid.UUID) *actor.PID {
+	decider := func(reason interface{}) actor.Directive {
+		log.Error().Msgf("handling failure for child. reason: %v", reason)
+		return actor.RestartDirective
 	}
 
-	log.Info().Msg("http server started")
-	return nil
+	strategy := actor.NewOneForOneStrategy(3, 10000, decider)
+
+	// todo allow for the configuration of remote actors
+	untrack := func(next actor.ReceiverFunc) actor.ReceiverFunc {
+		return func(c actor.ReceiverContext, envelope *actor.MessageEnvelope) {
+			next(c, envelope)
+			if _, ok := envelope.Message.(*actor.Stopped); ok {
+				s.requests.remove(id, c.Self())
+			}
+		}
+	}
+	props := actor.PropsFromProducer(planner.New(s.deps), actor.WithSupervisor(strategy), actor.WithReceiverMiddleware(untrack))
+	pid := s.ac.Spawn(props)
+	s.requests.add(id, pid)
+	return pid
 }
 
-func (s *Server) Stop(ctx context.Context) error {
-	err := s.server.Shutdown(ctx)
+func parseID(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, bool) {
+	idParam := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idParam)
 	if err != nil {
-		return fmt.Errorf("http server: %w", err)
+		w.WriteHeader(http.StatusBadRequest)
+		log.Debug().Msg("cannot parse id")
+		render.JSON(w, r, errorResponse{Error: "unable to parse id"})
+		return uuid.Nil, idParam, false
 	}
-
-	return nil
+	return id, idParam, true
 }
 
 func logMiddleware() func(http.Handler) http.Handler {
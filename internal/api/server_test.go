@@ -0,0 +1,1174 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
+	"go-autogpt/internal/agents"
+	"go-autogpt/internal/agents/builtin"
+	fetchHandler "go-autogpt/internal/agents/fetch/handler"
+	searchHandler "go-autogpt/internal/agents/search/handler"
+	"go-autogpt/internal/agents/terminal/handler"
+	"go-autogpt/pkg/cassette"
+	"go-autogpt/pkg/events"
+	"go-autogpt/pkg/llm"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/messages"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/prompts"
+	"go-autogpt/pkg/store/bolt"
+	"go-autogpt/pkg/usage"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testdata string
+
+// TestMain runs the tests from a temporary directory since the terminal agent works in ./sandbox
+func TestMain(m *testing.M) {
+	var err error
+	if testdata, err = filepath.Abs("testdata"); err != nil {
+		panic(err)
+	}
+	dir, err := os.MkdirTemp("", "go-autogpt")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	if err := logger.NewGlobal("disabled", false); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestServer_goals(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		budget  *models.Budget
+		policy  *models.Policy
+		replan  agents.ReplanConfig
+		session bool
+		search  searchHandler.SearchProvider
+		state   models.State
+		history int
+		err     string
+		check   func(t *testing.T, status models.Status)
+	}{
+		{
+			name:    "completes every task of the plan",
+			script:  "happy.json",
+			state:   models.Finished,
+			history: 2,
+			check: func(t *testing.T, status models.Status) {
+				if res := commandResult(t, status.Planner.TaskHistory[1]); res.Result != "hello\n" {
+					t.Errorf("expected the file to be printed, got %q", res.Result)
+				}
+				if usage := status.Planner.Usage; usage.Calls != 3 || usage.PromptTokens == 0 || usage.CompletionTokens == 0 {
+					t.Errorf("expected the plan and two solutions to be metered, got %+v", usage)
+				}
+				for _, task := range status.Planner.TaskHistory {
+					if task.Usage.Calls != 1 {
+						t.Errorf("expected the solution of %q to be metered, got %+v", task.Task, task.Usage)
+					}
+				}
+			},
+		},
+		{
+			name:    "runs independent tasks at the same time and joins them",
+			script:  "dag.json",
+			state:   models.Finished,
+			history: 3,
+			check: func(t *testing.T, status models.Status) {
+				history := status.Planner.TaskHistory
+				if history[2].ID != "join" {
+					t.Errorf("expected the joining task to run last, got %+v", history)
+				}
+				// each write waits for the other's file, so they only succeed if they ran at the same time
+				if res := commandResult(t, history[2]); res.Result != "a\nb\n" {
+					t.Errorf("expected both files to be printed, got %q", res.Result)
+				}
+			},
+		},
+		{
+			name:    "runs the commands of a goal in the same shell",
+			script:  "session.json",
+			session: true,
+			state:   models.Finished,
+			history: 2,
+			check: func(t *testing.T, status models.Status) {
+				if res := commandResult(t, status.Planner.TaskHistory[1]); res.Result != "hello from tmp\n" {
+					t.Errorf("expected the second task to carry on in the first one's shell, got %q", res.Result)
+				}
+			},
+		},
+		{
+			name:    "searches and summarizes the results against the expected outcome",
+			script:  "search.json",
+			search:  stubSearch{{Title: "Sandbox", URL: "https://example.com/sandbox", Snippet: "the sandbox config has a backend"}, {Title: "Sandbox", URL: "http://www.example.com/sandbox/", Snippet: "a mirror"}},
+			state:   models.Finished,
+			history: 1,
+			check: func(t *testing.T, status models.Status) {
+				res := searchResult(t, status.Planner.TaskHistory[0])
+				if !strings.HasPrefix(res.Result, "The sandbox is configured") {
+					t.Errorf("expected the summary to be the result, got %q", res.Result)
+				}
+				if len(res.Hits) != 1 || res.Hits[0].URL != "https://example.com/sandbox" {
+					t.Errorf("expected the mirror to be dropped, got %+v", res.Hits)
+				}
+			},
+		},
+		{
+			name:   "fails a search without a provider",
+			script: "search.json",
+			state:  models.Failed,
+			err:    "no search provider",
+		},
+		{
+			name:   "fails when the plan can't be parsed",
+			script: "parse_failure.json",
+			state:  models.Failed,
+			err:    "error sanitizing answer",
+		},
+		{
+			name:    "repairs answers that are loose with json",
+			script:  "repair.json",
+			state:   models.Finished,
+			history: 1,
+			check: func(t *testing.T, status models.Status) {
+				if res := commandResult(t, status.Planner.TaskHistory[0]); res.Result != "done\n" {
+					t.Errorf("expected the command with nested braces to run, got %+v", res)
+				}
+			},
+		},
+		{
+			name:    "revises the plan when a task goes wrong",
+			script:  "replan.json",
+			replan:  agents.ReplanConfig{Max: 1},
+			state:   models.Finished,
+			history: 1,
+			check: func(t *testing.T, status models.Status) {
+				revisions := status.Planner.Revisions
+				if len(revisions) != 1 || revisions[0].TaskID != "launch" || !strings.Contains(revisions[0].Reason, "unknown tool") {
+					t.Fatalf("expected the failed launch to be revised, got %+v", revisions)
+				}
+				if len(revisions[0].Revised) != 1 || status.Planner.TaskHistory[0].ID != "print" {
+					t.Errorf("expected the revised task to run, got %+v", status.Planner.TaskHistory)
+				}
+			},
+		},
+		{
+			name:    "lets the running tasks complete before revising the plan",
+			script:  "replan_running.json",
+			replan:  agents.ReplanConfig{Max: 1},
+			state:   models.Finished,
+			history: 2,
+			check: func(t *testing.T, status models.Status) {
+				// the tasks think at the same time, so either of them can be given the unknown tool
+				revisions := status.Planner.Revisions
+				if len(revisions) != 1 || len(revisions[0].Previous) != 1 || revisions[0].Previous[0].ID != revisions[0].TaskID {
+					t.Fatalf("expected only the failed task to be revised, got %+v", revisions)
+				}
+				history := status.Planner.TaskHistory
+				if history[0].ID == revisions[0].TaskID || history[1].ID != "print" {
+					t.Fatalf("expected the running task to complete before the revised one, got %+v", history)
+				}
+				if res := commandResult(t, history[0]); res.Result != "done\n" {
+					t.Errorf("expected the running task to say done, got %q", res.Result)
+				}
+			},
+		},
+		{
+			name:    "revises the plan when a result contradicts the expected outcome",
+			script:  "verify.json",
+			replan:  agents.ReplanConfig{Max: 1, VerifyOutcomes: true},
+			state:   models.Finished,
+			history: 2,
+			check: func(t *testing.T, status models.Status) {
+				revisions := status.Planner.Revisions
+				if len(revisions) != 1 || revisions[0].TaskID != "print" || !strings.Contains(revisions[0].Reason, "hullo") {
+					t.Fatalf("expected the misspelled result to be revised, got %+v", revisions)
+				}
+				if res := commandResult(t, status.Planner.TaskHistory[1]); res.Result != "hello\n" {
+					t.Errorf("expected the revised task to print hello, got %q", res.Result)
+				}
+			},
+		},
+		{
+			name:   "fails when the plan can't be revised any more",
+			script: "replan.json",
+			state:  models.Failed,
+			err:    "unknown tool",
+		},
+		{
+			name:   "fails when the supervisor picks an unknown tool",
+			script: "unknown_tool.json",
+			state:  models.Failed,
+			err:    "unknown tool",
+		},
+		{
+			name:    "diagnoses a failed command and retries it",
+			script:  "diagnose.json",
+			state:   models.Finished,
+			history: 1,
+			check: func(t *testing.T, status models.Status) {
+				res := commandResult(t, status.Planner.TaskHistory[0])
+				if res.Result != "found\n" || len(res.DiagnosticAttempts) != 2 {
+					t.Errorf("expected the retried command to succeed after one diagnosis, got %+v", res)
+				}
+			},
+		},
+		{
+			name:    "stops before a command over the budget",
+			script:  "happy.json",
+			budget:  &models.Budget{MaxCommands: 1},
+			state:   models.Failed,
+			history: 1,
+			err:     "budget exceeded",
+			check:   budgetLimit(models.CommandsLimit),
+		},
+		{
+			name:    "stops before a task once the LLM calls are used up",
+			script:  "happy.json",
+			budget:  &models.Budget{MaxCalls: 2},
+			state:   models.Failed,
+			history: 1,
+			err:     "budget exceeded",
+			check:   budgetLimit(models.CallsLimit),
+		},
+		{
+			name:   "stops repairing an answer once the LLM calls are used up",
+			script: "repair.json",
+			budget: &models.Budget{MaxCalls: 1},
+			state:  models.Failed,
+			err:    "budget exceeded",
+			check: func(t *testing.T, status models.Status) {
+				budgetLimit(models.CallsLimit)(t, status)
+				if status.Planner.Usage.Calls != 1 {
+					t.Errorf("expected the repair not to be called, got %d calls", status.Planner.Usage.Calls)
+				}
+			},
+		},
+		{
+			name:   "kills a command once the goal's time is up",
+			script: "slow.json",
+			budget: &models.Budget{MaxSeconds: 1},
+			state:  models.Failed,
+			err:    "budget exceeded",
+			check:  budgetLimit(models.DurationLimit),
+		},
+		{
+			name:    "diagnoses commands the policy refuses instead of running them",
+			script:  "policy.json",
+			state:   models.Finished,
+			history: 1,
+			check: func(t *testing.T, status models.Status) {
+				res := commandResult(t, status.Planner.TaskHistory[0])
+				if len(res.DiagnosticAttempts) != 2 || !res.DiagnosticAttempts[0].Refused || !strings.Contains(res.DiagnosticAttempts[0].Error, "pipe-to-shell") {
+					t.Fatalf("expected the piped install to be refused, got %+v", res.DiagnosticAttempts)
+				}
+				if res.Result != "installed\n" {
+					t.Errorf("expected the diagnosed command to take the refused command's place, got %q", res.Result)
+				}
+			},
+		},
+		{
+			name:    "follows the rules of the goal's policy",
+			script:  "happy.json",
+			policy:  &models.Policy{Deny: []string{"cat"}},
+			state:   models.Failed,
+			history: 1,
+			err:     "no response for turn 0 of the diagnose template", // the refused cat goes to the diagnoser
+		},
+		{
+			name:   "gives up after too many diagnosis attempts",
+			script: "diagnose_loop.json",
+			state:  models.Failed,
+			err:    "maxAttempts exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startServer(t, tt.script, nil, func(deps *agents.Deps) {
+				deps.Replan = tt.replan
+				if tt.session {
+					deps.Sessions = handler.NewSessions(deps.Sandbox)
+				}
+				deps.Search = tt.search
+			})
+			id := postGoal(t, ts, command{Goal: "a goal for " + tt.script, Budget: tt.budget, Policy: tt.policy})
+			status := waitForGoal(t, ts, id)
+
+			if status.Planner.State != tt.state {
+				t.Fatalf("expected state %s, got %s with error %+v", tt.state, status.Planner.State, status.Planner.Errs)
+			}
+			if !strings.Contains(status.Planner.Errs.ErrMessage, tt.err) || (tt.err == "" && status.Planner.Errs.ErrMessage != "") {
+				t.Errorf("expected error %q, got %q", tt.err, status.Planner.Errs.ErrMessage)
+			}
+			if len(status.Planner.TaskHistory) != tt.history {
+				t.Fatalf("expected %d tasks in the history, got %+v", tt.history, status.Planner.TaskHistory)
+			}
+			if tt.check != nil {
+				tt.check(t, status)
+			}
+		})
+	}
+}
+
+func TestServer_replay(t *testing.T) {
+	dir := t.TempDir()
+	recorder := startServer(t, "happy.json", cassette.NewDeck(cassette.Config{Dir: dir, Record: true}))
+	recorded := postGoal(t, recorder, command{Goal: "write hello to a file and print it"})
+	want := waitForGoal(t, recorder, recorded)
+	if want.Planner.State != models.Finished {
+		t.Fatalf("expected the recorded goal to finish, got %s with error %+v", want.Planner.State, want.Planner.Errs)
+	}
+
+	// the replaying server has no scripted responses so every completion has to come from the cassette
+	player := startServer(t, "empty.json", cassette.NewDeck(cassette.Config{Dir: dir}))
+	replayed := postGoal(t, player, command{Replay: recorded.String()})
+	got := waitForGoal(t, player, replayed)
+	if got.Planner.State != models.Finished {
+		t.Fatalf("expected the replayed goal to finish, got %s with error %+v", got.Planner.State, got.Planner.Errs)
+	}
+	// the replay doesn't run the commands, so it doesn't change any files
+	for i := range want.Planner.TaskHistory {
+		want.Planner.TaskHistory[i].Files = nil
+	}
+	wantHistory, _ := json.Marshal(want.Planner.TaskHistory)
+	gotHistory, _ := json.Marshal(got.Planner.TaskHistory)
+	if !bytes.Equal(wantHistory, gotHistory) {
+		t.Errorf("expected the replay to reproduce the history\nwant: %s\ngot:  %s", wantHistory, gotHistory)
+	}
+}
+
+func TestServer_forgetsEndedGoals(t *testing.T) {
+	s, ts := newServer(t, "happy.json", nil)
+	id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+	waitForGoal(t, ts, id)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, live := s.requests.get(id); !live {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected the planner of the ended goal %s to be forgotten", id)
+}
+
+func TestServer_metrics(t *testing.T) {
+	ts := startServer(t, "happy.json", nil)
+	waitForGoal(t, ts, postGoal(t, ts, command{Goal: "write hello to a file and print it"}))
+
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body := new(strings.Builder)
+	if _, err := io.Copy(body, res.Body); err != nil {
+		t.Fatal(err)
+	}
+	for _, metric := range []string{
+		`goautogpt_llm_calls_total{agent="planner",model="script"}`,
+		`goautogpt_llm_tokens_total{agent="supervisor",kind="completion",model="script"}`,
+	} {
+		if !strings.Contains(body.String(), metric) {
+			t.Errorf("expected %s in the metrics", metric)
+		}
+	}
+}
+
+func TestServer_approvals(t *testing.T) {
+	approvals := func(deps *agents.Deps) {
+		deps.Approvals = agents.ApprovalConfig{Plans: true, Commands: true, Allow: []string{`cat [\w/.]+`}}
+	}
+
+	t.Run("runs the plan and commands once approved", func(t *testing.T) {
+		ts := startServer(t, "happy.json", nil, approvals)
+		id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+
+		plan := waitForPending(t, ts, id)
+		if plan.Kind != models.PlanApproval || plan.Plan == nil || len(plan.Plan.Tasks) != 2 {
+			t.Fatalf("expected the plan to wait for approval, got %+v", plan)
+		}
+		if status, _ := getGoalStatus(ts, id); status.Planner.State != models.AwaitingApproval || status.Planner.Plan != nil {
+			t.Errorf("expected the goal to await approval without a plan, got %s", status.Planner.State)
+		}
+		if code := postDecision(t, ts, id, plan.ID, decision{Decision: models.Edit, Command: "rm -rf /"}); code != http.StatusBadRequest {
+			t.Errorf("expected plans not to be editable, got status %d", code)
+		}
+		if code := postDecision(t, ts, id, "unknown", decision{Decision: models.Approve}); code != http.StatusNotFound {
+			t.Errorf("expected an unknown approval not to be found, got status %d", code)
+		}
+		if code := postDecision(t, ts, id, plan.ID, decision{Decision: models.Approve}); code != http.StatusOK {
+			t.Fatalf("expected the plan to be approved, got status %d", code)
+		}
+
+		cmd := waitForPending(t, ts, id)
+		if cmd.Kind != models.CommandApproval || cmd.Command != "echo hello > tmp/hello.txt" || cmd.TaskID != "1" {
+			t.Fatalf("expected the first command to wait for approval, got %+v", cmd)
+		}
+		if code := postDecision(t, ts, id, cmd.ID, decision{Decision: models.Edit, Command: "echo hello world > tmp/hello.txt"}); code != http.StatusOK {
+			t.Fatalf("expected the command to be edited, got status %d", code)
+		}
+
+		status := waitForGoal(t, ts, id)
+		if status.Planner.State != models.Finished {
+			t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+		}
+		if res := commandResult(t, status.Planner.TaskHistory[1]); res.Result != "hello world\n" {
+			t.Errorf("expected the edited command to run, got %q", res.Result)
+		}
+		goal := getGoal(t, ts, id)
+		if len(goal.Approvals) != 3 || goal.Approvals[1].Edited == "" || !goal.Approvals[2].Auto {
+			t.Errorf("expected the plan, the edited command and the allowed command to be recorded, got %+v", goal.Approvals)
+		}
+	})
+
+	t.Run("checks edited commands against the policy", func(t *testing.T) {
+		ts := startServer(t, "happy.json", nil, approvals)
+		id := postGoal(t, ts, command{Goal: "write hello to a file and print it", Policy: &models.Policy{Deny: []string{"touch"}}})
+
+		plan := waitForPending(t, ts, id)
+		if code := postDecision(t, ts, id, plan.ID, decision{Decision: models.Approve}); code != http.StatusOK {
+			t.Fatalf("expected the plan to be approved, got status %d", code)
+		}
+		cmd := waitForPending(t, ts, id)
+		if code := postDecision(t, ts, id, cmd.ID, decision{Decision: models.Edit, Command: "touch tmp/hello.txt"}); code != http.StatusOK {
+			t.Fatalf("expected the command to be edited, got status %d", code)
+		}
+
+		// the refused edit goes to the diagnoser, which has no response in the script
+		status := waitForGoal(t, ts, id)
+		if status.Planner.State != models.Failed || !strings.Contains(status.Planner.Errs.ErrMessage, "no response for turn 0 of the diagnose template") {
+			t.Errorf("expected the edited command to be refused, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+		}
+	})
+
+	t.Run("fails when the plan is rejected", func(t *testing.T) {
+		ts := startServer(t, "happy.json", nil, approvals)
+		id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+
+		plan := waitForPending(t, ts, id)
+		if code := postDecision(t, ts, id, plan.ID, decision{Decision: models.Reject, Comment: "too risky"}); code != http.StatusOK {
+			t.Fatalf("expected the plan to be rejected, got status %d", code)
+		}
+		status := waitForGoal(t, ts, id)
+		if status.Planner.State != models.Failed || status.Planner.Errs.ErrMessage != "the plan was rejected: too risky" {
+			t.Errorf("expected the goal to fail with the rejection, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+		}
+		if len(getGoal(t, ts, id).Pending) != 0 {
+			t.Errorf("expected nothing to be pending once the goal ended")
+		}
+	})
+}
+
+func TestServer_questions(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		agent  string
+		answer string
+		result string
+	}{
+		{
+			name:   "the supervisor asks the user",
+			script: "ask.json",
+			agent:  "supervisor",
+			answer: "alice",
+			result: "hello alice\n",
+		},
+		{
+			name:   "the terminal diagnoser asks the user",
+			script: "ask_diagnose.json",
+			agent:  "terminal",
+			answer: "bob",
+			result: "bob\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startServer(t, tt.script, nil)
+			id := postGoal(t, ts, command{Goal: "greet me"})
+
+			question := waitForQuestion(t, ts, id)
+			if question.Agent != tt.agent {
+				t.Errorf("expected the %s to ask, got %+v", tt.agent, question)
+			}
+			if status, _ := getGoalStatus(ts, id); status.Planner.State != models.WaitingForInput {
+				t.Errorf("expected the goal to wait for input, got %s", status.Planner.State)
+			}
+			if code := postAnswer(t, ts, id, answer{QuestionID: "unknown", Answer: tt.answer}); code != http.StatusNotFound {
+				t.Errorf("expected an unknown question not to be found, got status %d", code)
+			}
+			if code := postAnswer(t, ts, id, answer{Answer: tt.answer}); code != http.StatusOK {
+				t.Fatalf("expected the only question to be answered, got status %d", code)
+			}
+
+			status := waitForGoal(t, ts, id)
+			if status.Planner.State != models.Finished {
+				t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+			}
+			task := status.Planner.TaskHistory[0]
+			if res := commandResult(t, task); res.Result != tt.result {
+				t.Errorf("expected the answer to be used, got %q", res.Result)
+			}
+			if len(task.Questions) != 1 || task.Questions[0].Answer != tt.answer {
+				t.Errorf("expected the question and answer in the history, got %+v", task.Questions)
+			}
+		})
+	}
+}
+
+func TestServer_output(t *testing.T) {
+	var broker *events.Broker
+	ts := startServer(t, "happy.json", nil, func(deps *agents.Deps) {
+		broker = deps.Events
+		deps.Approvals = agents.ApprovalConfig{Plans: true} // holds the goal until it's subscribed to
+	})
+	id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+	plan := waitForPending(t, ts, id)
+	backlog, stream, unsubscribe := broker.Subscribe(id)
+	defer unsubscribe()
+	if code := postDecision(t, ts, id, plan.ID, decision{Decision: models.Approve}); code != http.StatusOK {
+		t.Fatalf("expected the plan to be approved, got %d", code)
+	}
+	lines := 0
+	for _, event := range backlog {
+		if event.Type == events.CommandLine {
+			lines++
+		}
+	}
+	for event := range stream {
+		if event.Type == events.CommandLine {
+			lines++
+		}
+	}
+	if lines != 1 {
+		t.Errorf("expected the line to be streamed, got %d command_line events", lines)
+	}
+
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished {
+		t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	print := status.Planner.TaskHistory[1]
+	if len(print.Output) != 1 || print.Output[0] != (models.OutputLine{Stream: models.Stdout, Line: "hello"}) {
+		t.Errorf("expected the tail of the output in the history, got %+v", print.Output)
+	}
+	b, err := os.ReadFile(filepath.Join("sandbox", id.String(), print.Log))
+	if err != nil || string(b) != "$ cat tmp/hello.txt\nhello\n" {
+		t.Errorf("expected the command and its output in the log, got %q, %v", b, err)
+	}
+}
+
+func TestServer_files(t *testing.T) {
+	get := func(ts *httptest.Server, path string) (int, []byte) {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, b
+	}
+
+	ts := startServer(t, "happy.json", nil)
+	id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished {
+		t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	hello := models.FileChange{Change: models.Created, Path: "tmp/hello.txt", Size: 6, Hash: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"}
+	if files := status.Planner.TaskHistory[0].Files; len(files) != 1 || files[0] != hello {
+		t.Errorf("expected the file written by the first task in its history, got %+v", files)
+	}
+	if files := status.Planner.TaskHistory[1].Files; len(files) != 0 {
+		t.Errorf("expected the second task to change nothing, got %+v", files)
+	}
+
+	code, b := get(ts, "/goals/"+id.String()+"/files")
+	list := listFiles{}
+	if err := json.Unmarshal(b, &list); code != http.StatusOK || err != nil {
+		t.Fatalf("expected the files to be listed, got %d %s", code, b)
+	}
+	paths := make([]string, 0, len(list.Files))
+	for _, file := range list.Files {
+		paths = append(paths, file.Path)
+	}
+	if want := []string{"logs/" + status.Planner.TaskHistory[0].ID + ".log", "logs/" + status.Planner.TaskHistory[1].ID + ".log", "tmp/hello.txt"}; strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v to be listed, got %v", want, paths)
+	}
+
+	if code, b := get(ts, "/goals/"+id.String()+"/files/tmp/hello.txt"); code != http.StatusOK || string(b) != "hello\n" {
+		t.Errorf("expected the file, got %d %q", code, b)
+	}
+	if err := os.Symlink("/etc/hostname", filepath.Join("sandbox", id.String(), "tmp", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"tmp/missing.txt", "tmp", "..%2F..%2Fgoals.db", "tmp/escape"} {
+		if code, _ := get(ts, "/goals/"+id.String()+"/files/"+path); code != http.StatusNotFound {
+			t.Errorf("expected %s to be not found, got %d", path, code)
+		}
+	}
+	if code, _ := get(ts, "/goals/"+uuid.NewString()+"/files"); code != http.StatusNotFound {
+		t.Errorf("expected the files of an unknown goal to be not found, got %d", code)
+	}
+
+	code, b = get(ts, "/goals/"+id.String()+"/archive")
+	if code != http.StatusOK {
+		t.Fatalf("expected the archive, got %d", code)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		archived[header.Name] = string(content) + header.Linkname
+	}
+	if archived["tmp/hello.txt"] != "hello\n" || archived["tmp/escape"] != "/etc/hostname" {
+		t.Errorf("expected the files in the archive and the symlink not followed, got %v", archived)
+	}
+}
+
+func TestServer_filesBetweenTasks(t *testing.T) {
+	ts := startServer(t, "pause.json", nil)
+	id := postGoal(t, ts, command{Goal: "write hello to a file and print it"})
+	control := func(action string) {
+		res, err := http.Post(ts.URL+"/goals/"+id.String()+"/"+action, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected the goal to %s, got %d", action, res.StatusCode)
+		}
+	}
+	waitFor := func(what string, done func(status models.Status) bool) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(20 * time.Millisecond) {
+			if status, err := getGoalStatus(ts, id); err == nil && done(status) {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %s", what)
+	}
+
+	// paused while the first task's command runs, the second task is held once it completes
+	time.Sleep(300 * time.Millisecond) // the command sleeps for a second
+	control("pause")
+	waitFor("the first task to complete", func(status models.Status) bool {
+		return len(status.Planner.TaskHistory) == 1 && status.Planner.State == models.Paused
+	})
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/goals/"+id.String()+"/files/tmp/upload.txt", strings.NewReader("uploaded"))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	control("resume")
+
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished {
+		t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	if files := status.Planner.TaskHistory[1].Files; len(files) != 0 {
+		t.Errorf("expected the file uploaded between the tasks not to be changed by the second task, got %+v", files)
+	}
+}
+
+func TestServer_uploads(t *testing.T) {
+	deck := cassette.NewDeck(cassette.Config{Dir: t.TempDir(), Record: true})
+	ts := startServer(t, "happy.json", deck)
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	_ = form.WriteField("command", `{"goal": "write hello to a file and print it"}`)
+	part, _ := form.CreateFormFile("files", "data.csv")
+	_, _ = part.Write([]byte("a,b\n"))
+	_ = form.Close()
+	res, err := http.Post(ts.URL+"/new", form.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := struct {
+		Id uuid.UUID `json:"id"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	id := created.Id
+
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished {
+		t.Fatalf("expected the goal to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	if b, err := os.ReadFile(filepath.Join("sandbox", id.String(), "tmp", "data.csv")); err != nil || string(b) != "a,b\n" {
+		t.Errorf("expected the file in the goal's tmp directory, got %q, %v", b, err)
+	}
+	if files := status.Planner.TaskHistory[0].Files; len(files) != 1 || files[0].Path != "tmp/hello.txt" {
+		t.Errorf("expected only the file the task wrote in its history, got %+v", files)
+	}
+	c, err := deck.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := 0
+	for _, i := range c.Interactions {
+		if i.Kind == cassette.LLMKind && strings.Contains(i.Prompt, `[{"path":"tmp/data.csv","size":4}]`) {
+			prompts++
+		}
+	}
+	if prompts != 3 {
+		t.Errorf("expected the manifest in the plan and both task prompts, got it in %d", prompts)
+	}
+
+	put := func(id uuid.UUID, path, content string) int {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/goals/"+id.String()+"/files/"+path, strings.NewReader(content))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+	if code := put(id, "tmp/data.csv", "a,b\n1,2\n"); code != http.StatusOK {
+		t.Errorf("expected the file to be replaced, got %d", code)
+	}
+	if code := put(id, "tmp/more/notes.txt", "notes"); code != http.StatusOK {
+		t.Errorf("expected the file to be put, got %d", code)
+	}
+	if inputs := getGoal(t, ts, id).Inputs; len(inputs) != 2 || inputs[0].Path != "tmp/data.csv" || inputs[0].Size != 8 || inputs[1].Path != "tmp/more/notes.txt" {
+		t.Errorf("expected the files the user provided in the goal, got %+v", inputs)
+	}
+	for _, path := range []string{"logs/notes.txt", "tmp/../notes.txt", "notes.txt"} {
+		if code := put(id, path, "notes"); code != http.StatusBadRequest {
+			t.Errorf("expected putting %s to be refused, got %d", path, code)
+		}
+	}
+	if code := put(uuid.New(), "tmp/notes.txt", "notes"); code != http.StatusNotFound {
+		t.Errorf("expected putting a file of an unknown goal to be not found, got %d", code)
+	}
+
+	body.Reset()
+	form = multipart.NewWriter(body)
+	_ = form.WriteField("unknown", "field")
+	_ = form.Close()
+	res, err = http.Post(ts.URL+"/new", form.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an upload with an unknown field to be refused, got %d", res.StatusCode)
+	}
+}
+
+func TestServer_policy(t *testing.T) {
+	s, ts := newServer(t, "happy.json", nil)
+	s.policy = models.Policy{Allow: []string{"echo", "cat"}}
+
+	body, _ := json.Marshal(command{Goal: "remove everything", Policy: &models.Policy{Allow: []string{"rm", "curl"}}})
+	res, err := http.Post(ts.URL+"/new", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an allowlist with nothing in common with the server's to be refused, got %d", res.StatusCode)
+	}
+}
+
+func TestServer_fetch(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/docs" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><nav>menu</nav><main><h1>Docs</h1><p>The sandbox has no network.</p></main></html>"))
+	}))
+	// the page's url isn't known until the site starts, so the script is written for it
+	solution, _ := json.Marshal(map[string]any{"tool": "FETCH", "inputs": []string{site.URL + "/docs"}, "reasoning": "the docs say", "limitations": "none", "outcome": "whether the sandbox has network"})
+	script, _ := json.Marshal(map[string]any{"responses": map[string][]string{"plan": {`{"tasks": ["read the docs"]}`}, "task": {string(solution)}}})
+	path := filepath.Join(t.TempDir(), "fetch.json")
+	if err := os.WriteFile(path, script, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	ts := startServer(t, "empty.json", cassette.NewDeck(cassette.Config{Dir: dir, Record: true}), func(deps *agents.Deps) {
+		deps.LLMs = llm.NewRegistry(llm.Config{Models: map[string]llm.Model{llm.DefaultModel: {Provider: llm.Scripted, Script: path}}})
+		deps.Fetch = fetchHandler.New(fetchHandler.Config{Private: true})
+	})
+	id := postGoal(t, ts, command{Goal: "find out whether the sandbox has network"})
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished || len(status.Planner.TaskHistory) != 1 {
+		t.Fatalf("expected the page to be fetched, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	want := fetchResult(t, status.Planner.TaskHistory[0])
+	if want.Title != "Docs" || want.Result != "# Docs\n\nThe sandbox has no network." {
+		t.Errorf("expected the main content of the page, got %+v", want)
+	}
+
+	// the replay reads the page from the cassette
+	site.Close()
+	player := startServer(t, "empty.json", cassette.NewDeck(cassette.Config{Dir: dir}))
+	status = waitForGoal(t, player, postGoal(t, player, command{Replay: id.String()}))
+	if status.Planner.State != models.Finished || len(status.Planner.TaskHistory) != 1 {
+		t.Fatalf("expected the replay to finish, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	if got := fetchResult(t, status.Planner.TaskHistory[0]); got != want {
+		t.Errorf("expected the replay to reproduce the page, got %+v", got)
+	}
+}
+
+// echoTool is a custom tool, its result is its input
+type echoTool struct{}
+
+type echo struct {
+	taskID string
+	text   string
+}
+
+func (echoTool) Name() string        { return "ECHO" }
+func (echoTool) Description() string { return "says what it's given" }
+func (echoTool) Preference() string  { return "only to say hello" }
+func (echoTool) Inputs() []agents.ToolInput {
+	return []agents.ToolInput{{Name: "Text", Type: "string"}}
+}
+func (echoTool) Output() string { return "Text: string" }
+func (echoTool) Producer(agents.Deps) actor.Producer {
+	return func() actor.Actor {
+		return actor.ReceiveFunc(func(ac actor.Context) {
+			if msg, ok := ac.Message().(echo); ok {
+				ac.Send(ac.Parent(), messages.ToolResult{TaskID: msg.taskID, Result: msg.text})
+				ac.Stop(ac.Self())
+			}
+		})
+	}
+}
+func (echoTool) Start(d agents.Dispatch) any {
+	return echo{taskID: d.Task.ID, text: d.Solution.Inputs[0]}
+}
+
+func TestServer_customTool(t *testing.T) {
+	dir := t.TempDir()
+	ts := startServer(t, "custom_tool.json", cassette.NewDeck(cassette.Config{Dir: dir, Record: true}), func(deps *agents.Deps) {
+		if err := deps.Tools.Register(echoTool{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	id := postGoal(t, ts, command{Goal: "say hello"})
+	status := waitForGoal(t, ts, id)
+	if status.Planner.State != models.Finished || len(status.Planner.TaskHistory) != 1 {
+		t.Fatalf("expected the custom tool to complete the task, got %s with error %+v", status.Planner.State, status.Planner.Errs)
+	}
+	b, _ := json.Marshal(status.Planner.TaskHistory[0].Result)
+	res := messages.ToolResult{}
+	if err := json.Unmarshal(b, &res); err != nil || res.Result != "hello" {
+		t.Errorf("expected the echo to be the result, got %s", b)
+	}
+
+	recorded, err := cassette.NewDeck(cassette.Config{Dir: dir}).Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	described := false
+	for _, i := range recorded.Interactions {
+		if i.Kind == cassette.LLMKind && prompts.Identify(i.Prompt) == prompts.TaskName {
+			described = strings.Contains(i.Prompt, "\t- ECHO\n\t\t- preference: only to say hello\n\t\t- description: says what it's given\n\t\t- interface: Input([Text: string]): Output(Text: string)\n\t- ASK_USER")
+		}
+	}
+	if !described {
+		t.Error("expected the custom tool to be described in the task prompt after the built in ones")
+	}
+}
+
+func TestServer_resetShell(t *testing.T) {
+	reset := func(ts *httptest.Server, id uuid.UUID) int {
+		res, err := http.Post(ts.URL+"/goals/"+id.String()+"/shell/reset", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	ts := startServer(t, "session.json", nil)
+	id := postGoal(t, ts, command{Goal: "a goal without a shell session"})
+	waitForGoal(t, ts, id)
+	if code := reset(ts, id); code != http.StatusConflict {
+		t.Errorf("expected resetting a shell without sessions to conflict, got %d", code)
+	}
+
+	ts = startServer(t, "session.json", nil, func(deps *agents.Deps) {
+		deps.Sessions = handler.NewSessions(deps.Sandbox)
+	})
+	if code := reset(ts, uuid.New()); code != http.StatusNotFound {
+		t.Errorf("expected resetting the shell of an unknown goal to be not found, got %d", code)
+	}
+	id = postGoal(t, ts, command{Goal: "a goal with a shell session"})
+	waitForGoal(t, ts, id)
+	if code := reset(ts, id); code != http.StatusOK {
+		t.Errorf("expected the shell to be reset, got %d", code)
+	}
+}
+
+func startServer(t *testing.T, script string, deck *cassette.Deck, options ...func(deps *agents.Deps)) *httptest.Server {
+	t.Helper()
+	_, ts := newServer(t, script, deck, options...)
+	return ts
+}
+
+func newServer(t *testing.T, script string, deck *cassette.Deck, options ...func(deps *agents.Deps)) (*Server, *httptest.Server) {
+	t.Helper()
+	goals, err := bolt.New(filepath.Join(t.TempDir(), "goals.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	llms := llm.NewRegistry(llm.Config{Models: map[string]llm.Model{
+		llm.DefaultModel: {Provider: llm.Scripted, Script: filepath.Join(testdata, script)},
+	}})
+	if err := llms.Validate("planner", "supervisor", "terminal", "search"); err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := agents.NewToolRegistry(builtin.Tools()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps := agents.Deps{Goals: goals, Events: events.NewBroker(256), LLMs: llms, Cassettes: deck, Usage: usage.NewMeter(goals), Sandbox: handler.UnsafeLocal{}, Tools: tools}
+	for _, option := range options {
+		option(&deps)
+	}
+	s := New(actor.NewActorSystem().Root, deps, models.Budget{}, models.Policy{})
+	ts := httptest.NewServer(s.server.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		_ = goals.Close()
+	})
+	return s, ts
+}
+
+func postGoal(t *testing.T, ts *httptest.Server, cmd command) uuid.UUID {
+	t.Helper()
+	body, _ := json.Marshal(cmd)
+	res, err := http.Post(ts.URL+"/new", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	created := struct {
+		Id uuid.UUID `json:"id"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Id
+}
+
+// waitForGoal polls the status of the goal until it ends
+func waitForGoal(t *testing.T, ts *httptest.Server, id uuid.UUID) models.Status {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := getGoalStatus(ts, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Planner.State.Ended() {
+			return status
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("goal %s didn't end in time", id)
+	return models.Status{}
+}
+
+func getGoalStatus(ts *httptest.Server, id uuid.UUID) (models.Status, error) {
+	res, err := http.Get(ts.URL + "/status/" + id.String())
+	if err != nil {
+		return models.Status{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return models.Status{}, fmt.Errorf("status code %d", res.StatusCode)
+	}
+
+	status := getStatus{}
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return models.Status{}, err
+	}
+	return status.Status, nil
+}
+
+// waitForPending polls the goal until something is waiting on approval
+func waitForPending(t *testing.T, ts *httptest.Server, id uuid.UUID) models.Approval {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending := getPending(t, ts, id); len(pending.Pending) > 0 {
+			return pending.Pending[0]
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("goal %s didn't wait for approval in time", id)
+	return models.Approval{}
+}
+
+// waitForQuestion polls the goal until an agent asks the user a question
+func waitForQuestion(t *testing.T, ts *httptest.Server, id uuid.UUID) models.Question {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending := getPending(t, ts, id); len(pending.Questions) > 0 {
+			return pending.Questions[0]
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("goal %s didn't ask a question in time", id)
+	return models.Question{}
+}
+
+func getPending(t *testing.T, ts *httptest.Server, id uuid.UUID) listPending {
+	t.Helper()
+	res, err := http.Get(ts.URL + "/goals/" + id.String() + "/pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	pending := listPending{}
+	if err := json.NewDecoder(res.Body).Decode(&pending); err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+func postAnswer(t *testing.T, ts *httptest.Server, id uuid.UUID, a answer) int {
+	t.Helper()
+	body, _ := json.Marshal(a)
+	res, err := http.Post(ts.URL+"/goals/"+id.String()+"/answers", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	return res.StatusCode
+}
+
+func postDecision(t *testing.T, ts *httptest.Server, id uuid.UUID, aid string, d decision) int {
+	t.Helper()
+	body, _ := json.Marshal(d)
+	res, err := http.Post(ts.URL+"/goals/"+id.String()+"/approvals/"+aid, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	return res.StatusCode
+}
+
+func getGoal(t *testing.T, ts *httptest.Server, id uuid.UUID) models.Goal {
+	t.Helper()
+	res, err := http.Get(ts.URL + "/goals/" + id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	goal := models.Goal{}
+	if err := json.NewDecoder(res.Body).Decode(&goal); err != nil {
+		t.Fatal(err)
+	}
+	return goal
+}
+
+// budgetLimit checks the goal failed on the limit of its budget
+func budgetLimit(limit models.Limit) func(t *testing.T, status models.Status) {
+	return func(t *testing.T, status models.Status) {
+		b, _ := json.Marshal(status.Planner.Errs.Message)
+		exceeded := models.BudgetExceeded{}
+		if err := json.Unmarshal(b, &exceeded); err != nil || exceeded.Limit != limit {
+			t.Errorf("expected the %s limit to be exceeded, got %s", limit, b)
+		}
+	}
+}
+
+// commandResult converts the result of a task, which is decoded from json as a map, back into a CommandResult
+func fetchResult(t *testing.T, task models.TaskHistory) messages.FetchResult {
+	t.Helper()
+	b, err := json.Marshal(task.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := messages.FetchResult{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func searchResult(t *testing.T, task models.TaskHistory) messages.SearchResult {
+	t.Helper()
+	b, err := json.Marshal(task.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := messages.SearchResult{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// stubSearch finds the same hits whatever the query
+type stubSearch []models.SearchHit
+
+func (s stubSearch) Search(_ context.Context, _ string, _ int) ([]models.SearchHit, error) {
+	return s, nil
+}
+
+func commandResult(t *testing.T, task models.TaskHistory) messages.CommandResult {
+	t.Helper()
+	b, err := json.Marshal(task.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := messages.CommandResult{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
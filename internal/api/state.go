@@ -3,28 +3,39 @@ package api
 import (
 	"github.com/asynkron/protoactor-go/actor"
 	"github.com/google/uuid"
+	"sync"
 )
 
+// requestsCache tracks the planner of each goal running in this process, the goals themselves live in the store
 type requestsCache struct {
+	mu  sync.RWMutex
 	ids map[uuid.UUID]*actor.PID
 }
 
-// todo this should be persistent and thread safe
 func newRequestsCache() *requestsCache {
 	return &requestsCache{
 		ids: map[uuid.UUID]*actor.PID{},
 	}
 }
 
-func (s *requestsCache) remove(id uuid.UUID) {
-	delete(s.ids, id)
+// remove forgets the planner of the goal, unless the goal has been given another planner since
+func (s *requestsCache) remove(id uuid.UUID, pid *actor.PID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.ids[id]; ok && current.Equal(pid) {
+		delete(s.ids, id)
+	}
 }
 
 func (s *requestsCache) add(id uuid.UUID, pid *actor.PID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.ids[id] = pid
 }
 
 func (s *requestsCache) get(id uuid.UUID) (*actor.PID, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	pid, ok := s.ids[id]
 	return pid, ok
 }
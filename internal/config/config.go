@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-autogpt/internal/agents"
+	fetchHandler "go-autogpt/internal/agents/fetch/handler"
+	searchHandler "go-autogpt/internal/agents/search/handler"
+	"go-autogpt/internal/agents/terminal/handler"
+	"go-autogpt/pkg/cassette"
+	"go-autogpt/pkg/llm"
+	"go-autogpt/pkg/models"
+	"os"
+)
+
+// Config is read from a json file, anything left out of the file keeps its default
+type Config struct {
+	LLM       llm.Config            `json:"llm"`
+	Cassettes cassette.Config       `json:"cassettes"`
+	Budget    models.Budget         `json:"budget"` // default budget of every goal, goals can set their own limits
+	Policy    models.Policy         `json:"policy"` // default command policy of every goal, goals can add their own rules
+	Replan    agents.ReplanConfig   `json:"replan"`
+	Approvals agents.ApprovalConfig `json:"approvals"` // off unless configured
+	Terminal  agents.TerminalConfig `json:"terminal"`
+	Search    searchHandler.Config  `json:"search"` // searches fail unless a provider is configured
+	Fetch     fetchHandler.Config   `json:"fetch"`
+}
+
+func Default() Config {
+	return Config{
+		LLM:       llm.DefaultConfig(),
+		Cassettes: cassette.Config{Dir: "cassettes"},
+		Replan:    agents.ReplanConfig{Max: 2},
+		Terminal: agents.TerminalConfig{
+			TimeoutSeconds: 300,
+			MaxOutputBytes: 64 << 10,
+			Sandbox:        handler.SandboxConfig{Backend: handler.LinuxBackend},
+		},
+		Search: searchHandler.Config{TimeoutSeconds: 15},
+		Fetch:  fetchHandler.Config{TimeoutSeconds: 30, MaxBytes: 2 << 20},
+		Policy: models.Policy{
+			Deny:      []string{"sudo", "su", "shutdown", "reboot", "poweroff", "halt", "mkfs"},
+			MaxLength: 4096,
+		},
+	}
+}
+
+// Load reads the config file at path, an empty path returns the defaults
+func Load(path string) (Config, error) {
+	c := Default()
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read: %w", err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("unmarshal: %w", err)
+	}
+	if err := c.Approvals.Validate(); err != nil {
+		return Config{}, fmt.Errorf("approvals: %w", err)
+	}
+	if err := c.Terminal.Sandbox.Validate(); err != nil {
+		return Config{}, fmt.Errorf("sandbox: %w", err)
+	}
+	if err := c.Search.Validate(); err != nil {
+		return Config{}, fmt.Errorf("search: %w", err)
+	}
+	if err := c.Fetch.Validate(); err != nil {
+		return Config{}, fmt.Errorf("fetch: %w", err)
+	}
+	return c, nil
+}
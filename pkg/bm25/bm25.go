@@ -0,0 +1,104 @@
+package bm25
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// parameters of the ranking, k1 is how quickly repeated terms stop counting and b how much longer documents are
+// penalized
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Index ranks the documents added to it against a query with BM25
+type Index struct {
+	documents []map[string]int // count of each term, by document
+	lengths   []int            // of the documents in terms
+	frequency map[string]int   // how many documents each term is in
+	total     int              // terms of all the documents
+}
+
+func New() *Index {
+	return &Index{frequency: map[string]int{}}
+}
+
+// Add indexes a document, its score is at the same position as it was added
+func (i *Index) Add(text string) {
+	document := map[string]int{}
+	length := 0
+	for _, term := range Terms(text) {
+		document[term]++
+		length++
+	}
+	for term := range document {
+		i.frequency[term]++
+	}
+	i.documents = append(i.documents, document)
+	i.lengths = append(i.lengths, length)
+	i.total += length
+}
+
+func (i *Index) Len() int {
+	return len(i.documents)
+}
+
+// Score is how relevant each document is to the query, by the order they were added, zero when it has none of the
+// query's terms
+func (i *Index) Score(query string) []float64 {
+	scores := make([]float64, len(i.documents))
+	if len(i.documents) == 0 {
+		return scores
+	}
+	n := float64(len(i.documents))
+	average := float64(i.total) / n
+	terms := Terms(query)
+	for d, document := range i.documents {
+		for _, term := range terms {
+			tf := float64(document[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(i.frequency[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			scores[d] += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(i.lengths[d])/average))
+		}
+	}
+	return scores
+}
+
+// Terms are the lower cased words and numbers of a text
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Split splits a text into passages of whole paragraphs, each of about words words unless a paragraph is longer
+func Split(text string, words int) []string {
+	passages := make([]string, 0)
+	paragraphs := make([]string, 0)
+	count := 0
+	flush := func() {
+		if len(paragraphs) > 0 {
+			passages = append(passages, strings.Join(paragraphs, "\n\n"))
+		}
+		paragraphs = paragraphs[:0]
+		count = 0
+	}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		paragraphs = append(paragraphs, paragraph)
+		count += len(strings.Fields(paragraph))
+		if count >= words {
+			flush()
+		}
+	}
+	flush()
+	return passages
+}
@@ -0,0 +1,361 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+	"go-autogpt/pkg/goalctx"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	LLMKind     = "llm"
+	CommandKind = "command"
+	SearchKind  = "search"
+	FetchKind   = "fetch"
+)
+
+type Config struct {
+	Dir    string `json:"dir"`
+	Record bool   `json:"record"` // record every new goal
+}
+
+// Cassette is every LLM completion, terminal command, search and fetch of a goal, in the order they happened
+type Cassette struct {
+	GoalID       uuid.UUID     `json:"goalId"`
+	Goal         string        `json:"goal"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Kind       string             `json:"kind"`
+	Agent      string             `json:"agent,omitempty"`
+	Prompt     string             `json:"prompt,omitempty"`
+	Completion string             `json:"completion,omitempty"`
+	Command    string             `json:"command,omitempty"`
+	Output     string             `json:"output,omitempty"` // stdout of the command
+	Stderr     string             `json:"stderr,omitempty"`
+	Truncated  bool               `json:"truncated,omitempty"`
+	Query      string             `json:"query,omitempty"`
+	Hits       []models.SearchHit `json:"hits,omitempty"` // of the query
+	URL        string             `json:"url,omitempty"`
+	Page       *models.Page       `json:"page,omitempty"` // fetched from the url
+	Error      string             `json:"error,omitempty"`
+}
+
+type completionKey struct {
+	agent  string
+	prompt string
+}
+
+// tape is a cassette being replayed, interactions are matched by prompt, command, query or url so the order agents run in
+// doesn't matter
+type tape struct {
+	completions map[completionKey][]string
+	commands    map[string][]Interaction
+	searches    map[string][]Interaction
+	fetches     map[string][]Interaction
+}
+
+// Deck records the goals it's told to record into a cassette file per goal, and replays cassettes onto new goals
+// so a past run can be reproduced exactly
+type Deck struct {
+	mu        sync.Mutex
+	dir       string
+	recordAll bool
+	recording map[uuid.UUID]bool
+	replaying map[uuid.UUID]*tape
+}
+
+func NewDeck(config Config) *Deck {
+	return &Deck{
+		dir:       config.Dir,
+		recordAll: config.Record,
+		recording: map[uuid.UUID]bool{},
+		replaying: map[uuid.UUID]*tape{},
+	}
+}
+
+// header is the first line of a cassette file, each line after it is an interaction
+type header struct {
+	GoalID uuid.UUID `json:"goalId"`
+	Goal   string    `json:"goal"`
+}
+
+// Record starts recording a goal if the deck is set to record, a goal that was recorded before carries on with its
+// existing cassette
+func (d *Deck) Record(id uuid.UUID, goal string) error {
+	if !d.recordAll {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := os.Stat(d.path(id)); errors.Is(err, os.ErrNotExist) {
+		b, err := json.Marshal(header{GoalID: id, Goal: goal})
+		if err == nil {
+			err = os.MkdirAll(d.dir, os.ModePerm)
+		}
+		if err == nil {
+			err = os.WriteFile(d.path(id), append(b, '\n'), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("create cassette: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("stat cassette: %w", err)
+	}
+	d.recording[id] = true
+	return nil
+}
+
+// Replay serves the cassette recorded for the goal from to the goal id instead of calling the LLM and running commands
+func (d *Deck) Replay(id, from uuid.UUID) (Cassette, error) {
+	c, err := d.Load(from)
+	if err != nil {
+		return Cassette{}, err
+	}
+
+	t := &tape{completions: map[completionKey][]string{}, commands: map[string][]Interaction{}, searches: map[string][]Interaction{}, fetches: map[string][]Interaction{}}
+	for _, i := range c.Interactions {
+		switch i.Kind {
+		case LLMKind:
+			k := completionKey{agent: i.Agent, prompt: i.Prompt}
+			t.completions[k] = append(t.completions[k], i.Completion)
+		case CommandKind:
+			t.commands[i.Command] = append(t.commands[i.Command], i)
+		case SearchKind:
+			t.searches[i.Query] = append(t.searches[i.Query], i)
+		case FetchKind:
+			t.fetches[i.URL] = append(t.fetches[i.URL], i)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.replaying[id] = t
+	return c, nil
+}
+
+// Load reads the cassette of a goal, an interaction cut short by a crash while it was recorded is dropped
+func (d *Deck) Load(id uuid.UUID) (Cassette, error) {
+	f, err := os.Open(d.path(id))
+	if err != nil {
+		return Cassette{}, fmt.Errorf("read cassette: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	h := header{}
+	if err := dec.Decode(&h); err != nil {
+		return Cassette{}, fmt.Errorf("unmarshal cassette: %w", err)
+	}
+	c := Cassette{GoalID: h.GoalID, Goal: h.Goal, Interactions: make([]Interaction, 0)}
+	for {
+		i := Interaction{}
+		err := dec.Decode(&i)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return c, nil
+		}
+		if err != nil {
+			return Cassette{}, fmt.Errorf("unmarshal cassette: %w", err)
+		}
+		c.Interactions = append(c.Interactions, i)
+	}
+}
+
+// Eject stops recording or replaying a goal
+func (d *Deck) Eject(id uuid.UUID) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.recording, id)
+	delete(d.replaying, id)
+}
+
+// LLM wraps the LLM of an agent so its completions are recorded or replayed for the goal of each call's context
+func (d *Deck) LLM(agent string, next llms.LLM) llms.LLM {
+	return &cassetteLLM{deck: d, agent: agent, next: next}
+}
+
+// Command records or replays a terminal command for the goal of the context, run is only called when not replaying
+func (d *Deck) Command(ctx context.Context, command string, run func() (models.CommandOutput, error)) (models.CommandOutput, error) {
+	if d == nil {
+		return run()
+	}
+	id := goalctx.ID(ctx)
+	if t, ok := d.tape(id); ok {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		recorded := t.commands[command]
+		if len(recorded) == 0 {
+			return models.CommandOutput{}, fmt.Errorf("cassette: no recorded run of command %q", command)
+		}
+		t.commands[command] = recorded[1:]
+		out := models.CommandOutput{Stdout: recorded[0].Output, Stderr: recorded[0].Stderr, Truncated: recorded[0].Truncated}
+		if recorded[0].Error != "" {
+			return out, errors.New(recorded[0].Error)
+		}
+		return out, nil
+	}
+
+	out, err := run()
+	i := Interaction{Kind: CommandKind, Command: command, Output: out.Stdout, Stderr: out.Stderr, Truncated: out.Truncated}
+	if err != nil {
+		i.Error = err.Error()
+	}
+	d.record(id, i)
+	return out, err
+}
+
+// Search records or replays a search for the goal of the context, run is only called when not replaying
+func (d *Deck) Search(ctx context.Context, query string, run func() ([]models.SearchHit, error)) ([]models.SearchHit, error) {
+	if d == nil {
+		return run()
+	}
+	id := goalctx.ID(ctx)
+	if t, ok := d.tape(id); ok {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		recorded := t.searches[query]
+		if len(recorded) == 0 {
+			return nil, fmt.Errorf("cassette: no recorded search for %q", query)
+		}
+		t.searches[query] = recorded[1:]
+		if recorded[0].Error != "" {
+			return recorded[0].Hits, errors.New(recorded[0].Error)
+		}
+		return recorded[0].Hits, nil
+	}
+
+	hits, err := run()
+	i := Interaction{Kind: SearchKind, Query: query, Hits: hits}
+	if err != nil {
+		i.Error = err.Error()
+	}
+	d.record(id, i)
+	return hits, err
+}
+
+// Fetch records or replays a fetched page for the goal of the context, run is only called when not replaying
+func (d *Deck) Fetch(ctx context.Context, url string, run func() (models.Page, error)) (models.Page, error) {
+	if d == nil {
+		return run()
+	}
+	id := goalctx.ID(ctx)
+	if t, ok := d.tape(id); ok {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		recorded := t.fetches[url]
+		if len(recorded) == 0 {
+			return models.Page{}, fmt.Errorf("cassette: no recorded fetch of %q", url)
+		}
+		t.fetches[url] = recorded[1:]
+		page := models.Page{}
+		if recorded[0].Page != nil {
+			page = *recorded[0].Page
+		}
+		if recorded[0].Error != "" {
+			return page, errors.New(recorded[0].Error)
+		}
+		return page, nil
+	}
+
+	page, err := run()
+	i := Interaction{Kind: FetchKind, URL: url, Page: &page}
+	if err != nil {
+		i.Error = err.Error()
+	}
+	d.record(id, i)
+	return page, err
+}
+
+func (d *Deck) tape(id uuid.UUID) (*tape, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.replaying[id]
+	return t, ok
+}
+
+// record appends a line to the goal's cassette if it is being recorded, so a crash loses nothing
+func (d *Deck) record(id uuid.UUID, i Interaction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.recording[id] {
+		return
+	}
+
+	b, err := json.Marshal(i)
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to record cassette")
+		return
+	}
+	f, err := os.OpenFile(d.path(id), os.O_APPEND|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.Write(append(b, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		// recording is best effort, it shouldn't fail the goal
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to record cassette")
+	}
+}
+
+func (d *Deck) path(id uuid.UUID) string {
+	return filepath.Join(d.dir, id.String()+".jsonl")
+}
+
+type cassetteLLM struct {
+	deck  *Deck
+	agent string
+	next  llms.LLM
+}
+
+func (c *cassetteLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	r, err := c.Generate(ctx, []string{prompt}, options...)
+	if err != nil {
+		return "", err
+	}
+	return r[0].Text, nil
+}
+
+func (c *cassetteLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	id := goalctx.ID(ctx)
+	if t, ok := c.deck.tape(id); ok {
+		c.deck.mu.Lock()
+		defer c.deck.mu.Unlock()
+		generations := make([]*llms.Generation, 0, len(prompts))
+		for _, prompt := range prompts {
+			k := completionKey{agent: c.agent, prompt: prompt}
+			recorded := t.completions[k]
+			if len(recorded) == 0 {
+				return nil, fmt.Errorf("cassette: no recorded completion for this prompt of the %s agent", c.agent)
+			}
+			t.completions[k] = recorded[1:]
+			generations = append(generations, &llms.Generation{Text: recorded[0]})
+		}
+		return generations, nil
+	}
+
+	generations, err := c.next.Generate(ctx, prompts, options...)
+	if err != nil {
+		return nil, err
+	}
+	for i, g := range generations {
+		c.deck.record(id, Interaction{Kind: LLMKind, Agent: c.agent, Prompt: prompts[i], Completion: g.Text})
+	}
+	return generations, nil
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"go-autogpt/pkg/prompts"
+	"go-autogpt/pkg/template"
+)
+
+// MaxRepairs is how many times the LLM is asked to fix an answer that can't be parsed
+const MaxRepairs = 2 // todo add as a config
+
+// Extractor parses structured answers, asking the LLM to repair an answer when it can't be parsed
+type Extractor struct {
+	llm        llms.LLM
+	maxRepairs int
+}
+
+func NewExtractor(llm llms.LLM) *Extractor {
+	return &Extractor{
+		llm:        llm,
+		maxRepairs: MaxRepairs,
+	}
+}
+
+type repairInput struct {
+	Answer  string
+	Problem string
+	Schema  string
+}
+
+// Extract parses the answer into v, see Parse, re-prompting the LLM with the problem until it gives a valid answer or
+// runs out of repairs, in which case the error from the last answer is returned. The error of a repair the LLM fails is
+// wrapped along with it.
+func (e *Extractor) Extract(ctx context.Context, answer string, schema *Schema, v any) error {
+	err := Parse(answer, schema, v)
+	for repairs := 0; err != nil && repairs < e.maxRepairs; repairs++ {
+		prompt, pErr := template.Parse(prompts.RepairTemplate, repairInput{Answer: answer, Problem: err.Error(), Schema: schema.Text})
+		if pErr != nil {
+			return fmt.Errorf("execute: %w", pErr)
+		}
+		repaired, cErr := e.llm.Call(ctx, prompt)
+		if cErr != nil {
+			return fmt.Errorf("%w, repair: %w", err, cErr)
+		}
+		answer = repaired
+		err = Parse(answer, schema, v)
+	}
+	return err
+}
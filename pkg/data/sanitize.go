@@ -1,15 +1,161 @@
 package data
 
 import (
+	"encoding/json"
 	"errors"
-	"regexp"
+	"strings"
 )
 
+var ErrSanitize = errors.New("error sanitizing answer")
+
+// SanitizeAnswer returns the first balanced json object in an answer as valid json, or the first array if it has no
+// object as every answer asked for is an object. Answers are often wrapped in prose or code fences and are loose with
+// the syntax, so single quoted strings, trailing commas, missing commas between values and raw control characters or
+// invalid escapes in strings are repaired
 func SanitizeAnswer(ans string) (string, error) {
-	re := regexp.MustCompile(`\{[^{}]*\}`)
-	match := re.FindString(ans)
-	if match == "" {
-		return "", errors.New("error sanitizing answer")
+	for _, text := range candidates(ans) {
+		for _, open := range []rune{'{', '['} {
+			for i, c := range text {
+				if c != open {
+					continue
+				}
+				value, ok := scan(text[i:])
+				if ok && json.Valid([]byte(value)) {
+					return value, nil
+				}
+			}
+		}
+	}
+	return "", ErrSanitize
+}
+
+// candidates are the texts to search for json, the contents of any code fences first and then the whole answer
+func candidates(ans string) []string {
+	res := make([]string, 0)
+	rest := ans
+	for {
+		_, after, found := strings.Cut(rest, "```")
+		if !found {
+			break
+		}
+		block, next, closed := strings.Cut(after, "```")
+		if lang, body, ok := strings.Cut(block, "\n"); ok && !strings.ContainsAny(lang, "{[") {
+			block = body // drop the language of the fence, e.g. ```json
+		}
+		res = append(res, block)
+		if !closed {
+			break
+		}
+		rest = next
+	}
+	return append(res, ans)
+}
+
+// scan repairs the json value at the start of text up to where it's balanced, it returns false if the value never
+// closes
+func scan(text string) (string, bool) {
+	var b strings.Builder
+	out := make([]byte, 0, len(text))
+	depth := 0
+	value, valueEnd := false, 0 // a value has just ended, so the next one needs a comma
+	comma, commaAt := false, 0  // a comma that is dropped if it turns out to be trailing
+
+	// separate adds the missing comma after the last value before the next one starts
+	separate := func() {
+		if value && !comma {
+			out = append(out[:valueEnd], append([]byte{','}, out[valueEnd:]...)...)
+		}
+		comma, value = false, false
+	}
+	ended := func() {
+		value, valueEnd = true, len(out)
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"' || c == '\'':
+			separate()
+			b.Reset()
+			end, ok := quote(&b, text, i)
+			if !ok {
+				return "", false
+			}
+			out = append(out, b.String()...)
+			i = end
+			ended()
+		case c == '{' || c == '[':
+			separate()
+			out = append(out, c)
+			depth++
+		case c == '}' || c == ']':
+			if comma {
+				out = append(out[:commaAt], out[commaAt+1:]...)
+			}
+			comma = false
+			out = append(out, c)
+			ended()
+			depth--
+			if depth == 0 {
+				return string(out), true
+			}
+		case c == ',':
+			out = append(out, c)
+			comma, commaAt, value = true, len(out)-1, false
+		case c == ':':
+			comma, value = false, false
+			out = append(out, c)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			out = append(out, c)
+		default: // numbers and literals
+			separate()
+			j := i
+			for j < len(text) && !strings.ContainsRune("{}[]:,\"' \t\n\r", rune(text[j])) {
+				j++
+			}
+			out = append(out, text[i:j]...)
+			i = j - 1
+			ended()
+		}
+	}
+	return "", false
+}
+
+// quote writes the string starting at text[start] as a double quoted json string and returns the index of its
+// closing quote
+func quote(b *strings.Builder, text string, start int) (int, bool) {
+	delim := text[start]
+	b.WriteByte('"')
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == delim:
+			b.WriteByte('"')
+			return i, true
+		case c == '\\' && i+1 < len(text):
+			i++
+			next := text[i]
+			switch {
+			case next == '\'':
+				b.WriteByte('\'')
+			case strings.IndexByte(`"\/bfnrtu`, next) >= 0:
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			default: // e.g. \$ in a shell command
+				b.WriteString(`\\`)
+				b.WriteByte(next)
+			}
+		case c == '"':
+			b.WriteString(`\"`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
 	}
-	return match, nil
+	return 0, false
 }
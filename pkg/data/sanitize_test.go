@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/tmc/langchaingo/llms"
+	"testing"
+)
+
+func TestSanitizeAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		ans  string
+		want string
+		err  bool
+	}{
+		{name: "plain", ans: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "prose around the json", ans: "Sure, here it is: {\"a\": 1} hope that helps", want: `{"a": 1}`},
+		{name: "nested objects", ans: `{"a": {"b": [1, {"c": 2}]}}`, want: `{"a": {"b": [1, {"c": 2}]}}`},
+		{name: "braces inside strings", ans: `{"command": "echo ${HOME} }"}`, want: `{"command": "echo ${HOME} }"}`},
+		{name: "code fence", ans: "```json\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{name: "fence is preferred over prose braces", ans: "use {curly} braces\n```\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{name: "trailing commas", ans: `{"a": [1, 2,], "b": 3,}`, want: `{"a": [1, 2], "b": 3}`},
+		{name: "single quotes", ans: `{'a': 'it\'s "quoted"'}`, want: `{"a": "it's \"quoted\""}`},
+		{name: "missing comma", ans: "{\"a\": \"x\"\n\"b\": \"y\"}", want: "{\"a\": \"x\",\n\"b\": \"y\"}"},
+		{name: "raw newline and invalid escape in a string", ans: "{\"a\": \"x\ny \\$\"}", want: `{"a": "x\ny \\$"}`},
+		{name: "skips braces that aren't json", ans: `{not json} {"a": true}`, want: `{"a": true}`},
+		{name: "array", ans: `the tasks are ["a", "b"]`, want: `["a", "b"]`},
+		{name: "object is preferred over a prose array", ans: `Options: ["a","b"] so I pick {"tool": "TERMINAL"}`, want: `{"tool": "TERMINAL"}`},
+		{name: "no json", ans: "I'm not sure", err: true},
+		{name: "unbalanced", ans: `{"a": [1, 2}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SanitizeAnswer(tt.ans)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+type repairLLM struct {
+	responses []string
+	calls     int
+}
+
+func (r *repairLLM) Call(_ context.Context, _ string, _ ...llms.CallOption) (string, error) {
+	if r.calls >= len(r.responses) {
+		return "", errors.New("no response")
+	}
+	r.calls++
+	return r.responses[r.calls-1], nil
+}
+
+func (r *repairLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestExtractor_Extract(t *testing.T) {
+	tests := []struct {
+		name      string
+		answer    string
+		responses []string
+		calls     int
+		err       bool
+	}{
+		{name: "valid answer isn't repaired", answer: `{"command": "ls", "reason": "list"}`},
+		{name: "schema violation is repaired", answer: `{"reason": "list"}`, responses: []string{`{"command": "ls"}`}, calls: 1},
+		{name: "repairs are bounded", answer: `nope`, responses: []string{`still`, `no`, `{"command": "ls"}`}, calls: MaxRepairs, err: true},
+		{name: "failed repair keeps the error", answer: `nope`, calls: 0, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &repairLLM{responses: tt.responses}
+			res := struct {
+				Command string `json:"command"`
+			}{}
+			err := NewExtractor(llm).Extract(context.Background(), tt.answer, DiagnoseSchema, &res)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if llm.calls != tt.calls {
+				t.Errorf("expected %d repairs, got %d", tt.calls, llm.calls)
+			}
+			if !tt.err && res.Command != "ls" {
+				t.Errorf("expected the command to be parsed, got %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Schema is the json schema an answer to a prompt must match
+type Schema struct {
+	Name     string
+	Text     string
+	compiled *jsonschema.Schema
+}
+
+var (
+	PlanSchema = MustCompileSchema("plan", `{
+    "type": "object",
+    "required": ["tasks"],
+    "properties": {
+        "tasks": {"type": "array", "items": {"oneOf": [
+            {"type": "string"},
+            {
+                "type": "object",
+                "required": ["task"],
+                "properties": {
+                    "id": {"type": "string"},
+                    "task": {"type": "string", "minLength": 1},
+                    "depends_on": {"type": "array", "items": {"type": "string"}},
+                    "artifacts": {"type": "array", "items": {"type": "string"}}
+                }
+            }
+        ]}}
+    }
+}`)
+
+	SolutionSchema = MustCompileSchema("solution", `{
+    "type": "object",
+    "required": ["tool", "inputs"],
+    "properties": {
+        "tool": {"type": "string", "minLength": 1},
+        "inputs": {"type": "array", "minItems": 1, "items": {"type": "string"}},
+        "reasoning": {"type": "string"},
+        "limitations": {"type": "string"},
+        "outcome": {"type": "string"}
+    }
+}`)
+
+	VerifySchema = MustCompileSchema("verify", `{
+    "type": "object",
+    "required": ["matches"],
+    "properties": {
+        "matches": {"type": "boolean"},
+        "reason": {"type": "string"}
+    }
+}`)
+
+	DiagnoseSchema = MustCompileSchema("diagnose", `{
+    "type": "object",
+    "anyOf": [
+        {"required": ["command"]},
+        {"required": ["question"]}
+    ],
+    "properties": {
+        "command": {"type": "string", "minLength": 1},
+        "question": {"type": "string", "minLength": 1},
+        "reason": {"type": "string"}
+    }
+}`)
+)
+
+func MustCompileSchema(name, text string) *Schema {
+	return &Schema{Name: name, Text: text, compiled: jsonschema.MustCompileString(name+".json", text)}
+}
+
+// Parse sanitizes the answer, validates it against the schema and unmarshals it into v
+func Parse(answer string, schema *Schema, v any) error {
+	match, err := SanitizeAnswer(answer)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(match), &doc); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	if err := schema.compiled.Validate(doc); err != nil {
+		return fmt.Errorf("answer doesn't match the %s schema: %w", schema.Name, err)
+	}
+	if err := json.Unmarshal([]byte(match), v); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	return nil
+}
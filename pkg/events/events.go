@@ -0,0 +1,188 @@
+package events
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	PlanCreated       Type = "plan_created"
+	PlanRevised       Type = "plan_revised"
+	TaskDispatched    Type = "task_dispatched"
+	ToolChosen        Type = "tool_chosen"
+	CommandStarted    Type = "command_started"
+	CommandLine       Type = "command_line" // streamed as the command runs
+	CommandOutput     Type = "command_output"
+	DiagnosisAttempt  Type = "diagnosis_attempt"
+	SearchResults     Type = "search_results"
+	PageFetched       Type = "page_fetched"
+	TaskResult        Type = "task_result"
+	ApprovalRequested Type = "approval_requested"
+	ApprovalDecided   Type = "approval_decided"
+	QuestionAsked     Type = "question_asked"
+	QuestionAnswered  Type = "question_answered"
+	Error             Type = "error"
+	Finished          Type = "finished" // last event of a goal, whatever state it ended in
+)
+
+// Event is a step of a goal as it progresses, Data is the message the agents exchanged for that step
+type Event struct {
+	ID     int       `json:"id"` // sequence of the event within its goal
+	GoalID uuid.UUID `json:"goalId"`
+	Type   Type      `json:"type"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data,omitempty"`
+}
+
+const subscriberBuffer = 64
+
+// endedTTL is how long the last event of an ended goal is kept for late subscribers, after that they're answered from
+// the goal's state in the store
+const endedTTL = 10 * time.Minute // todo add as a config
+
+// idleTTL is how long the backlog of a goal nobody is subscribed to is kept after its last event, for goals that don't
+// end in this process, e.g. paused or waiting on an approval
+const idleTTL = time.Hour // todo add as a config
+
+// sweepInterval is how often publishing looks for backlogs to expire, at most
+const sweepInterval = time.Minute
+
+// Broker fans events out to the subscribers of a goal and keeps a bounded backlog for late subscribers. Events are
+// only kept in memory, their sequences start again in each process, which is told apart by the broker's epoch.
+type Broker struct {
+	mu          sync.Mutex
+	epoch       string
+	backlogSize int
+	backlogs    map[uuid.UUID][]Event
+	sequences   map[uuid.UUID]int // kept once the backlog expires, so a goal's sequence never goes back
+	subscribers map[uuid.UUID]map[chan Event]struct{}
+	ended       map[uuid.UUID]Event // the Finished event of goals that ended within the ttl
+	ttl         time.Duration
+	idleTTL     time.Duration
+	swept       time.Time
+}
+
+func NewBroker(backlogSize int) *Broker {
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		backlogSize: backlogSize,
+		backlogs:    map[uuid.UUID][]Event{},
+		sequences:   map[uuid.UUID]int{},
+		subscribers: map[uuid.UUID]map[chan Event]struct{}{},
+		ended:       map[uuid.UUID]Event{},
+		ttl:         endedTTL,
+		idleTTL:     idleTTL,
+	}
+}
+
+// LastEventID is the id of the event to resume a stream after, the event's sequence prefixed by the broker's epoch
+func (b *Broker) LastEventID(event Event) string {
+	return fmt.Sprintf("%s-%d", b.epoch, event.ID)
+}
+
+// After is the sequence of the event a client last received, from its last event id. An id of an earlier process is
+// before every event of this one.
+func (b *Broker) After(lastEventID string) int {
+	epoch, sequence, ok := strings.Cut(lastEventID, "-")
+	if !ok || epoch != b.epoch {
+		return 0
+	}
+	id, _ := strconv.Atoi(sequence)
+	return id
+}
+
+// expire forgets the goals that ended more than the ttl ago, and the backlogs of goals nobody is subscribed to that
+// have been idle for longer than the idle ttl. The caller holds the lock.
+func (b *Broker) expire(now time.Time) {
+	b.swept = now
+	for id, event := range b.ended {
+		if now.Sub(event.Time) > b.ttl {
+			delete(b.ended, id)
+		}
+	}
+	for id, backlog := range b.backlogs {
+		if len(b.subscribers[id]) == 0 && len(backlog) > 0 && now.Sub(backlog[len(backlog)-1].Time) > b.idleTTL {
+			delete(b.backlogs, id)
+		}
+	}
+}
+
+// Publish sends an event to every subscriber of the goal, slow subscribers miss events rather than block the agents.
+// Publishing Finished closes the goal's subscriptions.
+func (b *Broker) Publish(id uuid.UUID, t Type, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.ended[id]; ok {
+		return
+	}
+
+	b.sequences[id]++
+	event := Event{ID: b.sequences[id], GoalID: id, Type: t, Time: time.Now(), Data: data}
+	if event.Time.Sub(b.swept) >= sweepInterval {
+		b.expire(event.Time)
+	}
+	for ch := range b.subscribers[id] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	if t == Finished {
+		for ch := range b.subscribers[id] {
+			close(ch)
+		}
+		delete(b.subscribers, id)
+		delete(b.backlogs, id)
+		delete(b.sequences, id)
+		b.expire(event.Time)
+		b.ended[id] = event
+		return
+	}
+
+	backlog := append(b.backlogs[id], event)
+	if len(backlog) > b.backlogSize {
+		backlog = backlog[len(backlog)-b.backlogSize:]
+	}
+	b.backlogs[id] = backlog
+}
+
+// Subscribe returns the events published so far and a channel of the ones to come, the channel is closed once the goal
+// finishes. The returned func must be called to unsubscribe.
+func (b *Broker) Subscribe(id uuid.UUID) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(time.Now())
+	ch := make(chan Event, subscriberBuffer)
+	if event, ok := b.ended[id]; ok {
+		close(ch)
+		return []Event{event}, ch, func() {}
+	}
+
+	backlog := append([]Event{}, b.backlogs[id]...)
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = map[chan Event]struct{}{}
+	}
+	b.subscribers[id][ch] = struct{}{}
+
+	return backlog, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if subs, ok := b.subscribers[id]; ok {
+			if _, ok := subs[ch]; ok {
+				delete(subs, ch)
+				close(ch)
+			}
+			if len(subs) == 0 {
+				delete(b.subscribers, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestBroker_ended(t *testing.T) {
+	b := NewBroker(8)
+	id := uuid.New()
+	b.Publish(id, PlanCreated, nil)
+	b.Publish(id, Finished, nil)
+	b.Publish(id, TaskResult, nil) // after the goal ended
+
+	backlog, live, _ := b.Subscribe(id)
+	if len(backlog) != 1 || backlog[0].Type != Finished || backlog[0].ID != 2 {
+		t.Fatalf("expected the Finished event of the ended goal, got %+v", backlog)
+	}
+	if _, ok := <-live; ok {
+		t.Fatal("expected the subscription of an ended goal to be closed")
+	}
+
+	b.ttl = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	backlog, _, unsubscribe := b.Subscribe(id)
+	unsubscribe()
+	if len(backlog) != 0 || len(b.ended) != 0 || len(b.subscribers) != 0 {
+		t.Fatalf("expected the ended goal to expire, got %+v", backlog)
+	}
+}
+
+func TestBroker_lastEventID(t *testing.T) {
+	b := NewBroker(8)
+	id := uuid.New()
+	b.Publish(id, PlanCreated, nil)
+	b.Publish(id, TaskResult, nil)
+	backlog, _, unsubscribe := b.Subscribe(id)
+	unsubscribe()
+
+	if after := b.After(b.LastEventID(backlog[0])); after != 1 {
+		t.Fatalf("expected to resume after the first event, got %d", after)
+	}
+	restarted := NewBroker(8)
+	restarted.epoch = b.epoch + "0"
+	if after := restarted.After(b.LastEventID(backlog[1])); after != 0 {
+		t.Fatalf("expected an id of an earlier process to resume from the start, got %d", after)
+	}
+	for _, lastEventID := range []string{"", "2", "nonsense"} {
+		if after := b.After(lastEventID); after != 0 {
+			t.Fatalf("expected %q to resume from the start, got %d", lastEventID, after)
+		}
+	}
+}
+
+func TestBroker_idle(t *testing.T) {
+	b := NewBroker(8)
+	idle, followed := uuid.New(), uuid.New()
+	b.Publish(idle, PlanCreated, nil)
+	b.Publish(followed, PlanCreated, nil)
+	_, _, unsubscribe := b.Subscribe(followed)
+	defer unsubscribe()
+
+	b.idleTTL = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	backlog, _, unsubscribeIdle := b.Subscribe(idle)
+	unsubscribeIdle()
+	if len(backlog) != 0 {
+		t.Fatalf("expected the backlog of the idle goal to expire, got %+v", backlog)
+	}
+	if len(b.backlogs[followed]) != 1 {
+		t.Fatalf("expected the backlog of a followed goal to be kept, got %+v", b.backlogs[followed])
+	}
+
+	b.Publish(idle, TaskResult, nil)
+	if backlog := b.backlogs[idle]; len(backlog) != 1 || backlog[0].ID != 2 {
+		t.Fatalf("expected the sequence of the idle goal to go on, got %+v", backlog)
+	}
+}
@@ -0,0 +1,32 @@
+package goalctx
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type key struct{}
+
+type taskKey struct{}
+
+// With scopes a context to a goal, so calls made on behalf of the goal such as to an LLM can be attributed to it
+func With(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// ID returns the goal the context is scoped to, or uuid.Nil
+func ID(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(key{}).(uuid.UUID)
+	return id
+}
+
+// WithTask scopes a context to the id of the task of the goal it's working on
+func WithTask(ctx context.Context, task string) context.Context {
+	return context.WithValue(ctx, taskKey{}, task)
+}
+
+// Task returns the id of the task the context is scoped to, or an empty string
+func Task(ctx context.Context) string {
+	task, _ := ctx.Value(taskKey{}).(string)
+	return task
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"github.com/tmc/langchaingo/llms"
+	"sync"
+)
+
+// FakeLLM answers with canned responses in order, repeating the last one once they run out
+type FakeLLM struct {
+	mu        sync.Mutex
+	responses []string
+	turn      int
+}
+
+var _ llms.LLM = (*FakeLLM)(nil)
+
+func NewFake(model Model) (llms.LLM, error) {
+	if len(model.Responses) == 0 {
+		return nil, errors.New("fake needs at least one response")
+	}
+	return &FakeLLM{responses: model.Responses}, nil
+}
+
+func (f *FakeLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := f.responses[len(f.responses)-1]
+	if f.turn < len(f.responses) {
+		res = f.responses[f.turn]
+	}
+	f.turn++
+	return res, nil
+}
+
+func (f *FakeLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	generations := make([]*llms.Generation, 0, len(prompts))
+	for _, prompt := range prompts {
+		text, err := f.Call(ctx, prompt, options...)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, &llms.Generation{Text: text, GenerationInfo: usageInfo(Fake, 0, 0)})
+	}
+	return generations, nil
+}
@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	OpenAI   = "openai"   // an OpenAI compatible HTTP endpoint
+	Ollama   = "ollama"   // a local Ollama compatible server
+	LlamaCpp = "llamacpp" // a local llama.cpp server
+	Fake     = "fake"     // canned responses, for running without a real model
+	Scripted = "script"   // responses scripted per prompt template and turn, for deterministic runs
+
+	// DefaultModel is used by any agent that isn't given a model of its own
+	DefaultModel = "default"
+)
+
+// defaultTimeout is how long a call to a provider's server can take when its model doesn't say
+const defaultTimeout = 2 * time.Minute
+
+// Model is a named model configuration an agent can be given
+type Model struct {
+	Provider    string   `json:"provider"`
+	BaseURL     string   `json:"baseUrl,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	APIKey      string   `json:"apiKey,omitempty"`
+	Chat        bool     `json:"chat,omitempty"` // use the chat completions endpoint of an OpenAI compatible provider
+	Temperature float64  `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Responses   []string `json:"responses,omitempty"` // for the fake provider
+	Script      string   `json:"script,omitempty"`    // path to the script of the script provider
+	// TimeoutSeconds is how long a call to the provider's server can take, defaults to 2 minutes
+	TimeoutSeconds float64 `json:"timeoutSeconds,omitempty"`
+
+	// dollars per 1,000 tokens, defaults to the list price of known OpenAI models
+	PromptPrice     float64 `json:"promptPrice,omitempty"`
+	CompletionPrice float64 `json:"completionPrice,omitempty"`
+}
+
+// prices are the dollars per 1,000 prompt and completion tokens of known models
+var prices = map[string][2]float64{
+	"text-davinci-003":  {0.02, 0.02},
+	"text-davinci-002":  {0.02, 0.02},
+	"gpt-3.5-turbo":     {0.0015, 0.002},
+	"gpt-3.5-turbo-16k": {0.003, 0.004},
+	"gpt-4":             {0.03, 0.06},
+	"gpt-4-32k":         {0.06, 0.12},
+}
+
+// Name is the name of the model the provider serves, used to label usage
+func (m Model) Name() string {
+	if m.Model != "" {
+		return m.Model
+	}
+	if m.Provider == OpenAI {
+		return defaultOpenAIModel
+	}
+	return m.Provider
+}
+
+// Timeout is how long a call to the provider's server can take
+func (m Model) Timeout() time.Duration {
+	if m.TimeoutSeconds <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(m.TimeoutSeconds * float64(time.Second))
+}
+
+// httpClient is the client of the providers that call a server, a hung server fails the call rather than the agent
+// waiting on it forever
+func (m Model) httpClient() *http.Client {
+	return &http.Client{Timeout: m.Timeout()}
+}
+
+// Cost estimates the dollars spent on a call from its tokens
+func (m Model) Cost(promptTokens, completionTokens int) float64 {
+	prompt, completion := m.PromptPrice, m.CompletionPrice
+	if prompt == 0 && completion == 0 && m.Provider == OpenAI {
+		known := prices[m.Name()]
+		prompt, completion = known[0], known[1]
+	}
+	return (float64(promptTokens)*prompt + float64(completionTokens)*completion) / 1000
+}
+
+// Config maps model names to their configuration, and agents to the name of the model they use
+type Config struct {
+	Models map[string]Model  `json:"models"`
+	Agents map[string]string `json:"agents"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Models: map[string]Model{DefaultModel: {Provider: OpenAI}},
+		Agents: map[string]string{},
+	}
+}
+
+// Factory builds an LLM for a model of its provider
+type Factory func(model Model) (llms.LLM, error)
+
+// Registry builds the LLM of each agent from its configured model, models are built once and shared between agents
+type Registry struct {
+	mu        sync.Mutex
+	config    Config
+	providers map[string]Factory
+	built     map[string]llms.LLM
+}
+
+func NewRegistry(config Config) *Registry {
+	r := &Registry{
+		config:    config,
+		providers: map[string]Factory{},
+		built:     map[string]llms.LLM{},
+	}
+	r.RegisterProvider(OpenAI, NewOpenAI)
+	r.RegisterProvider(Ollama, NewOllama)
+	r.RegisterProvider(LlamaCpp, NewLlamaCpp)
+	r.RegisterProvider(Fake, NewFake)
+	r.RegisterProvider(Scripted, NewScript)
+	return r
+}
+
+// RegisterProvider adds or replaces the factory for a provider
+func (r *Registry) RegisterProvider(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = factory
+}
+
+// ForAgent returns the LLM of the model configured for the agent, falling back to the default model
+func (r *Registry) ForAgent(agent string) (llms.LLM, error) {
+	return r.Model(r.modelName(agent))
+}
+
+// AgentModel returns the configuration of the model the agent uses
+func (r *Registry) AgentModel(agent string) Model {
+	return r.config.Models[r.modelName(agent)]
+}
+
+func (r *Registry) modelName(agent string) string {
+	if name, ok := r.config.Agents[agent]; ok {
+		return name
+	}
+	return DefaultModel
+}
+
+// Model returns the LLM for a named model
+func (r *Registry) Model(name string) (llms.LLM, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if llm, ok := r.built[name]; ok {
+		return llm, nil
+	}
+
+	model, ok := r.config.Models[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q", name)
+	}
+	factory, ok := r.providers[model.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q for model %q", model.Provider, name)
+	}
+	llm, err := factory(model)
+	if err != nil {
+		return nil, fmt.Errorf("model %q: %w", name, err)
+	}
+	r.built[name] = llm
+	return llm, nil
+}
+
+// Validate builds the model of every configured agent so misconfiguration is caught at startup
+func (r *Registry) Validate(agents ...string) error {
+	for _, agent := range agents {
+		if _, err := r.ForAgent(agent); err != nil {
+			return fmt.Errorf("agent %s: %w", agent, err)
+		}
+	}
+	return nil
+}
+
+// Unavailable is an LLM that fails every call, agents are given it when their model can't be built so the error
+// surfaces on the goal rather than crashing the actor
+type Unavailable struct {
+	Err error
+}
+
+func (u Unavailable) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", u.Err
+}
+
+func (u Unavailable) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	return nil, u.Err
+}
+
+// callOptions applies the options of a call on top of the model's configuration
+func callOptions(model Model, options []llms.CallOption) llms.CallOptions {
+	opts := llms.CallOptions{
+		Model:       model.Model,
+		MaxTokens:   model.MaxTokens,
+		Temperature: model.Temperature,
+		StopWords:   model.Stop,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return opts
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestModel_Timeout(t *testing.T) {
+	hung := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer ts.Close()
+	defer close(hung)
+
+	for _, factory := range []Factory{NewOpenAI, NewOllama, NewLlamaCpp} {
+		llm, err := factory(Model{BaseURL: ts.URL, Model: "hung", TimeoutSeconds: 0.1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if _, err := llm.Call(context.Background(), "hello"); err == nil {
+			t.Errorf("%T: expected the call to a hung server to fail", llm)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%T: the call took %s", llm, elapsed)
+		}
+	}
+
+	if timeout := (Model{}).Timeout(); timeout != defaultTimeout {
+		t.Errorf("Timeout() = %s, want %s", timeout, defaultTimeout)
+	}
+}
@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultOllamaURL   = "http://localhost:11434"
+	defaultLlamaCppURL = "http://localhost:8081"
+)
+
+// OllamaClient talks to an Ollama compatible /api/generate endpoint
+type OllamaClient struct {
+	model  Model
+	client *http.Client
+}
+
+var _ llms.LLM = (*OllamaClient)(nil)
+
+func NewOllama(model Model) (llms.LLM, error) {
+	if model.Model == "" {
+		return nil, errors.New("ollama needs a model")
+	}
+	if model.BaseURL == "" {
+		model.BaseURL = defaultOllamaURL
+	}
+	return &OllamaClient{model: model, client: model.httpClient()}, nil
+}
+
+type ollamaRequest struct {
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	Stream  bool          `json:"stream"`
+	Options ollamaOptions `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature float64  `json:"temperature"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type ollamaResponse struct {
+	Response        string `json:"response"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (o *OllamaClient) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	r, err := o.Generate(ctx, []string{prompt}, options...)
+	if err != nil {
+		return "", err
+	}
+	return r[0].Text, nil
+}
+
+func (o *OllamaClient) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	opts := callOptions(o.model, options)
+	generations := make([]*llms.Generation, 0, len(prompts))
+	for _, prompt := range prompts {
+		req := ollamaRequest{
+			Model:  opts.Model,
+			Prompt: prompt,
+			Options: ollamaOptions{
+				Temperature: opts.Temperature,
+				NumPredict:  opts.MaxTokens,
+				Stop:        opts.StopWords,
+			},
+		}
+		res := ollamaResponse{}
+		if err := postJSON(ctx, o.client, strings.TrimSuffix(o.model.BaseURL, "/")+"/api/generate", "", req, &res); err != nil {
+			return nil, err
+		}
+		if res.Error != "" {
+			return nil, fmt.Errorf("ollama: %s", res.Error)
+		}
+		generations = append(generations, &llms.Generation{
+			Text:           res.Response,
+			GenerationInfo: usageInfo(opts.Model, res.PromptEvalCount, res.EvalCount),
+		})
+	}
+	return generations, nil
+}
+
+// LlamaCppClient talks to the /completion endpoint of a llama.cpp server
+type LlamaCppClient struct {
+	model  Model
+	client *http.Client
+}
+
+var _ llms.LLM = (*LlamaCppClient)(nil)
+
+func NewLlamaCpp(model Model) (llms.LLM, error) {
+	if model.BaseURL == "" {
+		model.BaseURL = defaultLlamaCppURL
+	}
+	return &LlamaCppClient{model: model, client: model.httpClient()}, nil
+}
+
+type llamaCppRequest struct {
+	Prompt      string   `json:"prompt"`
+	Temperature float64  `json:"temperature"`
+	NPredict    int      `json:"n_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type llamaCppResponse struct {
+	Content         string `json:"content"`
+	TokensEvaluated int    `json:"tokens_evaluated"`
+	TokensPredicted int    `json:"tokens_predicted"`
+}
+
+func (o *LlamaCppClient) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	r, err := o.Generate(ctx, []string{prompt}, options...)
+	if err != nil {
+		return "", err
+	}
+	return r[0].Text, nil
+}
+
+func (o *LlamaCppClient) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	opts := callOptions(o.model, options)
+	generations := make([]*llms.Generation, 0, len(prompts))
+	for _, prompt := range prompts {
+		req := llamaCppRequest{
+			Prompt:      prompt,
+			Temperature: opts.Temperature,
+			NPredict:    opts.MaxTokens,
+			Stop:        opts.StopWords,
+		}
+		res := llamaCppResponse{}
+		if err := postJSON(ctx, o.client, strings.TrimSuffix(o.model.BaseURL, "/")+"/completion", "", req, &res); err != nil {
+			return nil, err
+		}
+		generations = append(generations, &llms.Generation{
+			Text:           res.Content,
+			GenerationInfo: usageInfo(o.model.Model, res.TokensEvaluated, res.TokensPredicted),
+		})
+	}
+	return generations, nil
+}
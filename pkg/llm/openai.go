@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	defaultOpenAIURL   = "https://api.openai.com/v1"
+	defaultOpenAIModel = "text-davinci-003"
+	defaultMaxTokens   = 256
+)
+
+var ErrEmptyResponse = errors.New("no response")
+
+// OpenAIClient talks to an OpenAI compatible completions or chat completions endpoint. It replaces langchaingo's
+// openai client, which only calls api.openai.com with http.DefaultClient, ignores the model, temperature and max tokens
+// of a call, has no chat completions behind Generate and drops the token usage the budgets and costs are counted from.
+type OpenAIClient struct {
+	model  Model
+	client *http.Client
+}
+
+var _ llms.LLM = (*OpenAIClient)(nil)
+
+func NewOpenAI(model Model) (llms.LLM, error) {
+	if model.BaseURL == "" {
+		model.BaseURL = defaultOpenAIURL
+	}
+	if model.Model == "" {
+		model.Model = defaultOpenAIModel
+	}
+	if model.MaxTokens == 0 {
+		model.MaxTokens = defaultMaxTokens
+	}
+	if model.APIKey == "" {
+		model.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	// a local OpenAI compatible server might not need a key, only the real thing does
+	if model.APIKey == "" && model.BaseURL == defaultOpenAIURL {
+		return nil, errors.New("missing the OpenAI API key, set it in the OPENAI_API_KEY environment variable")
+	}
+	return &OpenAIClient{model: model, client: model.httpClient()}, nil
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Prompt      string          `json:"prompt,omitempty"`
+	Messages    []openAIMessage `json:"messages,omitempty"`
+	Temperature float64         `json:"temperature"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Text    string        `json:"text"`
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (o *OpenAIClient) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	r, err := o.Generate(ctx, []string{prompt}, options...)
+	if err != nil {
+		return "", err
+	}
+	return r[0].Text, nil
+}
+
+func (o *OpenAIClient) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	opts := callOptions(o.model, options)
+	generations := make([]*llms.Generation, 0, len(prompts))
+	for _, prompt := range prompts {
+		req := openAIRequest{
+			Model:       opts.Model,
+			Temperature: opts.Temperature,
+			MaxTokens:   opts.MaxTokens,
+			Stop:        opts.StopWords,
+		}
+		path := "/completions"
+		if o.model.Chat {
+			path = "/chat/completions"
+			req.Messages = []openAIMessage{{Role: "user", Content: prompt}}
+		} else {
+			req.Prompt = prompt
+		}
+
+		res := openAIResponse{}
+		if err := postJSON(ctx, o.client, strings.TrimSuffix(o.model.BaseURL, "/")+path, o.model.APIKey, req, &res); err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, fmt.Errorf("openai: %s", res.Error.Message)
+		}
+		if len(res.Choices) == 0 {
+			return nil, ErrEmptyResponse
+		}
+		text := res.Choices[0].Text
+		if o.model.Chat {
+			text = res.Choices[0].Message.Content
+		}
+		generations = append(generations, &llms.Generation{
+			Text:           text,
+			GenerationInfo: usageInfo(opts.Model, res.Usage.PromptTokens, res.Usage.CompletionTokens),
+		})
+	}
+	return generations, nil
+}
+
+// usageInfo is the generation info every provider reports, so token usage can be accounted for the same way
+func usageInfo(model string, promptTokens, completionTokens int) map[string]any {
+	return map[string]any{
+		"model":            model,
+		"promptTokens":     promptTokens,
+		"completionTokens": completionTokens,
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, token string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if res.StatusCode >= http.StatusBadRequest && len(resBody) == 0 {
+		return fmt.Errorf("post: status %d", res.StatusCode)
+	}
+	if err := json.Unmarshal(resBody, out); err != nil {
+		return fmt.Errorf("status %d, unmarshal: %w", res.StatusCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"go-autogpt/pkg/prompts"
+	"os"
+	"sync"
+)
+
+// Script is the responses of a scripted LLM, keyed by the name of the prompt template (see prompts.Identify) with one
+// response per turn of that template
+type Script struct {
+	Responses map[string][]string `json:"responses"`
+}
+
+func LoadScript(path string) (Script, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, fmt.Errorf("read: %w", err)
+	}
+	script := Script{}
+	if err := json.Unmarshal(b, &script); err != nil {
+		return Script{}, fmt.Errorf("unmarshal: %w", err)
+	}
+	return script, nil
+}
+
+// ScriptedLLM answers each prompt with the next response scripted for its template, so a run is deterministic and
+// needs no real model
+type ScriptedLLM struct {
+	mu     sync.Mutex
+	script Script
+	turns  map[string]int
+}
+
+var _ llms.LLM = (*ScriptedLLM)(nil)
+
+func NewScripted(script Script) *ScriptedLLM {
+	return &ScriptedLLM{script: script, turns: map[string]int{}}
+}
+
+// NewScript is the Factory for the script provider, Model.Script is the path to the script
+func NewScript(model Model) (llms.LLM, error) {
+	if model.Script == "" {
+		return nil, errors.New("script needs the path to a script")
+	}
+	script, err := LoadScript(model.Script)
+	if err != nil {
+		return nil, err
+	}
+	return NewScripted(script), nil
+}
+
+func (s *ScriptedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	name := prompts.Identify(prompt)
+	if name == "" {
+		return "", errors.New("script: prompt doesn't match any template")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	turn := s.turns[name]
+	responses := s.script.Responses[name]
+	if turn >= len(responses) {
+		return "", fmt.Errorf("script: no response for turn %d of the %s template", turn, name)
+	}
+	s.turns[name]++
+	return responses[turn], nil
+}
+
+func (s *ScriptedLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	generations := make([]*llms.Generation, 0, len(prompts))
+	for _, prompt := range prompts {
+		text, err := s.Call(ctx, prompt, options...)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, &llms.Generation{Text: text, GenerationInfo: usageInfo(Scripted, 0, 0)})
+	}
+	return generations, nil
+}
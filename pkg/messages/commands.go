@@ -10,31 +10,77 @@ type NewGoal struct {
 	Goal      string
 }
 
+// ResumeGoal picks a goal back up from its last checkpoint in the store
+type ResumeGoal struct {
+	RequestID uuid.UUID
+}
+
+// Cancel stops a goal for good, any command still running is killed
+type Cancel struct{}
+
+// Pause holds a goal once the work in flight completes
+type Pause struct{}
+
+// Continue picks a paused goal back up
+type Continue struct{}
+
+// Decided is a person's decision on a pending approval, it is passed down the actor tree to the agent waiting on it
+type Decided struct {
+	Approval models.Approval
+}
+
+// Answered is the user's answer to a question, it is passed down the actor tree to the agent that asked it
+type Answered struct {
+	Question models.Question
+}
+
 type NewPlan struct {
 	RequestID uuid.UUID
 	models.Plan
+	History []models.TaskHistory // tasks already completed when resuming a plan
+	Answers []models.Question    // questions the user has already answered about the goal
 }
 
 type NewSearch struct {
 	RequestID           uuid.UUID
+	TaskID              string
 	Search              string
 	ExpectedOutcome     string
 	PossibleLimitations string
 }
 
+type NewFetch struct {
+	RequestID       uuid.UUID
+	TaskID          string
+	URL             string
+	Task            string // the chunks of the page most relevant to the task and its outcome are returned
+	ExpectedOutcome string
+}
+
 type ExecuteCommand struct {
 	RequestID        uuid.UUID
+	TaskID           string
 	Command          string
 	Reason           string
 	Task             string
-	PreviousAttempts []CommandAttempt `json:"previousAttempts"`
+	PreviousAttempts []CommandAttempt  `json:"previousAttempts"`
+	Answers          []models.Question `json:"answers,omitempty"` // the user has answered about the goal
 }
 
 type CommandAttempt struct {
-	Command string `json:"command"`
-	Output  string `json:"output"`
-	Error   string `json:"error"`
-	Reason  string `json:"reason"`
+	Command   string `json:"command"`
+	Output    string `json:"output"` // stdout of the command
+	Stderr    string `json:"stderr,omitempty"`
+	Error     string `json:"error"`
+	Reason    string `json:"reason"`
+	Refused   bool   `json:"refused,omitempty"`   // the command broke the goal's policy and wasn't run
+	Truncated bool   `json:"truncated,omitempty"` // some of the output went over the cap and was dropped
+}
+
+// CommandOutputLine is a line the terminal's command printed, streamed to the supervisor as the command runs
+type CommandOutputLine struct {
+	TaskID string
+	models.OutputLine
 }
 
 type DiagnoseCommand struct {
@@ -42,15 +88,36 @@ type DiagnoseCommand struct {
 	PreviousAttempts []CommandAttempt `json:"previousAttempts"`
 }
 
+// Result is the result of a task a tool's actor sends the supervisor, which keeps it in the task's history
+type Result interface {
+	ResultOf() string // the id of the task
+}
+
 type SearchResult struct {
-	Result string
+	TaskID string             `json:"taskId,omitempty"`
+	Result string             `json:"result"`         // the LLM's summary of the hits
+	Hits   []models.SearchHit `json:"hits,omitempty"` // ranked, without duplicates
+}
+
+type FetchResult struct {
+	TaskID    string `json:"taskId,omitempty"`
+	URL       string `json:"url"` // after redirects
+	Title     string `json:"title,omitempty"`
+	Result    string `json:"result"` // the chunks of the page most relevant to the task, in the order they're on the page
+	Chunks    int    `json:"chunks"` // the page was split into
+	Truncated bool   `json:"truncated,omitempty"`
 }
 
 type CommandResult struct {
+	TaskID             string           `json:"taskId,omitempty"`
 	Result             string           `json:"result"`
 	DiagnosticAttempts []CommandAttempt `json:"diagnosticAttempts,omitempty"`
 }
 
+func (r SearchResult) ResultOf() string  { return r.TaskID }
+func (r FetchResult) ResultOf() string   { return r.TaskID }
+func (r CommandResult) ResultOf() string { return r.TaskID }
+
 type TaskResult struct {
 	TaskHistory models.TaskHistory
 }
@@ -59,8 +126,23 @@ type SupervisorComplete struct {
 	Result any
 }
 
-type GetStatus struct{}
+// Replan asks the planner to revise what's left of the plan after a task went wrong
+type Replan struct {
+	TaskID string
+	Task   string
+	Reason string
+	Error  models.Error
+}
 
 type ReportError struct {
-	Error models.Error
+	TaskID string // the task of the plan that went wrong, if any
+	Error  models.Error
 }
+
+// ToolResult is the result of a tool that doesn't have a message of its own, such as a custom tool
+type ToolResult struct {
+	TaskID string `json:"taskId,omitempty"`
+	Result any    `json:"result"`
+}
+
+func (r ToolResult) ResultOf() string { return r.TaskID }
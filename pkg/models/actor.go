@@ -5,10 +5,16 @@ import (
 )
 
 type Planner struct {
-	State       State               `json:"state"`
-	TaskHistory []TaskHistory       `json:"history"`
-	Plan        map[string][]string `json:"plan"`
-	Errs        Error               `json:"error,omitempty"`
+	State       State                   `json:"state"`
+	TaskHistory []TaskHistory           `json:"history"`
+	Plan        map[string][]Task       `json:"plan"`
+	Errs        Error                   `json:"error,omitempty"`
+	Transitions []Transition            `json:"transitions,omitempty"`
+	Usage       Usage                   `json:"usage"`
+	Revisions   []PlanRevision          `json:"revisions,omitempty"`
+	Pending     []Approval              `json:"pending,omitempty"`
+	Questions   []Question              `json:"questions,omitempty"`
+	Output      map[string][]OutputLine `json:"output,omitempty"` // latest lines of the running tasks' commands, by task id
 }
 
 type Status struct {
@@ -30,12 +36,13 @@ type Solution struct {
 }
 
 type TaskHistory struct {
-	Task     string   `json:"task"`
-	Solution Solution `json:"solution"`
-	Result   any      `json:"result"`
-}
-
-type Plan struct {
-	Goal  string
-	Tasks []string `json:"tasks"`
+	ID        string       `json:"id,omitempty"` // of the task in the plan
+	Task      string       `json:"task"`
+	Solution  Solution     `json:"solution"`
+	Result    any          `json:"result"`
+	Usage     Usage        `json:"usage"`
+	Questions []Question   `json:"questions,omitempty"` // the user answered while working on the task
+	Output    []OutputLine `json:"output,omitempty"`    // last lines its commands printed
+	Log       string       `json:"log,omitempty"`       // everything its commands printed, relative to the goal's sandbox
+	Files     []FileChange `json:"files,omitempty"`     // of the goal's sandbox the task created, modified or deleted
 }
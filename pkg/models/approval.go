@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type ApprovalKind string
+
+const (
+	PlanApproval    ApprovalKind = "plan"
+	CommandApproval ApprovalKind = "command"
+)
+
+type Decision string
+
+const (
+	Approve Decision = "approve"
+	Reject  Decision = "reject"
+	Edit    Decision = "edit" // approves the command as edited by the person deciding
+)
+
+func (d Decision) Valid() bool {
+	return d == Approve || d == Reject || d == Edit
+}
+
+// Approval is a step of a goal held back until a person decides on it, a plan before the supervisor works on it or a
+// command before the terminal runs it
+type Approval struct {
+	ID        string       `json:"id"`
+	Kind      ApprovalKind `json:"kind"`
+	TaskID    string       `json:"taskId,omitempty"`
+	Plan      *Plan        `json:"plan,omitempty"`
+	Command   string       `json:"command,omitempty"`
+	Reason    string       `json:"reason,omitempty"` // why the agent wants to take the step
+	CreatedAt time.Time    `json:"createdAt"`
+
+	Decision  Decision   `json:"decision,omitempty"`
+	Edited    string     `json:"edited,omitempty"`  // the command that ran instead, when edited
+	Comment   string     `json:"comment,omitempty"` // from the person deciding, such as why it was rejected
+	Auto      bool       `json:"auto,omitempty"`    // approved by the allowlist rather than a person
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+}
+
+// Rejection is the error of a step a person rejected
+func (a Approval) Rejection() string {
+	msg := fmt.Sprintf("the %s was rejected", a.Kind)
+	if a.Comment != "" {
+		msg += ": " + a.Comment
+	}
+	return msg
+}
+
+// Decide records the decision on a pending approval of the goal, returning false if there is no such approval
+func (g *Goal) Decide(id string, decision Decision, edited, comment string) (Approval, bool) {
+	for i, approval := range g.Pending {
+		if approval.ID != id {
+			continue
+		}
+		now := time.Now()
+		approval.Decision = decision
+		approval.Edited = edited
+		approval.Comment = comment
+		approval.DecidedAt = &now
+		g.Pending = append(g.Pending[:i], g.Pending[i+1:]...)
+		g.Approvals = append(g.Approvals, approval)
+		g.Await()
+		return approval, true
+	}
+	return Approval{}, false
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type Limit string
+
+const (
+	TokensLimit   Limit = "tokens"
+	CostLimit     Limit = "cost"
+	CallsLimit    Limit = "calls"
+	DurationLimit Limit = "duration"
+	CommandsLimit Limit = "commands"
+)
+
+// Unlimited lifts a limit of the budget it's merged into, a zero limit of an override is left unset
+const Unlimited = -1
+
+// Budget is the most a goal can use before it's stopped, a zero limit is unlimited
+type Budget struct {
+	MaxTokens   int     `json:"maxTokens,omitempty"`
+	MaxCost     float64 `json:"maxCost,omitempty"` // in dollars
+	MaxCalls    int     `json:"maxCalls,omitempty"`
+	MaxSeconds  float64 `json:"maxSeconds,omitempty"` // of wall-clock time spent working on the goal
+	MaxCommands int     `json:"maxCommands,omitempty"`
+}
+
+// Valid is whether every limit is unlimited or isn't negative
+func (b Budget) Valid() bool {
+	for _, limit := range []float64{float64(b.MaxTokens), b.MaxCost, float64(b.MaxCalls), b.MaxSeconds, float64(b.MaxCommands)} {
+		if limit < 0 && limit != Unlimited {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge returns the budget with any limits set in override replacing its own, an Unlimited limit lifts its own
+func (b Budget) Merge(override Budget) Budget {
+	b.MaxTokens = mergeLimit(b.MaxTokens, override.MaxTokens)
+	b.MaxCost = mergeLimit(b.MaxCost, override.MaxCost)
+	b.MaxCalls = mergeLimit(b.MaxCalls, override.MaxCalls)
+	b.MaxSeconds = mergeLimit(b.MaxSeconds, override.MaxSeconds)
+	b.MaxCommands = mergeLimit(b.MaxCommands, override.MaxCommands)
+	return b
+}
+
+func mergeLimit[T int | float64](limit, override T) T {
+	switch override {
+	case 0:
+		return limit
+	case Unlimited:
+		return 0
+	}
+	return override
+}
+
+// BudgetExceeded is the limit of a goal's budget that tripped
+type BudgetExceeded struct {
+	Limit Limit   `json:"limit"`
+	Max   float64 `json:"max"`
+	Used  float64 `json:"used"`
+}
+
+func (e BudgetExceeded) Error() string {
+	return fmt.Sprintf("budget exceeded: used %v of the %s limit of %v", e.Used, e.Limit, e.Max)
+}
+
+// LLMLimits are the limits an LLM call counts against
+var LLMLimits = []Limit{TokensLimit, CostLimit, CallsLimit, DurationLimit}
+
+// CommandLimits are the limits a terminal command counts against
+var CommandLimits = []Limit{CommandsLimit, DurationLimit}
+
+// CheckBudget returns BudgetExceeded if the goal has used up any of the limits of its budget, so spending more would go
+// over it
+func (g Goal) CheckBudget(now time.Time, check []Limit) error {
+	limits := []struct {
+		limit     Limit
+		max, used float64
+	}{
+		{TokensLimit, float64(g.Budget.MaxTokens), float64(g.Usage.Tokens())},
+		{CostLimit, g.Budget.MaxCost, g.Usage.Cost},
+		{CallsLimit, float64(g.Budget.MaxCalls), float64(g.Usage.Calls)},
+		{DurationLimit, g.Budget.MaxSeconds, g.ActiveDuration(now).Seconds()},
+		{CommandsLimit, float64(g.Budget.MaxCommands), float64(g.Commands)},
+	}
+	for _, l := range limits {
+		if !contains(check, l.limit) {
+			continue
+		}
+		if l.max > 0 && l.used >= l.max {
+			return BudgetExceeded{Limit: l.limit, Max: l.max, Used: l.used}
+		}
+	}
+	return nil
+}
+
+// TimeLeft is how much of the goal's wall-clock budget is left, negative once it's used up, false if the goal has no
+// limit on it
+func (g Goal) TimeLeft(now time.Time) (time.Duration, bool) {
+	if g.Budget.MaxSeconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(g.Budget.MaxSeconds*float64(time.Second)) - g.ActiveDuration(now), true
+}
+
+// ActiveDuration is how long the goal has been worked on, time spent paused, interrupted or waiting on a person doesn't
+// count
+func (g Goal) ActiveDuration(now time.Time) time.Duration {
+	var d time.Duration
+	for i, t := range g.Transitions {
+		if !t.State.Active() || t.State.Waiting() {
+			continue
+		}
+		end := now
+		if i+1 < len(g.Transitions) {
+			end = g.Transitions[i+1].Time
+		}
+		d += end.Sub(t.Time)
+	}
+	return d
+}
+
+func contains(limits []Limit, limit Limit) bool {
+	for _, l := range limits {
+		if l == limit {
+			return true
+		}
+	}
+	return false
+}
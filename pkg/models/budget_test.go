@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestBudget_Merge(t *testing.T) {
+	defaults := Budget{MaxTokens: 1000, MaxCost: 0.5, MaxCalls: 10, MaxSeconds: 60, MaxCommands: 5}
+	tests := []struct {
+		name     string
+		override Budget
+		want     Budget
+	}{
+		{name: "keeps the defaults of unset limits", override: Budget{}, want: defaults},
+		{
+			name:     "replaces the limits that are set",
+			override: Budget{MaxTokens: 20, MaxSeconds: 1.5},
+			want:     Budget{MaxTokens: 20, MaxCost: 0.5, MaxCalls: 10, MaxSeconds: 1.5, MaxCommands: 5},
+		},
+		{
+			name:     "lifts unlimited limits",
+			override: Budget{MaxCost: Unlimited, MaxCalls: Unlimited, MaxCommands: 2},
+			want:     Budget{MaxTokens: 1000, MaxSeconds: 60, MaxCommands: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.override.Valid() {
+				t.Fatalf("expected %+v to be valid", tt.override)
+			}
+			if got := defaults.Merge(tt.override); got != tt.want {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if (Budget{MaxCalls: -2}).Valid() {
+		t.Error("expected a negative limit other than Unlimited to be invalid")
+	}
+}
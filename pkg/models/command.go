@@ -0,0 +1,28 @@
+package models
+
+// CommandOutput is what a terminal command wrote, each stream is capped and marked when the rest of it was dropped
+type CommandOutput struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // stdout or stderr went over the cap
+}
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// OutputLine is a line a command printed, streamed as the command runs
+type OutputLine struct {
+	Stream string `json:"stream"` // stdout or stderr
+	Line   string `json:"line"`
+}
+
+// AppendTail adds the line to the tail, dropping the oldest lines so it keeps at most max
+func AppendTail(tail []OutputLine, line OutputLine, max int) []OutputLine {
+	tail = append(tail, line)
+	if len(tail) > max {
+		tail = append([]OutputLine(nil), tail[len(tail)-max:]...)
+	}
+	return tail
+}
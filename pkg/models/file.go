@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// File is a regular file of a goal's workspace
+type File struct {
+	Path    string    `json:"path"` // relative to the goal's sandbox, slash separated
+	Size    int64     `json:"size"`
+	Hash    string    `json:"sha256"`
+	ModTime time.Time `json:"modTime"`
+}
+
+type Change string
+
+const (
+	Created  Change = "created"
+	Modified Change = "modified"
+	Deleted  Change = "deleted"
+)
+
+// FileChange is a file a task created, modified or deleted, a deleted file has the size and hash it was last seen with
+type FileChange struct {
+	Change Change `json:"change"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Hash   string `json:"sha256"`
+}
+
+// ManifestFile is a file the user provided as it's given to the LLM
+type ManifestFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Manifest is the files the user provided as they're given to the LLM in prompts
+func Manifest(files []File) []ManifestFile {
+	manifest := make([]ManifestFile, 0, len(files))
+	for _, f := range files {
+		manifest = append(manifest, ManifestFile{Path: f.Path, Size: f.Size})
+	}
+	return manifest
+}
+
+// AddInput records a file the user provided, replacing the one at the same path
+func (g *Goal) AddInput(file File) {
+	for i, input := range g.Inputs {
+		if input.Path == file.Path {
+			g.Inputs[i] = file
+			return
+		}
+	}
+	g.Inputs = append(g.Inputs, file)
+}
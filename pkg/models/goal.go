@@ -0,0 +1,143 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Goal is the durable record of a goal, it is kept up to date by the planner as the goal progresses
+type Goal struct {
+	ID          uuid.UUID               `json:"id"`
+	Goal        string                  `json:"goal"`
+	State       State                   `json:"state"`
+	Plan        *Plan                   `json:"plan,omitempty"`
+	Revisions   []PlanRevision          `json:"revisions,omitempty"`
+	TaskHistory []TaskHistory           `json:"history"`
+	Errs        []Error                 `json:"errors,omitempty"`
+	Transitions []Transition            `json:"transitions"`
+	Checkpoint  *Checkpoint             `json:"checkpoint,omitempty"`
+	Pending     []Approval              `json:"pending,omitempty"`   // steps held back until a person decides on them
+	Approvals   []Approval              `json:"approvals,omitempty"` // decided approvals, oldest first
+	Questions   []Question              `json:"questions,omitempty"` // asked by agents and waiting on the user's answer
+	Answers     []Question              `json:"answers,omitempty"`   // questions the user has answered, oldest first
+	Output      map[string][]OutputLine `json:"output,omitempty"`    // latest lines of the running tasks' commands
+	Inputs      []File                  `json:"inputs,omitempty"`    // files the user provided in the goal's sandbox
+	ReplayOf    *uuid.UUID              `json:"replayOf,omitempty"`  // the recorded goal this goal replays
+	Usage       Usage                   `json:"usage"`
+	Commands    int                     `json:"commands"` // terminal commands run
+	Budget      Budget                  `json:"budget"`
+	Policy      Policy                  `json:"policy"` // rules the goal's commands follow
+	CreatedAt   time.Time               `json:"createdAt"`
+	UpdatedAt   time.Time               `json:"updatedAt"`
+}
+
+// Checkpoint is the supervisor's progress through the plan, it is enough to pick the plan back up after a restart
+type Checkpoint struct {
+	Running []string      `json:"running,omitempty"` // ids of the tasks in flight, they run again on resume
+	History []TaskHistory `json:"history"`
+}
+
+type Transition struct {
+	State State     `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+func NewGoal(id uuid.UUID, goal string) Goal {
+	now := time.Now()
+	return Goal{
+		ID:          id,
+		Goal:        goal,
+		State:       Init,
+		TaskHistory: make([]TaskHistory, 0),
+		Transitions: []Transition{{State: Init, Time: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// Transition moves the goal to a new state, repeated states are ignored. Pending approvals and unanswered questions are
+// dropped once no agent is left waiting on them.
+func (g *Goal) Transition(state State) {
+	if g.State == state {
+		return
+	}
+	g.State = state
+	if state.Ended() || state == Interrupted {
+		g.Pending = nil
+		g.Questions = nil
+		g.Output = nil
+	}
+	g.Transitions = append(g.Transitions, Transition{State: state, Time: time.Now()})
+}
+
+// Await moves an active goal to the state of what it's waiting on from a person, or back to thinking once there is
+// nothing left to wait on
+func (g *Goal) Await() {
+	if !g.State.Active() {
+		return
+	}
+	switch {
+	case len(g.Pending) > 0:
+		g.Transition(AwaitingApproval)
+	case len(g.Questions) > 0:
+		g.Transition(WaitingForInput)
+	default:
+		g.Transition(Thinking)
+	}
+}
+
+func (g *Goal) AddError(err Error) {
+	g.Errs = append(g.Errs, err)
+}
+
+// GoalSummary is a goal at a glance, for listing goals
+type GoalSummary struct {
+	ID             uuid.UUID `json:"id"`
+	Goal           string    `json:"goal"`
+	State          State     `json:"state"`
+	PlannedTasks   int       `json:"plannedTasks"`
+	CompletedTasks int       `json:"completedTasks"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Duration       float64   `json:"durationSeconds"` // how long the goal ran for, or has been running for
+}
+
+func (g Goal) Summary() GoalSummary {
+	summary := GoalSummary{
+		ID:             g.ID,
+		Goal:           g.Goal,
+		State:          g.State,
+		CompletedTasks: len(g.TaskHistory),
+		CreatedAt:      g.CreatedAt,
+		UpdatedAt:      g.UpdatedAt,
+	}
+	if g.Plan != nil {
+		summary.PlannedTasks = len(g.Plan.Tasks)
+	}
+	end := time.Now()
+	if g.State.Ended() || g.State == Interrupted {
+		end = g.UpdatedAt
+	}
+	summary.Duration = end.Sub(g.CreatedAt).Seconds()
+	return summary
+}
+
+func (g Goal) Status() Status {
+	planner := Planner{
+		State:       g.State,
+		TaskHistory: g.TaskHistory,
+		Transitions: g.Transitions,
+		Usage:       g.Usage,
+		Revisions:   g.Revisions,
+		Pending:     g.Pending,
+		Questions:   g.Questions,
+		Output:      g.Output,
+	}
+	if g.Plan != nil {
+		planner.Plan = map[string][]Task{"tasks": g.Plan.Tasks}
+	}
+	if len(g.Errs) > 0 {
+		planner.Errs = g.Errs[len(g.Errs)-1]
+	}
+	return Status{Planner: planner}
+}
@@ -0,0 +1,9 @@
+package models
+
+// Page is the readable content of a fetched url
+type Page struct {
+	URL       string `json:"url"` // after redirects
+	Title     string `json:"title,omitempty"`
+	Text      string `json:"text"`                // markdown of an html page, otherwise as it was served
+	Truncated bool   `json:"truncated,omitempty"` // the page was larger than the limit and was cut short
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Task is a step of a plan, a task runs once every task it depends on has completed so tasks that don't depend on
+// each other run at the same time
+type Task struct {
+	ID        string   `json:"id"`
+	Task      string   `json:"task"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Artifacts []string `json:"artifacts,omitempty"` // files the task is expected to produce
+}
+
+// UnmarshalJSON also accepts a task that is only its description, as plans used to be a list of them
+func (t *Task) UnmarshalJSON(b []byte) error {
+	var description string
+	if err := json.Unmarshal(b, &description); err == nil {
+		*t = Task{Task: description}
+		return nil
+	}
+	type task Task // without the method, so it doesn't recurse
+	return json.Unmarshal(b, (*task)(t))
+}
+
+type Plan struct {
+	Goal  string
+	Tasks []Task `json:"tasks"`
+}
+
+// NewPlan builds a plan from the tasks of an answer, tasks without an id are given their position in the plan and
+// depend on the task before them, so a plain list of tasks runs in order
+func NewPlan(goal string, tasks []Task) (Plan, error) {
+	plan := Plan{Goal: goal, Tasks: make([]Task, 0, len(tasks))}
+	for i, task := range tasks {
+		if task.ID == "" {
+			task.ID = strconv.Itoa(i + 1)
+			if i > 0 && task.DependsOn == nil {
+				task.DependsOn = []string{plan.Tasks[i-1].ID}
+			}
+		}
+		plan.Tasks = append(plan.Tasks, task)
+	}
+	return plan, plan.Validate()
+}
+
+// Validate checks the tasks form a DAG, ids are unique, dependencies exist and there are no cycles
+func (p Plan) Validate() error {
+	tasks := make(map[string]Task, len(p.Tasks))
+	for _, task := range p.Tasks {
+		if _, ok := tasks[task.ID]; ok {
+			return fmt.Errorf("invalid plan: task id %q is used more than once", task.ID)
+		}
+		tasks[task.ID] = task
+	}
+	for _, task := range p.Tasks {
+		for _, dep := range task.DependsOn {
+			if _, ok := tasks[dep]; !ok {
+				return fmt.Errorf("invalid plan: task %q depends on unknown task %q", task.ID, dep)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := map[string]int{}
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch marks[id] {
+		case visiting:
+			return fmt.Errorf("invalid plan: task %q depends on itself", id)
+		case visited:
+			return nil
+		}
+		marks[id] = visiting
+		for _, dep := range tasks[id].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[id] = visited
+		return nil
+	}
+	for _, task := range p.Tasks {
+		if err := visit(task.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dependencies returns every task the task depends on, directly or through other tasks
+func (p Plan) Dependencies(id string) map[string]bool {
+	tasks := make(map[string]Task, len(p.Tasks))
+	for _, task := range p.Tasks {
+		tasks[task.ID] = task
+	}
+	deps := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		for _, dep := range tasks[id].DependsOn {
+			if !deps[dep] {
+				deps[dep] = true
+				visit(dep)
+			}
+		}
+	}
+	visit(id)
+	return deps
+}
+
+// Remaining is the tasks that haven't completed according to the history
+func (p Plan) Remaining(history []TaskHistory) []Task {
+	completed := map[string]bool{}
+	for _, h := range history {
+		completed[h.ID] = true
+	}
+	remaining := make([]Task, 0)
+	for _, task := range p.Tasks {
+		if !completed[task.ID] {
+			remaining = append(remaining, task)
+		}
+	}
+	return remaining
+}
+
+// Revise replaces the tasks that haven't completed with the revised tasks, revised tasks without an id are given one
+// unique to the revision and depend on the revised task before them, revised tasks that already completed are dropped
+func (p Plan) Revise(history []TaskHistory, revised []Task, revision int) (Plan, error) {
+	completed := map[string]bool{}
+	for _, h := range history {
+		completed[h.ID] = true
+	}
+	plan := Plan{Goal: p.Goal, Tasks: make([]Task, 0, len(p.Tasks)+len(revised))}
+	for _, task := range p.Tasks {
+		if completed[task.ID] {
+			plan.Tasks = append(plan.Tasks, task)
+		}
+	}
+	previous := ""
+	for i, task := range revised {
+		if completed[task.ID] {
+			continue
+		}
+		if task.ID == "" {
+			task.ID = fmt.Sprintf("r%d-%d", revision, i+1)
+			if previous != "" && task.DependsOn == nil {
+				task.DependsOn = []string{previous}
+			}
+		}
+		previous = task.ID
+		plan.Tasks = append(plan.Tasks, task)
+	}
+	return plan, plan.Validate()
+}
+
+// PlanRevision is a change the planner made to the plan after a task went wrong
+type PlanRevision struct {
+	Revision int       `json:"revision"`
+	TaskID   string    `json:"taskId"` // the task that went wrong
+	Reason   string    `json:"reason"`
+	Previous []Task    `json:"previous"` // the tasks that hadn't completed
+	Revised  []Task    `json:"revised"`  // the tasks that replaced them
+	Time     time.Time `json:"time"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// Policy is the rules a command has to follow before the terminal runs it, on top of the checks every command gets
+type Policy struct {
+	// Deny are patterns of commands that are never run, a program and any arguments it's run with, e.g. "git push" or
+	// "rm -rf". Combined short flags match on their own, so "rm -rf" also denies "rm -f -r".
+	Deny      []string `json:"deny,omitempty"`
+	Allow     []string `json:"allow,omitempty"`     // when set, the only programs that can be run
+	MaxLength int      `json:"maxLength,omitempty"` // of the command, in bytes, zero is unlimited
+}
+
+// Merge returns the policy with the rules of override added, so a goal can only tighten it: the programs of both
+// allowlists are allowed and the smaller max length is kept. Allowlists with no program in common allow nothing,
+// which an empty allowlist can't say, see Disjoint.
+func (p Policy) Merge(override Policy) Policy {
+	p.Deny = append(append([]string{}, p.Deny...), override.Deny...)
+	switch {
+	case len(p.Allow) == 0:
+		p.Allow = override.Allow
+	case len(override.Allow) > 0:
+		allowed := make(map[string]bool, len(override.Allow))
+		for _, program := range override.Allow {
+			allowed[program] = true
+		}
+		both := make([]string, 0, len(p.Allow))
+		for _, program := range p.Allow {
+			if allowed[program] {
+				both = append(both, program)
+			}
+		}
+		p.Allow = both
+	}
+	if override.MaxLength > 0 && (p.MaxLength == 0 || override.MaxLength < p.MaxLength) {
+		p.MaxLength = override.MaxLength
+	}
+	return p
+}
+
+// Disjoint is whether the allowlists of the policies have no program in common, merged they would allow nothing
+func (p Policy) Disjoint(override Policy) bool {
+	return len(p.Allow) > 0 && len(override.Allow) > 0 && len(p.Merge(override).Allow) == 0
+}
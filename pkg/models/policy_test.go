@@ -0,0 +1,61 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicy_Merge(t *testing.T) {
+	defaults := Policy{Deny: []string{"rm -rf"}, Allow: []string{"ls", "cat", "grep"}, MaxLength: 100}
+	tests := []struct {
+		name     string
+		defaults Policy
+		override Policy
+		want     Policy
+	}{
+		{name: "keeps the defaults", defaults: defaults, override: Policy{}, want: defaults},
+		{
+			name:     "adds denied patterns",
+			defaults: defaults,
+			override: Policy{Deny: []string{"curl"}},
+			want:     Policy{Deny: []string{"rm -rf", "curl"}, Allow: []string{"ls", "cat", "grep"}, MaxLength: 100},
+		},
+		{
+			name:     "only allows the programs of both allowlists",
+			defaults: defaults,
+			override: Policy{Allow: []string{"grep", "rm", "curl", "ls"}},
+			want:     Policy{Deny: []string{"rm -rf"}, Allow: []string{"ls", "grep"}, MaxLength: 100},
+		},
+		{
+			name:     "keeps the smaller max length",
+			defaults: defaults,
+			override: Policy{MaxLength: 1000},
+			want:     defaults,
+		},
+		{
+			name:     "lowers the max length",
+			defaults: defaults,
+			override: Policy{MaxLength: 10},
+			want:     Policy{Deny: []string{"rm -rf"}, Allow: []string{"ls", "cat", "grep"}, MaxLength: 10},
+		},
+		{
+			name:     "adds rules where there are none",
+			defaults: Policy{},
+			override: Policy{Allow: []string{"ls"}, MaxLength: 10},
+			want:     Policy{Deny: []string{}, Allow: []string{"ls"}, MaxLength: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.defaults.Merge(tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if !defaults.Disjoint(Policy{Allow: []string{"rm", "curl"}}) {
+		t.Error("expected allowlists with no program in common to be disjoint")
+	}
+	if defaults.Disjoint(Policy{}) || (Policy{}).Disjoint(Policy{Allow: []string{"rm"}}) {
+		t.Error("expected an empty allowlist not to be disjoint")
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// Question is something an agent asked the user when it was stuck on an ambiguity, the agent waits for the answer
+type Question struct {
+	ID         string     `json:"id"`
+	TaskID     string     `json:"taskId,omitempty"`
+	Agent      string     `json:"agent"` // that asked the question
+	Question   string     `json:"question"`
+	Reason     string     `json:"reason,omitempty"` // why the agent is asking
+	Answer     string     `json:"answer,omitempty"`
+	AskedAt    time.Time  `json:"askedAt"`
+	AnsweredAt *time.Time `json:"answeredAt,omitempty"`
+}
+
+// QA is a question and its answer as it's given to the LLM
+type QA struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// QAs are the questions and answers given to the LLM in later prompts
+func QAs(questions []Question) []QA {
+	qas := make([]QA, 0, len(questions))
+	for _, q := range questions {
+		qas = append(qas, QA{Question: q.Question, Answer: q.Answer})
+	}
+	return qas
+}
+
+// AnswerQuestion records the answer to a question of the goal, an empty id answers the only question left. It returns
+// false if there is no such question.
+func (g *Goal) AnswerQuestion(id, answer string) (Question, bool) {
+	if id == "" && len(g.Questions) == 1 {
+		id = g.Questions[0].ID
+	}
+	for i, q := range g.Questions {
+		if q.ID != id {
+			continue
+		}
+		now := time.Now()
+		q.Answer = answer
+		q.AnsweredAt = &now
+		g.Questions = append(g.Questions[:i], g.Questions[i+1:]...)
+		g.Answers = append(g.Answers, q)
+		g.Await()
+		return q, true
+	}
+	return Question{}, false
+}
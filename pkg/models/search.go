@@ -0,0 +1,9 @@
+package models
+
+// SearchHit is a result of a search
+type SearchHit struct {
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score,omitempty"` // the provider's relevance, higher is better
+}
@@ -6,6 +6,29 @@ const (
 	Init     State = "init"
 	Thinking State = "thinking"
 	Idle     State = "idle"
-	Failed   State = "failed" // dead state
-	Finished State = "finished"
+	Paused   State = "paused"
+	// AwaitingApproval goals have a plan or command held back until a person decides on it
+	AwaitingApproval State = "awaiting_approval"
+	// WaitingForInput goals have an agent waiting on the answer to a question it asked the user
+	WaitingForInput State = "waiting_for_input"
+	Failed          State = "failed" // dead state
+	Finished        State = "finished"
+	Cancelled       State = "cancelled" // dead state
+	// Interrupted goals were running when the server stopped and can be resumed
+	Interrupted State = "interrupted"
 )
+
+// Active reports whether a goal in this state still has agents working on it
+func (s State) Active() bool {
+	return s == Init || s == Thinking || s == Idle || s.Waiting()
+}
+
+// Waiting reports whether a goal in this state has agents waiting on a person
+func (s State) Waiting() bool {
+	return s == AwaitingApproval || s == WaitingForInput
+}
+
+// Ended reports whether a goal in this state is done for good
+func (s State) Ended() bool {
+	return s == Failed || s == Finished || s == Cancelled
+}
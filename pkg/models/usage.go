@@ -0,0 +1,22 @@
+package models
+
+// Usage is the tokens and estimated cost of LLM calls
+type Usage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"` // estimated, in dollars
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Calls:            u.Calls + other.Calls,
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+func (u Usage) Tokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
@@ -0,0 +1,783 @@
+package policy
+
+import (
+	"fmt"
+	"go-autogpt/pkg/models"
+	"mvdan.cc/sh/v3/syntax"
+	"path"
+	"strings"
+)
+
+type Rule string
+
+const (
+	ParseRule     Rule = "parse"
+	LengthRule    Rule = "max-length"
+	DenyRule      Rule = "deny"
+	AllowRule     Rule = "allow"
+	SandboxRule   Rule = "outside-sandbox"  // writes to, or moves into, a path outside the goal's sandbox
+	PipeRule      Rule = "pipe-to-shell"    // runs a script it downloads or generates, e.g. curl | sh
+	ForkBombRule  Rule = "fork-bomb"        // a function that calls itself, directly or through other functions
+	UncheckedRule Rule = "unchecked-script" // runs something that can't be checked, e.g. eval "$SCRIPT"
+)
+
+// Violation is a rule a command breaks, the command isn't run
+type Violation struct {
+	Rule   Rule   `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("policy violation: %s: %s", v.Rule, v.Detail)
+}
+
+// maxDepth is how deeply scripts run by the command, e.g. with bash -c, are checked
+const maxDepth = 3
+
+var (
+	// shells run a shell script given with -c, interpreters, shells included, run the script of their first operand or
+	// from stdin without one
+	shells       = set("sh", "bash", "zsh", "dash", "ksh")
+	interpreters = set("sh", "bash", "zsh", "dash", "ksh", "fish", "python", "python3", "perl", "ruby", "node", "php")
+	// inline are the flags interpreters that aren't shells take a script with, those scripts can't be checked
+	inline = map[string]map[string]bool{
+		"fish": set("-c", "--command"), "python": set("-c"), "python3": set("-c"), "perl": set("-e", "-E"),
+		"ruby": set("-e"), "node": set("-e", "-p", "--eval", "--print"), "php": set("-r"),
+	}
+	// attached are the short flags of interpreters that can be combined, e.g. perl -pi.bak -e, whose value follows them
+	// in the same argument
+	attached = map[string]string{"perl": "0CdDFiIlmMx", "ruby": "0CEFiIKlrTWx"}
+	// stdins are the operands that name stdin
+	stdins = set("-", "/dev/stdin", "/dev/fd/0", "/proc/self/fd/0")
+	// wrappers run the program of their operands, as another user for sudo and doas
+	wrappers = set("env", "nohup", "nice", "time", "timeout", "xargs", "exec", "command", "builtin", "stdbuf", "sudo", "doas")
+	// valued are the flags of wrappers that take a value as the next argument
+	valued = map[string]map[string]bool{
+		"env":     set("-u", "-C", "--unset", "--chdir"),
+		"nice":    set("-n", "--adjustment"),
+		"timeout": set("-s", "-k", "--signal", "--kill-after"),
+		"xargs":   set("-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter", "--max-args", "--max-procs"),
+		"stdbuf":  set("-i", "-o", "-e"),
+		"sudo":    set("-C", "-D", "-g", "-h", "-p", "-R", "-r", "-T", "-t", "-U", "-u"),
+		"doas":    set("-C", "-u"),
+	}
+	// finders are the actions of find that run a program on the files found, up to a ; or +
+	finders = set("-exec", "-execdir", "-ok", "-okdir")
+	// writers change the files of all their operands, movers the file of their last operand
+	writers = set("rm", "rmdir", "touch", "mkdir", "truncate", "tee", "shred", "unlink")
+	movers  = set("cp", "mv", "ln", "install", "rsync", "scp")
+	// modes change the files of the operands after the first, which is the mode or owner
+	modes = set("chmod", "chown", "chgrp")
+	// extractors write the files of an archive to the directory of their flag
+	extractors = map[string]map[string]bool{"tar": set("-C", "--directory"), "bsdtar": set("-C", "--directory"), "unzip": set("-d")}
+	// devices can be written to from anywhere
+	devices = set("/dev/null", "/dev/stdout", "/dev/stderr")
+)
+
+// Check parses the command into a shell syntax tree and returns a Violation for the first rule of the policy, or of
+// the rules every command follows, that it breaks
+func Check(command string, p models.Policy) error {
+	if p.MaxLength > 0 && len(command) > p.MaxLength {
+		return Violation{Rule: LengthRule, Detail: fmt.Sprintf("the command is %d bytes, the most allowed is %d", len(command), p.MaxLength)}
+	}
+	c := checker{deny: patterns(p.Deny), allow: set(p.Allow...)}
+	return c.script(command, 0)
+}
+
+type checker struct {
+	deny  []pattern
+	allow map[string]bool
+}
+
+func (c checker) script(script string, depth int) error {
+	if depth > maxDepth {
+		return Violation{Rule: UncheckedRule, Detail: "scripts are nested too deeply to check"}
+	}
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return Violation{Rule: ParseRule, Detail: err.Error()}
+	}
+
+	var violation error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if violation != nil {
+			return false
+		}
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			violation = c.heredoc(n)
+		case *syntax.CallExpr:
+			violation = c.call(n, depth)
+		case *syntax.Redirect:
+			violation = c.redirect(n)
+		case *syntax.BinaryCmd:
+			violation = c.pipe(n)
+		}
+		return violation == nil
+	})
+	if violation != nil {
+		return violation
+	}
+	return c.functions(file)
+}
+
+// call checks each program the call runs, looking through wrappers such as env or xargs
+func (c checker) call(call *syntax.CallExpr, depth int) error {
+	args := call.Args
+	for len(args) > 0 {
+		name, ok := literal(args[0])
+		if !ok {
+			return Violation{Rule: UncheckedRule, Detail: "unable to tell which program runs: " + printed(args[0])}
+		}
+		program := path.Base(name)
+		if err := c.program(program, args[1:], depth); err != nil {
+			return err
+		}
+		if !wrappers[program] {
+			return nil
+		}
+		args = wrapped(program, args[1:])
+	}
+	return nil
+}
+
+func (c checker) program(program string, args []*syntax.Word, depth int) error {
+	if len(c.allow) > 0 && !c.allow[program] {
+		return Violation{Rule: AllowRule, Detail: program + " isn't in the allowlist"}
+	}
+	words := literals(args)
+	for _, d := range c.deny {
+		if d.matches(program, words) {
+			return Violation{Rule: DenyRule, Detail: fmt.Sprintf("%s matches the denied pattern %q", program, d.text)}
+		}
+	}
+
+	operands := operands(args)
+	switch {
+	case program == "cd":
+		if len(operands) == 0 {
+			return Violation{Rule: SandboxRule, Detail: "cd moves to the home directory"}
+		}
+		return c.target("cd", operands[0])
+	case program == "eval":
+		return c.nested(program, args, depth)
+	case program == "su":
+		for i, arg := range args {
+			if lit, _ := literal(arg); (lit == "-c" || lit == "--command") && i+1 < len(args) {
+				return c.nested(program, args[i+1:i+2], depth)
+			}
+		}
+	case program == "find":
+		return c.find(args, depth)
+	case program == "source" || program == ".":
+		if len(operands) > 0 && hasProcSubst(operands[0]) {
+			return Violation{Rule: PipeRule, Detail: program + " runs the output of a command"}
+		}
+	case program == "sed":
+		files, inPlace := sedFiles(args)
+		if !inPlace {
+			return nil
+		}
+		for _, file := range files {
+			if err := c.target("sed -i", file); err != nil {
+				return err
+			}
+		}
+	case extractors[program] != nil:
+		return c.extract(program, args)
+	case interpreters[program]:
+		inPlace := false
+		for i, arg := range args {
+			lit, _ := literal(arg)
+			if shells[program] && lit == "-c" && i+1 < len(args) {
+				return c.nested(program, args[i+1:i+2], depth)
+			}
+			if inlineFlag(program, lit) {
+				return Violation{Rule: UncheckedRule, Detail: fmt.Sprintf("unable to check the inline script of %s %s, write it to a file", program, lit)}
+			}
+			if hasProcSubst(arg) {
+				return Violation{Rule: PipeRule, Detail: program + " runs the output of a command"}
+			}
+			inPlace = inPlace || strings.Contains(clustered(program, lit), "i")
+		}
+		// perl -i and ruby -i edit the files given after the script
+		if inPlace && len(operands) > 1 {
+			for _, operand := range operands[1:] {
+				if err := c.target(program+" -i", operand); err != nil {
+					return err
+				}
+			}
+		}
+	case program == "dd":
+		for _, arg := range args {
+			if lit, ok := literal(arg); ok && strings.HasPrefix(lit, "of=") {
+				return c.target(program, &syntax.Word{Parts: []syntax.WordPart{&syntax.Lit{Value: strings.TrimPrefix(lit, "of=")}}})
+			}
+		}
+	case writers[program]:
+		for _, operand := range operands {
+			if err := c.target(program, operand); err != nil {
+				return err
+			}
+		}
+	case movers[program] && len(operands) > 0:
+		return c.target(program, operands[len(operands)-1])
+	case modes[program] && len(operands) > 1:
+		for _, operand := range operands[1:] {
+			if err := c.target(program, operand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// find checks what find deletes with -delete and the programs its -exec actions run on the files found, the {} a
+// program is given is each path find starts from
+func (c checker) find(args []*syntax.Word, depth int) error {
+	starts := make([]*syntax.Word, 0)
+	i := 0
+	for ; i < len(args); i++ {
+		lit, ok := literal(args[i])
+		if ok && (lit == "-H" || lit == "-L" || lit == "-P") {
+			continue
+		}
+		if ok && (strings.HasPrefix(lit, "-") || lit == "(" || lit == "!") {
+			break
+		}
+		starts = append(starts, args[i])
+	}
+	if len(starts) == 0 {
+		starts = append(starts, &syntax.Word{Parts: []syntax.WordPart{&syntax.Lit{Value: "."}}})
+	}
+
+	for ; i < len(args); i++ {
+		lit, _ := literal(args[i])
+		if lit == "-delete" {
+			for _, start := range starts {
+				if err := c.target("find -delete", start); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !finders[lit] {
+			continue
+		}
+		end := i + 1
+		for end < len(args) {
+			if lit, _ := literal(args[end]); lit == ";" || lit == "+" {
+				break
+			}
+			end++
+		}
+		for _, start := range starts {
+			call := &syntax.CallExpr{Args: make([]*syntax.Word, 0, end-i-1)}
+			for _, arg := range args[i+1 : end] {
+				if lit, _ := literal(arg); lit == "{}" {
+					arg = start
+				}
+				call.Args = append(call.Args, arg)
+			}
+			if len(call.Args) == 0 {
+				break
+			}
+			if err := c.call(call, depth); err != nil {
+				return err
+			}
+		}
+		i = end
+	}
+	return nil
+}
+
+// extract checks the directory an extractor writes to, when it's given one. tar only writes to it when extracting,
+// tar -C otherwise is where it reads from.
+func (c checker) extract(program string, args []*syntax.Word) error {
+	if program != "unzip" && !tarExtracts(args) {
+		return nil
+	}
+	for i, arg := range args {
+		lit, ok := literal(arg)
+		if !ok {
+			continue
+		}
+		if extractors[program][lit] && i+1 < len(args) {
+			if err := c.target(program+" "+lit, args[i+1]); err != nil {
+				return err
+			}
+		}
+		if dir, ok := strings.CutPrefix(lit, "--directory="); ok && extractors[program]["--directory"] {
+			if err := c.target(program+" --directory", &syntax.Word{Parts: []syntax.WordPart{&syntax.Lit{Value: dir}}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nested checks the script a program such as bash -c or eval runs, the script has to be literal to be checked
+func (c checker) nested(program string, args []*syntax.Word, depth int) error {
+	script := make([]string, 0, len(args))
+	for _, arg := range args {
+		lit, ok := literal(arg)
+		if !ok {
+			return Violation{Rule: UncheckedRule, Detail: fmt.Sprintf("unable to check the script %s runs: %s", program, printed(arg))}
+		}
+		script = append(script, lit)
+	}
+	return c.script(strings.Join(script, " "), depth+1)
+}
+
+// redirect checks redirections that write to files
+func (c checker) redirect(r *syntax.Redirect) error {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrInOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+		return c.target("a redirect", r.Word)
+	case syntax.DplOut:
+		// >&2 duplicates a file descriptor, >&file writes to a file
+		if lit, ok := literal(r.Word); ok && (lit == "-" || strings.Trim(lit, "0123456789") == "") {
+			return nil
+		}
+		return c.target("a redirect", r.Word)
+	}
+	return nil
+}
+
+// pipe checks a shell isn't given a script on stdin, e.g. curl | sh or curl | (sh)
+func (c checker) pipe(b *syntax.BinaryCmd) error {
+	if b.Op != syntax.Pipe && b.Op != syntax.PipeAll {
+		return nil
+	}
+	if program := readsScript(b.Y); program != "" {
+		return Violation{Rule: PipeRule, Detail: "the output of a command is piped into " + program}
+	}
+	return nil
+}
+
+// heredoc checks a shell isn't given a script by a heredoc or here-string, e.g. bash <<EOF
+func (c checker) heredoc(stmt *syntax.Stmt) error {
+	for _, r := range stmt.Redirs {
+		if r.Op != syntax.Hdoc && r.Op != syntax.DashHdoc && r.Op != syntax.WordHdoc {
+			continue
+		}
+		if program := readsScriptCmd(stmt.Cmd); program != "" {
+			return Violation{Rule: PipeRule, Detail: "a heredoc is sent to " + program}
+		}
+	}
+	return nil
+}
+
+// readsScript is the interpreter of the statement that runs its stdin as a script, if any does. The first command of
+// a subshell or block, or of a list within them, reads the statement's stdin, unless it's redirected.
+func readsScript(stmt *syntax.Stmt) string {
+	for _, r := range stmt.Redirs {
+		switch r.Op {
+		case syntax.RdrIn, syntax.RdrInOut, syntax.Hdoc, syntax.DashHdoc, syntax.WordHdoc:
+			return ""
+		}
+	}
+	return readsScriptCmd(stmt.Cmd)
+}
+
+func readsScriptCmd(cmd syntax.Command) string {
+	switch cmd := cmd.(type) {
+	case *syntax.CallExpr:
+		return readsScriptCall(cmd)
+	case *syntax.Subshell:
+		return readsScriptStmts(cmd.Stmts)
+	case *syntax.Block:
+		return readsScriptStmts(cmd.Stmts)
+	case *syntax.BinaryCmd:
+		if program := readsScript(cmd.X); program != "" || cmd.Op == syntax.Pipe || cmd.Op == syntax.PipeAll {
+			return program
+		}
+		return readsScript(cmd.Y)
+	}
+	return ""
+}
+
+func readsScriptStmts(stmts []*syntax.Stmt) string {
+	for _, stmt := range stmts {
+		if program := readsScript(stmt); program != "" {
+			return program
+		}
+	}
+	return ""
+}
+
+// readsScriptCall is the interpreter the call runs on a script from stdin, looking through wrappers, e.g. env sh
+func readsScriptCall(call *syntax.CallExpr) string {
+	args := call.Args
+	program := ""
+	for len(args) > 0 {
+		name, _ := literal(args[0])
+		program = path.Base(name)
+		if !wrappers[program] {
+			break
+		}
+		args = wrapped(program, args[1:])
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	operands := operands(args[1:])
+	if program == "source" || program == "." {
+		if len(operands) > 0 {
+			if lit, _ := literal(operands[0]); stdins[lit] {
+				return program
+			}
+		}
+		return ""
+	}
+	if !interpreters[program] {
+		return ""
+	}
+	for _, operand := range operands {
+		if lit, _ := literal(operand); !stdins[lit] {
+			return "" // runs a script file, stdin is its input
+		}
+	}
+	return program
+}
+
+// functions checks no function calls itself, directly or through other functions, which is how fork bombs such as
+// :(){ :|:& };: work
+func (c checker) functions(file *syntax.File) error {
+	calls := map[string][]string{}
+	names := make([]string, 0)
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if f, ok := node.(*syntax.FuncDecl); ok {
+			if _, ok := calls[f.Name.Value]; !ok {
+				names = append(names, f.Name.Value)
+			}
+			calls[f.Name.Value] = append(calls[f.Name.Value], called(f.Body)...)
+		}
+		return true
+	})
+
+	// a function met again while the functions it calls are followed is in a cycle
+	const following, followed = 1, 2
+	state := map[string]int{}
+	var follow func(name string) bool
+	follow = func(name string) bool {
+		switch state[name] {
+		case following:
+			return true
+		case followed:
+			return false
+		}
+		state[name] = following
+		for _, callee := range calls[name] {
+			if _, ok := calls[callee]; ok && follow(callee) {
+				return true
+			}
+		}
+		state[name] = followed
+		return false
+	}
+	for _, name := range names {
+		if follow(name) {
+			return Violation{Rule: ForkBombRule, Detail: fmt.Sprintf("the function %s calls itself, directly or through other functions", name)}
+		}
+	}
+	return nil
+}
+
+// called are the names of the programs and functions called within node
+func called(node syntax.Node) []string {
+	res := make([]string, 0)
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+			if name, ok := literal(call.Args[0]); ok {
+				res = append(res, name)
+			}
+		}
+		return true
+	})
+	return res
+}
+
+// target checks a path written to stays within the sandbox, commands run from the goal's sandbox directory so any
+// absolute path or path up out of it is outside
+func (c checker) target(by string, word *syntax.Word) error {
+	prefix := literalPrefix(word)
+	if prefix == "" {
+		return Violation{Rule: SandboxRule, Detail: fmt.Sprintf("unable to tell where %s writes: %s", by, printed(word))}
+	}
+	if devices[prefix] {
+		return nil
+	}
+	clean := path.Clean(prefix)
+	if strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "~") || clean == ".." || strings.HasPrefix(clean, "../") {
+		return Violation{Rule: SandboxRule, Detail: fmt.Sprintf("%s writes outside the sandbox: %s", by, printed(word))}
+	}
+	return nil
+}
+
+// pattern is a denied program and the arguments it's denied with
+type pattern struct {
+	text    string
+	program string
+	args    []string
+}
+
+func patterns(deny []string) []pattern {
+	res := make([]pattern, 0, len(deny))
+	for _, text := range deny {
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		res = append(res, pattern{text: text, program: fields[0], args: expandFlags(fields[1:])})
+	}
+	return res
+}
+
+func (p pattern) matches(program string, args []string) bool {
+	if p.program != program {
+		return false
+	}
+	given := set(expandFlags(args)...)
+	for _, arg := range p.args {
+		if !given[arg] {
+			return false
+		}
+	}
+	return true
+}
+
+// expandFlags splits combined short flags, -rf is -r and -f
+func expandFlags(args []string) []string {
+	res := make([]string, 0, len(args))
+	for _, arg := range args {
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			for _, flag := range arg[1:] {
+				res = append(res, "-"+string(flag))
+			}
+			continue
+		}
+		res = append(res, arg)
+	}
+	return res
+}
+
+// operands are the arguments that aren't flags
+func operands(args []*syntax.Word) []*syntax.Word {
+	res := make([]*syntax.Word, 0, len(args))
+	flags := true
+	for _, arg := range args {
+		lit, _ := literal(arg)
+		if flags && lit == "--" {
+			flags = false
+			continue
+		}
+		if flags && len(lit) > 1 && lit[0] == '-' {
+			continue
+		}
+		res = append(res, arg)
+	}
+	return res
+}
+
+// sedFiles are the files sed is given, after its script, and whether it edits them in place
+func sedFiles(args []*syntax.Word) ([]*syntax.Word, bool) {
+	files := make([]*syntax.Word, 0, len(args))
+	inPlace, script := false, false // script is given with -e or -f rather than as the first operand
+	for i := 0; i < len(args); i++ {
+		lit, ok := literal(args[i])
+		switch {
+		case ok && lit == "--":
+			files = append(files, args[i+1:]...)
+			i = len(args)
+		case ok && strings.HasPrefix(lit, "--"):
+			inPlace = inPlace || lit == "--in-place" || strings.HasPrefix(lit, "--in-place=")
+			if lit == "--expression" || lit == "--file" || lit == "--line-length" {
+				i++
+			}
+			script = script || strings.HasPrefix(lit, "--expression") || strings.HasPrefix(lit, "--file")
+		case ok && len(lit) > 1 && lit[0] == '-':
+		flags:
+			for j := 1; j < len(lit); j++ {
+				switch lit[j] {
+				case 'i':
+					inPlace = true
+					break flags // followed by the suffix of the backup
+				case 'e', 'f', 'l':
+					script = script || lit[j] != 'l'
+					if j == len(lit)-1 {
+						i++ // the value is the next argument
+					}
+					break flags
+				}
+			}
+		default:
+			files = append(files, args[i])
+		}
+	}
+	if !script && len(files) > 0 {
+		files = files[1:]
+	}
+	return files, inPlace
+}
+
+// tarExtracts is whether tar is extracting an archive, -x, --extract or the x of its old style first argument
+func tarExtracts(args []*syntax.Word) bool {
+	for i, arg := range args {
+		lit, _ := literal(arg)
+		switch {
+		case lit == "--extract" || lit == "--get":
+			return true
+		case strings.HasPrefix(lit, "--"):
+		case strings.HasPrefix(lit, "-") || i == 0:
+			if strings.Contains(lit, "x") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clustered is the flags of a cluster of short flags of an interpreter that allows them, e.g. pi of perl's -pi.bak
+func clustered(program, lit string) string {
+	stops, ok := attached[program]
+	if !ok || len(lit) < 2 || lit[0] != '-' || lit[1] == '-' {
+		return ""
+	}
+	for i := 1; i < len(lit); i++ {
+		if strings.IndexByte(stops, lit[i]) >= 0 {
+			return lit[1 : i+1]
+		}
+	}
+	return lit[1:]
+}
+
+// inlineFlag is whether the argument is a flag the interpreter takes an inline script with, on its own or clustered
+func inlineFlag(program, lit string) bool {
+	if inline[program][lit] {
+		return true
+	}
+	flags := clustered(program, lit)
+	for flag := range inline[program] {
+		if len(flag) == 2 && strings.Contains(flags, flag[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapped is the program and arguments a wrapper runs, after its own flags and their values, variables and, for
+// timeout, duration
+func wrapped(wrapper string, args []*syntax.Word) []*syntax.Word {
+	value := false
+	for i, arg := range args {
+		if value {
+			value = false
+			continue
+		}
+		lit, ok := literal(arg)
+		if ok && strings.HasPrefix(lit, "-") {
+			value = valued[wrapper][lit]
+			continue
+		}
+		if ok && wrapper == "env" && strings.Contains(lit, "=") {
+			continue
+		}
+		if wrapper == "timeout" {
+			wrapper = "" // the first operand is the duration
+			continue
+		}
+		return args[i:]
+	}
+	return nil
+}
+
+// literal is the value of a word made only of literal and quoted text, with its backslash escapes removed
+func literal(word *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(unescape(p.Value, ""))
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(unescape(lit.Value, "$`\"\\\n"))
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// unescape removes the backslashes escaping a character, within double quotes only the characters of quoted are escaped
+func unescape(value, quoted string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && (quoted == "" || strings.IndexByte(quoted, value[i+1]) >= 0) {
+			i++
+			if value[i] != '\n' {
+				sb.WriteByte(value[i])
+			}
+			continue
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+// literalPrefix is the literal text at the start of a word, before any expansion
+func literalPrefix(word *syntax.Word) string {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		w := &syntax.Word{Parts: []syntax.WordPart{part}}
+		lit, ok := literal(w)
+		if !ok {
+			break
+		}
+		sb.WriteString(lit)
+	}
+	return sb.String()
+}
+
+func literals(words []*syntax.Word) []string {
+	res := make([]string, 0, len(words))
+	for _, word := range words {
+		if lit, ok := literal(word); ok {
+			res = append(res, lit)
+		}
+	}
+	return res
+}
+
+func hasProcSubst(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		if _, ok := part.(*syntax.ProcSubst); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func printed(word *syntax.Word) string {
+	var sb strings.Builder
+	_ = syntax.NewPrinter().Print(&sb, word)
+	return sb.String()
+}
+
+func set(values ...string) map[string]bool {
+	res := make(map[string]bool, len(values))
+	for _, v := range values {
+		res[v] = true
+	}
+	return res
+}
@@ -1,6 +1,9 @@
 package prompts
 
-// todo sanitize responses from the structure provided by a prompt
+import (
+	"strings"
+)
+
 var (
 	PlanTemplate = `
 You are an intelligent AI who specializes in planning. As part of a plan to solve a goal: "{{.Goal}}", 
@@ -8,16 +11,25 @@ devise a plan of tasks to execute on how to solve this goal.
 
 Each task should be solved independently of one another and any resources should be assumed to be stored in the directory ./tmp 
 which can be used between tasks.
-
+{{if .Files}}
+The user has provided files for the goal, here is a json list of their paths from the working directory and their sizes 
+in bytes:
+{{.Files}}
+{{end}}
 Tasks are costly, so try to use as few tasks as possible to complete the goal. 
 
 Try to solve simple goals with only one task.
 
 Limit the retrieval of resources and computation time when possible.
 
-Provide your response in the following json format, where the field tasks is an array of strings:
+Tasks that don't depend on each other are run at the same time. Give each task a short unique id, list the ids of the 
+tasks it needs to have completed first in depends_on, and list any files in ./tmp it is expected to produce in artifacts.
+
+Provide your response in the following json format, where the field tasks is an array of objects:
 {
-    "tasks": [{LIST_OF_REQUIREMENTS}],
+    "tasks": [
+        {"id": "{TASK_ID}", "task": "{TASK}", "depends_on": [{IDS_OF_TASKS_IT_NEEDS}], "artifacts": [{FILES_IT_PRODUCES}]}
+    ]
 }
 `
 
@@ -28,15 +40,20 @@ Here is an ordered json list of steps I have done so far to solve this goal:
 "{{.History}}"
 
 Any resources from previous steps should be assumed to be stored in the directory ./tmp.
-
+{{if .Files}}
+The user has provided files for the goal, here is a json list of their paths from the working directory and their sizes 
+in bytes:
+{{.Files}}
+{{end}}
 I have been given a new task to complete for this goal: "{{.Task}}"
-
+{{if .Artifacts}}
+The task is expected to produce: {{.Artifacts}}
+{{end}}{{if .Answers}}
+Here is a json list of questions the user has answered about this goal:
+{{.Answers}}
+{{end}}
 Find the the best way to complete the task using only one tool from only the following list:
-	- TERMINAL
-		- preference: use verbose flags where possible and avoid any dangerous commands
-		- description: a bash based unix terminal
-		- interface: Input([Command: string]): Output(OutputFile: []File)
-	- ROCKET_SHIP
+{{.Tools}}
 
 Pick one tool to complete the task.
 
@@ -54,10 +71,6 @@ Fill in the following json format, escape any invalid characters in the values,
 }
 ` // todo remove history when langchaingo supports it
 
-	//	- SEARCH
-	//		- preference: be concise and use keywords
-	//		- description: a search engine (e.g. Google)
-	//		- interface: Input([Query: string]): Output(Results: []string)
 	CommandDiagnoseTemplate = `
 You are an intelligent AI who specializes using a bash terminal, your OS is Debian and here is a non-exhaustive list of commands you might have access to:
 [
@@ -73,8 +86,13 @@ You're trying to solve the following task: {{.Task}}
 
 Here is a history of the commands that you've executed so far, in a json list: 
 {{.PreviousAttempts}}
-
-The field "command" is the command you tried, "error" is any error from the command, "reason" is why you ran it.
+{{if .Answers}}
+Here is a json list of questions the user has answered about this goal:
+{{.Answers}}
+{{end}}
+The field "command" is the command you tried, "output" and "stderr" are what it printed, "error" is any error from the 
+command, "reason" is why you ran it. Output marked "truncated" was cut short, a command that "timed out" was killed 
+because it ran for too long or was waiting for input.
 
 Your previous commands didn't help you solve the first command in the list.
 
@@ -86,12 +104,133 @@ A missing command "command not found" means that you need to install the command
 
 Don't use sudo.
 
+An error starting with "policy violation" means the command wasn't run because it isn't allowed, find another way 
+rather than working around the rule it broke. When the first command wasn't allowed, your command takes its place and 
+has to solve the task itself.
+
 Provide your next command in the following json format:
 {
     "command": "{NEW_COMMAND}",
 	"reason": "{REASON}"
 }
+
+If you can't determine a command without information only the user has, ask them instead in the following json format:
+{
+    "question": "{QUESTION}",
+	"reason": "{REASON}"
+}
+`
+
+	ReplanTemplate = `
+You are an intelligent AI who specializes in revising plans. A plan to solve the goal "{{.Goal}}" has gone wrong.
+
+Here is an ordered json list of the tasks that have completed so far, any resources they produced are stored in the 
+directory ./tmp:
+{{.History}}
+
+Here is a json list of the tasks of the plan that haven't completed:
+{{.Remaining}}
+{{if .Files}}
+The user has provided files for the goal, here is a json list of their paths from the working directory and their sizes 
+in bytes:
+{{.Files}}
+{{end}}
+The task "{{.Task}}" went wrong: {{.Reason}}
+{{if .Answers}}
+Here is a json list of questions the user has answered about this goal:
+{{.Answers}}
+{{end}}
+Revise the tasks that haven't completed so the goal can still be solved, taking into account what went wrong. 
+Don't repeat the completed tasks, a revised task can depend on them by their id.
+
+Tasks that don't depend on each other are run at the same time. Give each task a short unique id, list the ids of the 
+tasks it needs to have completed first in depends_on, and list any files in ./tmp it is expected to produce in artifacts.
+
+Provide your response in the following json format, where the field tasks is an array of objects:
+{
+    "tasks": [
+        {"id": "{TASK_ID}", "task": "{TASK}", "depends_on": [{IDS_OF_TASKS_IT_NEEDS}], "artifacts": [{FILES_IT_PRODUCES}]}
+    ]
+}
+`
+
+	VerifyTemplate = `
+You are an intelligent AI who specializes in reviewing the results of tasks. As part of a plan to solve a goal: "{{.Goal}}"
+
+The task "{{.Task}}" was run, and its expected outcome was: "{{.Outcome}}"
+
+Here is the result of the task:
+{{.Result}}
+
+Decide whether the result contradicts the expected outcome. A result that is only worded differently or has more 
+detail than expected still matches.
+
+Provide your response in the following json format:
+{
+    "matches": {TRUE_OR_FALSE},
+    "reason": "{REASON}"
+}
+`
+
+	SearchTemplate = `
+You are an intelligent AI who specializes in research. As part of a plan to solve a goal, you searched for: "{{.Search}}"
+
+The search was expected to find: "{{.Outcome}}"
+{{if .Limitations}}
+Its possible limitations were: {{.Limitations}}
+{{end}}
+Here is a json list of the results, most relevant first, each with its title, url and a snippet of its content:
+{{.Results}}
+
+Summarize what the results say towards the expected outcome, citing the url of each result you use. Only use what is 
+in the results, if they don't have what was expected say so and summarize what they do have.
+`
+
+	RepairTemplate = `
+Your previous answer could not be used because it isn't valid json or doesn't match the required format.
+
+Here is your previous answer:
+{{.Answer}}
+
+Here is the problem with it:
+{{.Problem}}
+
+Here is the json schema your answer must match:
+{{.Schema}}
+
+Provide only the corrected json, without any other text.
 `
 
 	// todo make the list of commands a prompt.. let the agent use its memory and reasoning to determine what it should do
 )
+
+const (
+	PlanName     = "plan"
+	TaskName     = "task"
+	DiagnoseName = "diagnose"
+	RepairName   = "repair"
+	ReplanName   = "replan"
+	VerifyName   = "verify"
+	SearchName   = "search"
+)
+
+// Identify returns the name of the template a prompt was rendered from by matching the text before the template's
+// first field, or an empty string if no template matches
+func Identify(prompt string) string {
+	templates := map[string]string{
+		PlanName:     PlanTemplate,
+		TaskName:     TaskTemplate,
+		DiagnoseName: CommandDiagnoseTemplate,
+		RepairName:   RepairTemplate,
+		ReplanName:   ReplanTemplate,
+		VerifyName:   VerifyTemplate,
+		SearchName:   SearchTemplate,
+	}
+	for name, text := range templates {
+		prefix, _, _ := strings.Cut(text, "{{")
+		if strings.HasPrefix(prompt, prefix) {
+			return name
+		}
+	}
+	return ""
+}
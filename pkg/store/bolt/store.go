@@ -0,0 +1,118 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var goalsBucket = []byte("goals")
+
+// Store is a GoalStore backed by a single bolt database file
+type Store struct {
+	db *bbolt.DB
+}
+
+var _ store.GoalStore = (*Store)(nil)
+
+func New(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(goalsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create bucket: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Create(ctx context.Context, goal models.Goal) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(goalsBucket)
+		if b.Get(goal.ID[:]) != nil {
+			return fmt.Errorf("goal %s already exists", goal.ID)
+		}
+		return put(b, goal)
+	})
+}
+
+func (s *Store) Get(ctx context.Context, id uuid.UUID) (models.Goal, error) {
+	var goal models.Goal
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		goal, err = get(tx.Bucket(goalsBucket), id)
+		return err
+	})
+	return goal, err
+}
+
+func (s *Store) Update(ctx context.Context, id uuid.UUID, fn func(goal *models.Goal) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(goalsBucket)
+		goal, err := get(b, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(&goal); err != nil {
+			return err
+		}
+		goal.UpdatedAt = time.Now()
+		return put(b, goal)
+	})
+}
+
+func (s *Store) List(ctx context.Context, filter store.Filter) ([]models.Goal, int, error) {
+	goals := make([]models.Goal, 0)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(goalsBucket).ForEach(func(_, v []byte) error {
+			goal := models.Goal{}
+			if err := json.Unmarshal(v, &goal); err != nil {
+				return fmt.Errorf("unmarshal: %w", err)
+			}
+			if filter.Match(goal) {
+				goals = append(goals, goal)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return filter.Paginate(goals), len(goals), nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func get(b *bbolt.Bucket, id uuid.UUID) (models.Goal, error) {
+	v := b.Get(id[:])
+	if v == nil {
+		return models.Goal{}, store.ErrNotFound
+	}
+	goal := models.Goal{}
+	if err := json.Unmarshal(v, &goal); err != nil {
+		return models.Goal{}, fmt.Errorf("unmarshal: %w", err)
+	}
+	return goal, nil
+}
+
+func put(b *bbolt.Bucket, goal models.Goal) error {
+	v, err := json.Marshal(goal)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return b.Put(goal.ID[:], v)
+}
@@ -0,0 +1,86 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_Update(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goals.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	id := uuid.New()
+	if err := s.Create(ctx, models.NewGoal(id, "say hello")); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(ctx, id, func(goal *models.Goal) error {
+		goal.Transition(models.Thinking)
+		goal.TaskHistory = append(goal.TaskHistory, models.TaskHistory{Task: "echo hello"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen to make sure the goal survives a restart
+	s, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	goal, err := s.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goal.State != models.Thinking || len(goal.Transitions) != 2 || len(goal.TaskHistory) != 1 {
+		t.Errorf("unexpected goal: %+v", goal)
+	}
+
+	if _, err := s.Get(ctx, uuid.New()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestStore_List(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "goals.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	for _, text := range []string{"write a python file", "summarize a CSV", "write a go file"} {
+		if err := s.Create(ctx, models.NewGoal(uuid.New(), text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goals, total, err := s.List(ctx, store.Filter{Query: "WRITE", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(goals) != 1 || goals[0].Goal != "write a go file" {
+		t.Errorf("unexpected page: total=%d goals=%+v", total, goals)
+	}
+
+	goals, total, err = s.List(ctx, store.Filter{States: []models.State{models.Finished}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 || len(goals) != 0 {
+		t.Errorf("expected no finished goals, got %+v", goals)
+	}
+}
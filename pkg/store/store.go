@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go-autogpt/pkg/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("goal not found")
+
+// GoalStore persists goals so they outlive the actors working on them
+type GoalStore interface {
+	Create(ctx context.Context, goal models.Goal) error
+	Get(ctx context.Context, id uuid.UUID) (models.Goal, error)
+	// Update applies fn to the stored goal atomically, the goal is only written if fn returns no error
+	Update(ctx context.Context, id uuid.UUID, fn func(goal *models.Goal) error) error
+	// List returns a page of the goals matching the filter, newest first, along with the total number of matches
+	List(ctx context.Context, filter Filter) ([]models.Goal, int, error)
+	Close() error
+}
+
+// Filter narrows down the goals returned by List, the zero value matches every goal
+type Filter struct {
+	States        []models.State
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Query         string // case-insensitive match on the goal
+	Offset        int
+	Limit         int // zero returns every match
+}
+
+func (f Filter) Match(goal models.Goal) bool {
+	if !f.CreatedAfter.IsZero() && goal.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !goal.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(goal.Goal), strings.ToLower(f.Query)) {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, state := range f.States {
+		if goal.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Paginate sorts matching goals newest first and cuts out the page the filter asks for
+func (f Filter) Paginate(goals []models.Goal) []models.Goal {
+	sort.SliceStable(goals, func(i, j int) bool {
+		return goals[i].CreatedAt.After(goals[j].CreatedAt)
+	})
+	if f.Offset >= len(goals) {
+		return []models.Goal{}
+	}
+	goals = goals[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(goals) {
+		goals = goals[:f.Limit]
+	}
+	return goals
+}
@@ -1,8 +1,9 @@
 package tools
 
-type Tool string
-
+// names of the built in tools, as the LLM picks them
 const (
-	Search   Tool = "SEARCH"
-	Terminal Tool = "TERMINAL"
+	Search   = "SEARCH"
+	Terminal = "TERMINAL"
+	Fetch    = "FETCH"
+	AskUser  = "ASK_USER" // handled by the supervisor rather than a tool's actor
 )
@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+	"go-autogpt/pkg/goalctx"
+	"go-autogpt/pkg/llm"
+	"go-autogpt/pkg/logger"
+	"go-autogpt/pkg/models"
+	"go-autogpt/pkg/store"
+	"sync"
+)
+
+var (
+	callsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "goautogpt_llm_calls_total",
+		Help: "LLM calls made by the agents",
+	}, []string{"agent", "model"})
+	tokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "goautogpt_llm_tokens_total",
+		Help: "Tokens sent to and received from the LLM, by kind (prompt or completion)",
+	}, []string{"agent", "model", "kind"})
+	costTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "goautogpt_llm_cost_dollars_total",
+		Help: "Estimated dollars spent on LLM calls",
+	}, []string{"agent", "model"})
+)
+
+// Meter accounts for the tokens and cost of every LLM call by the goal and task of the call's context, the usage
+// of a goal is kept on the goal in the store
+type Meter struct {
+	mu    sync.Mutex
+	goals store.GoalStore
+	tasks map[uuid.UUID]map[string]models.Usage
+}
+
+func NewMeter(goals store.GoalStore) *Meter {
+	return &Meter{
+		goals: goals,
+		tasks: map[uuid.UUID]map[string]models.Usage{},
+	}
+}
+
+// LLM wraps the LLM of an agent so every call is metered against the model's prices
+func (m *Meter) LLM(agent string, model llm.Model, next llms.LLM) llms.LLM {
+	return &meteredLLM{meter: m, agent: agent, model: model, next: next}
+}
+
+// Task returns the usage so far of a task of the goal, by the task's id
+func (m *Meter) Task(id uuid.UUID, task string) models.Usage {
+	if m == nil {
+		return models.Usage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tasks[id][task]
+}
+
+// Forget drops the usage kept for the tasks of a goal once it has ended
+func (m *Meter) Forget(id uuid.UUID) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tasks, id)
+}
+
+func (m *Meter) record(ctx context.Context, agent string, model llm.Model, call models.Usage) {
+	name := model.Name()
+	callsTotal.WithLabelValues(agent, name).Add(float64(call.Calls))
+	tokensTotal.WithLabelValues(agent, name, "prompt").Add(float64(call.PromptTokens))
+	tokensTotal.WithLabelValues(agent, name, "completion").Add(float64(call.CompletionTokens))
+	costTotal.WithLabelValues(agent, name).Add(call.Cost)
+
+	id := goalctx.ID(ctx)
+	if id == uuid.Nil {
+		return
+	}
+	if task := goalctx.Task(ctx); task != "" {
+		m.mu.Lock()
+		if m.tasks[id] == nil {
+			m.tasks[id] = map[string]models.Usage{}
+		}
+		m.tasks[id][task] = m.tasks[id][task].Add(call)
+		m.mu.Unlock()
+	}
+	err := m.goals.Update(context.Background(), id, func(goal *models.Goal) error {
+		goal.Usage = goal.Usage.Add(call)
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str(logger.RequestTaskID, id.String()).Msg("unable to record llm usage")
+	}
+}
+
+type meteredLLM struct {
+	meter *Meter
+	agent string
+	model llm.Model
+	next  llms.LLM
+}
+
+func (l *meteredLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	generations, err := l.Generate(ctx, []string{prompt}, options...)
+	if err != nil {
+		return "", err
+	}
+	return generations[0].Text, nil
+}
+
+func (l *meteredLLM) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+	generations, err := l.next.Generate(ctx, prompts, options...)
+	if err != nil {
+		return nil, err
+	}
+	call := models.Usage{Calls: len(prompts)}
+	for i, generation := range generations {
+		prompt, completion := tokens(generation)
+		if prompt == 0 && i < len(prompts) {
+			prompt = Estimate(prompts[i])
+		}
+		if completion == 0 {
+			completion = Estimate(generation.Text)
+		}
+		call.PromptTokens += prompt
+		call.CompletionTokens += completion
+	}
+	call.Cost = l.model.Cost(call.PromptTokens, call.CompletionTokens)
+	l.meter.record(ctx, l.agent, l.model, call)
+	return generations, nil
+}
+
+// tokens reads the usage a provider reports in the generation info
+func tokens(generation *llms.Generation) (int, int) {
+	prompt, _ := generation.GenerationInfo["promptTokens"].(int)
+	completion, _ := generation.GenerationInfo["completionTokens"].(int)
+	return prompt, completion
+}
+
+// Estimate is a rough count of the tokens in text for providers that don't report their usage, around 4 characters
+// of English make a token
+func Estimate(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,300 @@
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-autogpt/pkg/models"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrOutside is the error of writing to a path out of the workspace
+var ErrOutside = errors.New("the path is outside of the workspace")
+
+// Snapshot is the regular files of a goal's workspace, by their path
+type Snapshot map[string]models.File
+
+// Take snapshots the files in dir, leaving out the top level directories in skip. Files with the size and modification
+// time they had in the previous snapshot keep its hash instead of being read again. A dir that doesn't exist yet is
+// empty.
+func Take(dir string, previous Snapshot, skip ...string) (Snapshot, error) {
+	snapshot := Snapshot{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			for _, s := range skip {
+				if rel == s {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while the workspace was walked
+		}
+		if err != nil {
+			return err
+		}
+		file := models.File{Path: rel, Size: info.Size(), ModTime: info.ModTime()}
+		if prev, ok := previous[rel]; ok && prev.Size == file.Size && prev.ModTime.Equal(file.ModTime) {
+			file.Hash = prev.Hash
+		} else if file.Hash, err = hash(path); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		snapshot[rel] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Diff is the files created, modified and deleted between the snapshot and the one after it, by path
+func (s Snapshot) Diff(after Snapshot) []models.FileChange {
+	changes := make([]models.FileChange, 0)
+	for path, file := range after {
+		before, ok := s[path]
+		switch {
+		case !ok:
+			changes = append(changes, models.FileChange{Change: models.Created, Path: path, Size: file.Size, Hash: file.Hash})
+		case before.Hash != file.Hash:
+			changes = append(changes, models.FileChange{Change: models.Modified, Path: path, Size: file.Size, Hash: file.Hash})
+		}
+	}
+	for path, file := range s {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, models.FileChange{Change: models.Deleted, Path: path, Size: file.Size, Hash: file.Hash})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// Files are the files of the snapshot, by path
+func (s Snapshot) Files() []models.File {
+	files := make([]models.File, 0, len(s))
+	for _, file := range s {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Open opens the regular file at path in dir. Paths out of dir, including through symlinks, don't exist.
+func Open(dir, path string) (*os.File, fs.FileInfo, error) {
+	notExist := &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	path = filepath.FromSlash(path)
+	if !filepath.IsLocal(path) {
+		return nil, nil, notExist
+	}
+	full, err := resolve(dir, path)
+	if errors.Is(err, ErrOutside) {
+		return nil, nil, notExist
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		_ = f.Close()
+		return nil, nil, notExist
+	}
+	return f, info, nil
+}
+
+// Write writes the file at path in dir from r, replacing the file that's there. A symlink at path is replaced rather
+// than followed, and paths out of dir, including through symlinks, are refused.
+func Write(dir, path string, r io.Reader) (models.File, error) {
+	name := filepath.FromSlash(path)
+	if !filepath.IsLocal(name) {
+		return models.File{}, fmt.Errorf("%s: %w", path, ErrOutside)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return models.File{}, err
+	}
+	// the directories that exist are checked before the missing ones are made, so they aren't made through a symlink
+	existing := filepath.Dir(name)
+	for existing != "." {
+		if _, err := os.Lstat(filepath.Join(dir, existing)); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if _, err := resolve(dir, existing); err != nil {
+		return models.File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.ModePerm); err != nil {
+		return models.File{}, err
+	}
+	parent, err := resolve(dir, filepath.Dir(name))
+	if err != nil {
+		return models.File{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(parent, ".upload-*")
+	if err != nil {
+		return models.File{}, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return models.File{}, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return models.File{}, err
+	}
+	target := filepath.Join(parent, filepath.Base(name))
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return models.File{}, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return models.File{}, err
+	}
+	return models.File{Path: filepath.ToSlash(name), Size: size, Hash: hex.EncodeToString(h.Sum(nil)), ModTime: info.ModTime()}, nil
+}
+
+// resolve follows the symlinks of the path in dir, it returns ErrOutside if they lead out of it
+func resolve(dir, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	full, err := filepath.EvalSymlinks(filepath.Join(root, path))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, full); err != nil || !filepath.IsLocal(rel) {
+		return "", ErrOutside
+	}
+	return full, nil
+}
+
+// Archive writes the directories, regular files and symlinks in dir to w as a gzipped tarball, symlinks aren't
+// followed. A dir that doesn't exist yet is an empty tarball.
+func Archive(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return addToArchive(tw, path, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addToArchive(tw *tar.Writer, path, name string, info fs.FileInfo) error {
+	link := ""
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		link = target
+	case info.IsDir(), info.Mode().IsRegular():
+	default:
+		return nil // devices, sockets and pipes
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the file can grow while it's archived, only the size in its header is written
+	if _, err := io.CopyN(tw, f, header.Size); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package workspace
+
+import (
+	"errors"
+	"go-autogpt/pkg/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, dir, path, content string) {
+	t.Helper()
+	path = filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshot_Diff(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "tmp/kept.txt", "kept")
+	write(t, dir, "tmp/changed.txt", "before")
+	write(t, dir, "tmp/deleted.txt", "deleted")
+	write(t, dir, "logs/task.log", "$ true")
+	before, err := Take(dir, nil, "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, dir, "tmp/changed.txt", "after!")
+	write(t, dir, "tmp/created/file.txt", "created")
+	write(t, dir, "logs/task.log", "$ true\n$ false")
+	if err := os.Remove(filepath.Join(dir, "tmp/deleted.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/hostname", filepath.Join(dir, "tmp/link")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := Take(dir, before, "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.FileChange{
+		{Change: models.Modified, Path: "tmp/changed.txt", Size: 6, Hash: after["tmp/changed.txt"].Hash},
+		{Change: models.Created, Path: "tmp/created/file.txt", Size: 7, Hash: after["tmp/created/file.txt"].Hash},
+		{Change: models.Deleted, Path: "tmp/deleted.txt", Size: 7, Hash: before["tmp/deleted.txt"].Hash},
+	}
+	if got := before.Diff(after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+	if before["tmp/changed.txt"].Hash == after["tmp/changed.txt"].Hash {
+		t.Error("Take() kept the hash of a file of the same size that changed")
+	}
+}
+
+func TestTake_missing(t *testing.T) {
+	snapshot, err := Take(filepath.Join(t.TempDir(), "missing"), nil)
+	if err != nil || snapshot == nil || len(snapshot) != 0 {
+		t.Errorf("Take() = %v, %v, want an empty snapshot", snapshot, err)
+	}
+}
+
+func TestTake_reusesHashes(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "file.txt", "content")
+	modTime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "file.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := Take(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous["file.txt"] = models.File{Path: "file.txt", Size: 7, Hash: "previous", ModTime: previous["file.txt"].ModTime}
+
+	snapshot, err := Take(dir, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot["file.txt"].Hash != "previous" {
+		t.Errorf("Take() hashed a file that didn't change again, got %s", snapshot["file.txt"].Hash)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	outside := t.TempDir()
+	write(t, outside, "secret.txt", "secret")
+	dir := t.TempDir()
+	write(t, dir, "tmp/hello.txt", "hello")
+	if err := os.Symlink("hello.txt", filepath.Join(dir, "tmp/inside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "tmp/outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		content string // empty when the file doesn't exist
+	}{
+		{path: "tmp/hello.txt", content: "hello"},
+		{path: "tmp/inside", content: "hello"},
+		{path: "tmp/outside"},
+		{path: "tmp"},
+		{path: "tmp/missing.txt"},
+		{path: "../" + filepath.Base(outside) + "/secret.txt"},
+		{path: filepath.Join(outside, "secret.txt")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			f, _, err := Open(dir, tt.path)
+			if tt.content == "" {
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Open() error = %v, want it not to exist", err)
+				}
+				if f != nil {
+					_ = f.Close()
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			b, _ := os.ReadFile(f.Name())
+			if string(b) != tt.content {
+				t.Errorf("Open() = %q, want %q", b, tt.content)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	outside := t.TempDir()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "tmp/out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "linked.txt"), filepath.Join(dir, "tmp/linked.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		outside bool
+	}{
+		{path: "data.csv"},
+		{path: "tmp/nested/data.csv"},
+		{path: "tmp/linked.txt"}, // the symlink is replaced
+		{path: "../data.csv", outside: true},
+		{path: "tmp/out/data.csv", outside: true},
+		{path: "tmp/out/nested/data.csv", outside: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			file, err := Write(dir, tt.path, strings.NewReader("a,b\n"))
+			if tt.outside {
+				if !errors.Is(err, ErrOutside) {
+					t.Errorf("Write() error = %v, want %v", err, ErrOutside)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshot, err := Take(dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Size != 4 || file.Hash != snapshot[tt.path].Hash || !file.ModTime.Equal(snapshot[tt.path].ModTime) {
+				t.Errorf("Write() = %+v, want %+v", file, snapshot[tt.path])
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Write() wrote outside the workspace: %v", entries)
+	}
+}